@@ -18,4 +18,8 @@ package wallet
 const (
 	WALLLET_VERSION      = byte(0x00)
 	ADDRESS_CHECKSUM_LEN = 4
+
+	// LEGACY_WALLETS_SUFFIX is appended to the path of a wallets file to save
+	// its original content when wallets of an older version are migrated.
+	LEGACY_WALLETS_SUFFIX = ".legacy"
 )
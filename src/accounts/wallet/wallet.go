@@ -34,7 +34,7 @@ type Wallet struct {
 }
 
 func NewWallet() *Wallet {
-	private, public := newKeyPair()
+	public, private := newKeyPair()
 	wallet := Wallet{private, public}
 	return &wallet
 }
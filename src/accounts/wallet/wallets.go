@@ -26,15 +26,21 @@ import (
 
 	"github.com/YuriyLisovskiy/blockchain-go/src/config"
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/secp256k1"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
 
 type Wallets struct {
 	Wallets map[string]*Wallet
+
+	// PendingTxs holds serialized replaceable transactions sent from the
+	// wallets keyed by their hex encoded hashes, so their fees can be bumped.
+	PendingTxs map[string][]byte
 }
 
 func NewWallets(cfg config.Config) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.PendingTxs = make(map[string][]byte)
 	err := wallets.LoadFromFile(cfg)
 	return &wallets, err
 }
@@ -62,6 +68,22 @@ func (ws Wallets) GetWallet(address string) (Wallet, error) {
 	return *wallet, nil
 }
 
+func (ws *Wallets) AddPendingTx(txID string, data []byte) {
+	ws.PendingTxs[txID] = data
+}
+
+func (ws Wallets) GetPendingTx(txID string) ([]byte, error) {
+	data, exists := ws.PendingTxs[txID]
+	if !exists {
+		return nil, errors.New(fmt.Sprintf("pending transaction %s not found", txID))
+	}
+	return data, nil
+}
+
+func (ws *Wallets) RemovePendingTx(txID string) {
+	delete(ws.PendingTxs, txID)
+}
+
 func (ws *Wallets) LoadFromFile(cfg config.Config) error {
 	if _, err := os.Stat(cfg.WalletsPath); os.IsNotExist(err) {
 		return err
@@ -77,7 +99,48 @@ func (ws *Wallets) LoadFromFile(cfg config.Config) error {
 	if err != nil {
 		log.Panic(err)
 	}
-	ws.Wallets = wallets.Wallets
+	ws.Wallets = make(map[string]*Wallet)
+	migrated := false
+	for address, wallet := range wallets.Wallets {
+		if isLegacyWallet(wallet) {
+			wallet.PrivateKey, wallet.PublicKey = wallet.PublicKey, wallet.PrivateKey
+			newAddress := fmt.Sprintf("%s", wallet.GetAddress())
+			utils.PrintLog(fmt.Sprintf("Wallet %s has swapped keys, its address is changed to %s\n", address, newAddress))
+			address = newAddress
+			migrated = true
+		}
+		ws.Wallets[address] = wallet
+	}
+	ws.PendingTxs = wallets.PendingTxs
+	if ws.PendingTxs == nil {
+		ws.PendingTxs = make(map[string][]byte)
+	}
+	if migrated {
+		return keepLegacyFile(cfg.WalletsPath, fileContent)
+	}
+	return nil
+}
+
+// isLegacyWallet reports whether the wallet is created by older versions,
+// which stored the private key in place of the public one and vice versa.
+func isLegacyWallet(wallet *Wallet) bool {
+	return len(wallet.PrivateKey) != 32 && len(wallet.PublicKey) == 32
+}
+
+// keepLegacyFile saves the content of a wallets file with legacy wallets
+// next to it, unless it is saved already. Addresses of legacy wallets are
+// changed when their keys are put in place, the original file is needed
+// to access coins sent to old addresses.
+func keepLegacyFile(path string, content []byte) error {
+	legacyPath := path + LEGACY_WALLETS_SUFFIX
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		return err
+	}
+	err := ioutil.WriteFile(legacyPath, content, 0600)
+	if err != nil {
+		return err
+	}
+	utils.PrintLog(fmt.Sprintf("Wallets of an older version are saved to %s\n", legacyPath))
 	return nil
 }
 
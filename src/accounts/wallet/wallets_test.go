@@ -15,8 +15,59 @@
 
 package wallet
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/config"
+)
 
 func TestWallets(test *testing.T) {
 
 }
+
+func TestWallets_LoadFromFileLegacy(test *testing.T) {
+	dir, err := ioutil.TempDir("", "wallets")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := config.Config{WalletsPath: filepath.Join(dir, "wallets.dat")}
+
+	// Older versions stored the private key in place of the public one.
+	w := NewWallet()
+	legacy := &Wallet{PrivateKey: w.PublicKey, PublicKey: w.PrivateKey}
+	legacyAddress := fmt.Sprintf("%s", legacy.GetAddress())
+	Wallets{Wallets: map[string]*Wallet{legacyAddress: legacy}}.SaveToFile(cfg)
+	content, err := ioutil.ReadFile(cfg.WalletsPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	wallets, err := NewWallets(cfg)
+	if err != nil {
+		test.Fatal(err)
+	}
+	address := fmt.Sprintf("%s", w.GetAddress())
+	migrated, err := wallets.GetWallet(address)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !bytes.Equal(migrated.PrivateKey, w.PrivateKey) {
+		test.Errorf("invalid private key:\nactual:\n%x\nexpected:\n%x", migrated.PrivateKey, w.PrivateKey)
+	}
+	if _, err := wallets.GetWallet(legacyAddress); err == nil {
+		test.Errorf("legacy address %s is kept", legacyAddress)
+	}
+	saved, err := ioutil.ReadFile(cfg.WalletsPath + LEGACY_WALLETS_SUFFIX)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !bytes.Equal(saved, content) {
+		test.Error("legacy wallets file is not kept")
+	}
+}
@@ -22,22 +22,26 @@ import (
 	"os"
 
 	"github.com/YuriyLisovskiy/blockchain-go/src/config"
-	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/fees"
 )
 
 type CLI struct{}
 
 func (cli *CLI) printUsage() {
 	fmt.Println("Usage:")
-	fmt.Print("  config\n    -ip string\n\tNode ip address\n    -port\n\tNode id\n    -path.chain\n\tPath to block chain database\n    -path.wallets\n\tPath to wallets location\n    -default\n\tSet default config\n\n")
+	fmt.Print("  bumpfee\n    -txid string\n\tHash of the pending replaceable transaction\n    -fee string\n\tNew fee per byte of the transaction, estimated if not set\n\n")
+	fmt.Print("  config\n    -ip string\n\tNode ip address\n    -port\n\tNode id\n    -path.chain\n\tPath to block chain database\n    -path.wallets\n\tPath to wallets location\n    -network\n\tNetwork to run on: main, test, regtest or poa\n    -signers string\n\tComma separated hex public keys of proof of authority signers\n    -default\n\tSet default config\n\n")
 	fmt.Print("  createblockchain\n    -address string\n\tThe address to send genesis block reward to\n\n")
 	fmt.Print("  createwallet\n\tGenerates a new key-pair and saves it into the wallet file\n\n")
+	fmt.Print("  estimatefee\n    -blocks int\n\tNumber of blocks the transaction should be confirmed within\n\n")
 	fmt.Print("  getbalance\n    -address string\n\tThe address to get balance for\n\n")
 	fmt.Print("  listaddresses\n\tLists all addresses from the wallet file\n\n")
+	fmt.Print("  mine\n    -node string\n\tAddress of the node's stratum server\n    -threads int\n\tNumber of mining threads, all CPUs are used if not set\n\n")
 	fmt.Print("  printchain\n\tPrint all the blocks of the blockchain\n\n")
 	fmt.Print("  reindexutxo\n\tRebuilds the UTXO set\n\n")
-	fmt.Print("  send\n    -from string\n\tSource wallet address\n    -to string\n\tDestination wallet address\n    -amount int\n\tAmount to send\n    -mine\n\tMine on the same node\n\n")
-	fmt.Print("  startnode\n    -miner string\n\tStart a node with ID specified in NODE_ID env. var. -miner enables mining\n\n")
+	fmt.Print("  reindextx\n\tBuilds the transaction index, enabling it if it does not exist\n\n")
+	fmt.Print("  send\n    -from string\n\tSource wallet address\n    -to string\n\tDestination wallet address\n    -amount string\n\tAmount to send\n    -fee string\n\tFee per byte of the transaction, estimated if not set\n    -replaceable\n\tAllow to bump the fee of the transaction later\n    -mine\n\tMine on the same node\n\n")
+	fmt.Print("  startnode\n    -miner string\n\tStart a node with ID specified in NODE_ID env. var. -miner enables mining\n    -threads int\n\tNumber of mining threads, all CPUs are used if not set\n    -stratum string\n\tServe mining jobs to external miners on given address instead of mining\n\n")
 }
 
 func (cli *CLI) validateArgs() {
@@ -52,36 +56,57 @@ func (cli *CLI) Run() {
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 
+	bumpFeeTxID := bumpFeeCmd.String("txid", "", "Hash of the pending replaceable transaction")
+	bumpFeeFee := bumpFeeCmd.String("fee", "", "New fee per byte of the transaction, estimated if not set")
+
 	configIp := configCmd.String("ip", "", "Node ip address")
 	configPort := configCmd.Int("port", -1, "Node id")
 	configChainPath := configCmd.String("path.chain", "", "Path to block chain database")
 	configWalletsPath := configCmd.String("path.wallets", "", "Path to wallets location")
+	configNetwork := configCmd.String("network", "", "Network to run on: main, test, regtest or poa")
+	configSigners := configCmd.String("signers", "", "Comma separated hex public keys of proof of authority signers")
 	configDefault := configCmd.Bool("default", false, "Set default config")
 
 	createBlockChainAddress := createBlockChainCmd.String("address", "", "The address to send genesis block reward to")
 
+	mineNode := mineCmd.String("node", "", "Address of the node's stratum server")
+	mineThreads := mineCmd.Int("threads", 0, "Number of mining threads, all CPUs are used if not set")
+
+	estimateFeeBlocks := estimateFeeCmd.Int("blocks", fees.DEFAULT_CONFIRM_TARGET, "Number of blocks the transaction should be confirmed within")
+
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
-	sendAmount := sendCmd.Float64("amount", 0, "Amount to send")
-	sendFee := sendCmd.Float64("fee", vars.MIN_FEE_PER_BYTE, "Mine immediately on the same node")
+	sendAmount := sendCmd.String("amount", "", "Amount to send")
+	sendFee := sendCmd.String("fee", "", "Fee per byte of the transaction, estimated if not set")
+	sendReplaceable := sendCmd.Bool("replaceable", false, "Allow to bump the fee of the transaction later")
 
 	startNodeMiner := startNodeCmd.String("mine", "", "Enable mining mode")
+	startNodeThreads := startNodeCmd.Int("threads", 0, "Number of mining threads, all CPUs are used if not set")
+	startNodeStratum := startNodeCmd.String("stratum", "", "Serve mining jobs to external miners on given address instead of mining")
 
 	switch os.Args[1] {
 	case "balance":
 		checkError(getBalanceCmd.Parse(os.Args[2:]))
+	case "bumpfee":
+		checkError(bumpFeeCmd.Parse(os.Args[2:]))
 	case "config":
 		checkError(configCmd.Parse(os.Args[2:]))
 	case "createblockchain":
 		checkError(createBlockChainCmd.Parse(os.Args[2:]))
 	case "createwallet":
 		checkError(createWalletCmd.Parse(os.Args[2:]))
+	case "estimatefee":
+		checkError(estimateFeeCmd.Parse(os.Args[2:]))
 	case "listaddresses":
 		checkError(listAddressesCmd.Parse(os.Args[2:]))
+	case "mine":
+		checkError(mineCmd.Parse(os.Args[2:]))
 	case "printchain":
 		checkError(printChainCmd.Parse(os.Args[2:]))
 	case "reindexutxo":
 		checkError(reindexUTXOCmd.Parse(os.Args[2:]))
+	case "reindextx":
+		checkError(reindexTxCmd.Parse(os.Args[2:]))
 	case "send":
 		checkError(sendCmd.Parse(os.Args[2:]))
 	case "startnode":
@@ -94,7 +119,7 @@ func (cli *CLI) Run() {
 		if *configDefault {
 			cli.setDefaultConfig()
 		} else {
-			cli.setConfig(*configIp, *configPort, *configChainPath, *configWalletsPath)
+			cli.setConfig(*configIp, *configPort, *configChainPath, *configWalletsPath, *configNetwork, *configSigners)
 		}
 	}
 	if !config.Exists() {
@@ -110,6 +135,13 @@ func (cli *CLI) Run() {
 		}
 		checkError(cli.getBalance(*getBalanceAddress, cfg))
 	}
+	if bumpFeeCmd.Parsed() {
+		if *bumpFeeTxID == "" {
+			bumpFeeCmd.Usage()
+			os.Exit(1)
+		}
+		checkError(cli.bumpFee(*bumpFeeTxID, *bumpFeeFee, cfg))
+	}
 	if createBlockChainCmd.Parsed() {
 		if *createBlockChainAddress == "" {
 			createBlockChainCmd.Usage()
@@ -120,23 +152,36 @@ func (cli *CLI) Run() {
 	if createWalletCmd.Parsed() {
 		cli.createWallet(cfg)
 	}
+	if estimateFeeCmd.Parsed() {
+		checkError(cli.estimateFee(*estimateFeeBlocks, cfg))
+	}
 	if listAddressesCmd.Parsed() {
 		checkError(cli.listAddresses(cfg))
 	}
+	if mineCmd.Parsed() {
+		if *mineNode == "" {
+			mineCmd.Usage()
+			os.Exit(1)
+		}
+		checkError(cli.mine(*mineNode, *mineThreads))
+	}
 	if printChainCmd.Parsed() {
 		checkError(cli.printChain(cfg))
 	}
 	if reindexUTXOCmd.Parsed() {
-		cli.reindexUTXO(cfg)
+		checkError(cli.reindexUTXO(cfg))
+	}
+	if reindexTxCmd.Parsed() {
+		checkError(cli.reindexTx(cfg))
 	}
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount == "" {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
-		checkError(cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, cfg))
+		checkError(cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, *sendReplaceable, cfg))
 	}
 	if startNodeCmd.Parsed() {
-		checkError(cli.startNode(*startNodeMiner))
+		checkError(cli.startNode(*startNodeMiner, *startNodeThreads, *startNodeStratum))
 	}
 }
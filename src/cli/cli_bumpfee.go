@@ -0,0 +1,90 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/config"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+)
+
+func (cli *CLI) bumpFee(txID, feeStr string, cfg config.Config) error {
+	bc, err := core.NewBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer bc.CloseDB(false)
+	fee, err := parseFeePerByte(bc, feeStr)
+	if err != nil {
+		return err
+	}
+	wallets, err := wallet.NewWallets(cfg)
+	if err != nil {
+		return err
+	}
+	data, err := wallets.GetPendingTx(txID)
+	if err != nil {
+		return err
+	}
+	original, err := types.DeserializeTransaction(data)
+	if err != nil {
+		return err
+	}
+
+	// Payments which are confirmed or replaced by others can not be bumped anymore.
+	utxoSet := core.UTXOSet{BlockChain: bc}
+	_, err = bc.CheckTransactionInputs(original)
+	if core.IsRuleError(err, core.ErrMissingInput) {
+		wallets.RemovePendingTx(txID)
+		wallets.SaveToFile(cfg)
+		return errors.New(fmt.Sprintf("ERROR: Transaction %s is confirmed or replaced", txID))
+	}
+	if err != nil {
+		return err
+	}
+	senderWallet, err := findSenderWallet(bc, wallets, original)
+	if err != nil {
+		return err
+	}
+	tx, err := core.BumpFee(&senderWallet, original, fee, &utxoSet)
+	if err != nil {
+		return err
+	}
+	wallets.RemovePendingTx(txID)
+	wallets.AddPendingTx(hex.EncodeToString(tx.Hash), tx.Serialize())
+	wallets.SaveToFile(cfg)
+	return broadcastTx(bc, tx)
+}
+
+// findSenderWallet returns the wallet which owns outputs spent by the transaction.
+func findSenderWallet(bc core.BlockChain, wallets *wallet.Wallets, tx types.Transaction) (wallet.Wallet, error) {
+	prevTx, err := bc.FindTransaction(tx.VIn[0].PreviousTx)
+	if err != nil {
+		return wallet.Wallet{}, err
+	}
+	out := prevTx.VOut[tx.VIn[0].VOut]
+	for _, w := range wallets.Wallets {
+		if out.IsLockedWithKey(wallet.HashPubKey(w.PublicKey)) {
+			return *w, nil
+		}
+	}
+	return wallet.Wallet{}, errors.New(fmt.Sprintf("ERROR: Sender of transaction %x is not found in the wallet file", tx.Hash))
+}
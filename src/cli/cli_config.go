@@ -15,9 +15,15 @@
 
 package cli
 
-import "github.com/YuriyLisovskiy/blockchain-go/src/config"
+import (
+	"encoding/hex"
+	"strings"
 
-func (cli *CLI) setConfig(ip string, port int, chainPath, walletsPath string) error {
+	"github.com/YuriyLisovskiy/blockchain-go/src/config"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+)
+
+func (cli *CLI) setConfig(ip string, port int, chainPath, walletsPath, network, signers string) error {
 	cfg := config.Config{}
 	var err error
 	if config.Exists() {
@@ -38,6 +44,20 @@ func (cli *CLI) setConfig(ip string, port int, chainPath, walletsPath string) er
 	if walletsPath != "" {
 		cfg = cfg.SetWalletsPath(walletsPath)
 	}
+	if network != "" {
+		if _, err := params.Get(network); err != nil {
+			return err
+		}
+		cfg = cfg.SetNetwork(network)
+	}
+	if signers != "" {
+		for _, signer := range strings.Split(signers, ",") {
+			if _, err := hex.DecodeString(signer); err != nil {
+				return err
+			}
+		}
+		cfg = cfg.SetSigners(strings.Split(signers, ","))
+	}
 	return cfg.Save()
 }
 
@@ -28,10 +28,16 @@ func (cli *CLI) createBlockChain(address string, cfg config.Config) error {
 	if !wallet.ValidateAddress(address) {
 		return errors.New(fmt.Sprintf("ERROR: Address '%s' is not valid", address))
 	}
-	bc := core.CreateBlockChain(address, cfg)
+	bc, err := core.CreateBlockChain(address, cfg)
+	if err != nil {
+		return err
+	}
+	defer bc.CloseDB(false)
 	UTXOSet := core.UTXOSet{BlockChain: bc}
-	UTXOSet.Reindex()
-	bc.CloseDB(true)
+	err = UTXOSet.Reindex()
+	if err != nil {
+		return err
+	}
 	fmt.Println("Done!")
 	return nil
 }
@@ -0,0 +1,54 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/config"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/fees"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+func (cli *CLI) estimateFee(blocks int, cfg config.Config) error {
+	bc, err := core.NewBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer bc.CloseDB(false)
+	feePerByte, err := estimateFeePerByte(bc, blocks)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Fee per byte to confirm within %d blocks: %s\n", blocks, feePerByte)
+	return nil
+}
+
+// estimateFeePerByte returns the fee rate estimated by the node's fee estimator,
+// the minimum relay fee rate is returned if the estimator has not enough data.
+func estimateFeePerByte(bc core.BlockChain, blocks int) (amount.Amount, error) {
+	estimator, err := bc.LoadFeeEstimator()
+	if err != nil {
+		return 0, err
+	}
+	feePerByte, err := estimator.EstimateFee(blocks)
+	if err == fees.ErrInsufficientData {
+		return vars.MIN_FEE_PER_BYTE, nil
+	}
+	return feePerByte, err
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
 	"github.com/YuriyLisovskiy/blockchain-go/src/config"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
 	"github.com/YuriyLisovskiy/blockchain-go/src/encoding/base58"
 )
 
@@ -29,16 +30,22 @@ func (cli *CLI) getBalance(address string, cfg config.Config) error {
 	if !wallet.ValidateAddress(address) {
 		return errors.New(fmt.Sprintf("ERROR: Address '%s' is not valid", address))
 	}
-	bc := core.NewBlockChain(cfg)
+	bc, err := core.NewBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer bc.CloseDB(false)
 	UTXOSet := core.UTXOSet{BlockChain: bc}
-	balance := 0.0
+	balance := amount.Amount(0)
 	pubKeyHash := base58.Decode([]byte(address))
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
+	UTXOs, err := UTXOSet.FindUTXO(pubKeyHash)
+	if err != nil {
+		return err
+	}
 	for _, out := range UTXOs {
 		balance += out.Value
 	}
-	bc.CloseDB(true)
-	fmt.Printf("Balance of '%s': %.6f\n", address, balance)
+	fmt.Printf("Balance of '%s': %s\n", address, balance)
 	return nil
 }
@@ -0,0 +1,46 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/stratum"
+)
+
+// HASH_RATE_INTERVAL is how often the miner prints its hash rate.
+const HASH_RATE_INTERVAL = time.Minute
+
+// mine does proof of work for the node serving jobs on given address
+// until the connection to it fails.
+func (cli *CLI) mine(nodeAddress string, threads int) error {
+	client, err := stratum.Dial(nodeAddress)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	fmt.Println("Mining for the node", nodeAddress)
+	stats := core.NewMiningStats()
+	go func() {
+		for range time.Tick(HASH_RATE_INTERVAL) {
+			fmt.Printf("Hash rate: %.2f H/s\n", stats.HashRate())
+		}
+	}()
+	return client.Mine(context.Background(), threads, stats)
+}
@@ -23,10 +23,20 @@ import (
 )
 
 func (cli *CLI) printChain(cfg config.Config) error {
-	bc := core.NewBlockChain(cfg)
-	bci := bc.Iterator()
+	bc, err := core.NewBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer bc.CloseDB(false)
+	bci, err := bc.Iterator()
+	if err != nil {
+		return err
+	}
 	for !bci.End() {
-		block := bci.Next()
+		block, err := bci.Next()
+		if err != nil {
+			return err
+		}
 //		data, err := json.MarshalIndent(block, "", "  ")
 //		if err != nil {
 //			return err
@@ -34,7 +44,8 @@ func (cli *CLI) printChain(cfg config.Config) error {
 //		fmt.Println(string(data))
 		fmt.Printf("\nBlock HASH: %x\n", block.Hash)
 		fmt.Printf("Prev Block HASH: %x\n", block.PrevBlockHash)
+		fmt.Printf("Merkle Root: %x\n", block.MerkleRoot)
+		fmt.Printf("Height: %d, Version: %d, Bits: %08x, Nonce: %d\n", block.Height, block.Version, block.Bits, block.Nonce)
 	}
-	bc.CloseDB(true)
 	return nil
 }
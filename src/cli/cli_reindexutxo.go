@@ -22,10 +22,21 @@ import (
 	"github.com/YuriyLisovskiy/blockchain-go/src/core"
 )
 
-func (cli *CLI) reindexUTXO(cfg config.Config) {
-	chain := core.NewBlockChain(cfg)
+func (cli *CLI) reindexUTXO(cfg config.Config) error {
+	chain, err := core.NewBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer chain.CloseDB(false)
 	UTXOSet := core.UTXOSet{BlockChain: chain}
-	UTXOSet.Reindex()
-	count := UTXOSet.CountTransactions()
+	err = UTXOSet.Reindex()
+	if err != nil {
+		return err
+	}
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+	return nil
 }
@@ -16,6 +16,7 @@
 package cli
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,18 +24,38 @@ import (
 	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
 	"github.com/YuriyLisovskiy/blockchain-go/src/config"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/fees"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/protocol"
 	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/static"
 )
 
-func (cli *CLI) send(from, to string, amount, fee float64, cfg config.Config) error {
+func (cli *CLI) send(from, to, amountStr, feeStr string, replaceable bool, cfg config.Config) error {
 	if !wallet.ValidateAddress(from) {
 		return errors.New("ERROR: Sender address is not valid")
 	}
 	if !wallet.ValidateAddress(to) {
 		return errors.New("ERROR: Recipient address is not valid")
 	}
-	bc := core.NewBlockChain(cfg)
+	value, err := amount.Parse(amountStr)
+	if err != nil {
+		return err
+	}
+	if value <= 0 || !value.InRange() {
+		return errors.New(fmt.Sprintf("ERROR: Amount '%s' is out of range", amountStr))
+	}
+	bc, err := core.NewBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer bc.CloseDB(false)
+
+	fee, err := parseFeePerByte(bc, feeStr)
+	if err != nil {
+		return err
+	}
 	utxoSet := core.UTXOSet{BlockChain: bc}
 	wallets, err := wallet.NewWallets(cfg)
 	if err != nil {
@@ -44,13 +65,51 @@ func (cli *CLI) send(from, to string, amount, fee float64, cfg config.Config) er
 	if err != nil {
 		return err
 	}
-	tx := core.NewUTXOTransaction(&senderWallet, to, amount, fee, &utxoSet)
+	tx, err := core.NewUTXOTransaction(&senderWallet, to, value, fee, replaceable, &utxoSet)
+	if err != nil {
+		return err
+	}
 
 //	newBlock := bc.MineBlock(from, []*blockchain.Transaction{tx})
 //	UTXOSet.Update(newBlock)
 
-	fmt.Printf("\n\nTX VERIFIED: %t\n\n", utxoSet.BlockChain.VerifyTransaction(tx))
+	err = utxoSet.BlockChain.VerifyTransaction(tx)
+	if err != nil {
+		return err
+	}
+
+	// Replaceable payments are kept until their fees can not be bumped anymore.
+	if replaceable {
+		wallets.AddPendingTx(hex.EncodeToString(tx.Hash), tx.Serialize())
+		wallets.SaveToFile(cfg)
+	}
+	return broadcastTx(bc, tx)
+}
+
+// parseFeePerByte parses the fee rate chosen by the user,
+// the rate is estimated if the user does not choose it.
+func parseFeePerByte(bc core.BlockChain, feeStr string) (amount.Amount, error) {
+	var fee amount.Amount
+	var err error
+	if feeStr == "" {
+		fee, err = estimateFeePerByte(bc, fees.DEFAULT_CONFIRM_TARGET)
+	} else {
+		fee, err = amount.Parse(feeStr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !fee.InRange() {
+		return 0, errors.New(fmt.Sprintf("ERROR: Fee '%s' is out of range", feeStr))
+	}
+	if fee < vars.MIN_FEE_PER_BYTE {
+		return 0, errors.New(fmt.Sprintf("ERROR: Fee '%s' is below the minimum relay fee %s", feeStr, vars.MIN_FEE_PER_BYTE))
+	}
+	return fee, nil
+}
 
+// broadcastTx prints the transaction and sends it to known nodes.
+func broadcastTx(bc core.BlockChain, tx types.Transaction) error {
 	data, err := json.MarshalIndent(tx, "", "  ")
 	if err != nil {
 		return err
@@ -68,7 +127,6 @@ func (cli *CLI) send(from, to string, amount, fee float64, cfg config.Config) er
 			proto.SendTx(static.SelfNodeAddress, nodeAddr, tx)
 		}
 	}
-	bc.CloseDB(true)
 	fmt.Println("Success!")
 	return nil
 }
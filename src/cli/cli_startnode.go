@@ -24,7 +24,7 @@ import (
 	"github.com/YuriyLisovskiy/blockchain-go/src/p2p"
 )
 
-func (cli *CLI) startNode(minerAddress string) error {
+func (cli *CLI) startNode(minerAddress string, miningThreads int, stratumAddress string) error {
 	if !config.Exists() {
 		return ErrConfigNotFound
 	}
@@ -39,8 +39,12 @@ func (cli *CLI) startNode(minerAddress string) error {
 		} else {
 			return errors.New(fmt.Sprintf("wrong miner address %s", minerAddress))
 		}
+		if len(stratumAddress) > 0 {
+			fmt.Println("Serving mining jobs on", stratumAddress)
+		}
+	} else if len(stratumAddress) > 0 {
+		return errors.New("stratum server requires the miner address")
 	}
 	server := p2p.Server{}
-	server.Start(cfg, minerAddress)
-	return nil
+	return server.Start(cfg, minerAddress, miningThreads, stratumAddress)
 }
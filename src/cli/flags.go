@@ -19,12 +19,16 @@ import "flag"
 
 var (
 	getBalanceCmd       = flag.NewFlagSet("balance", flag.ExitOnError)
+	bumpFeeCmd          = flag.NewFlagSet("bumpfee", flag.ExitOnError)
 	configCmd           = flag.NewFlagSet("config", flag.ExitOnError)
 	createBlockChainCmd = flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	createWalletCmd     = flag.NewFlagSet("createwallet", flag.ExitOnError)
+	estimateFeeCmd      = flag.NewFlagSet("estimatefee", flag.ExitOnError)
 	listAddressesCmd    = flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	mineCmd             = flag.NewFlagSet("mine", flag.ExitOnError)
 	printChainCmd       = flag.NewFlagSet("printchain", flag.ExitOnError)
 	reindexUTXOCmd      = flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	reindexTxCmd        = flag.NewFlagSet("reindextx", flag.ExitOnError)
 	sendCmd             = flag.NewFlagSet("send", flag.ExitOnError)
 	startNodeCmd        = flag.NewFlagSet("startnode", flag.ExitOnError)
 )
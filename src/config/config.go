@@ -40,6 +40,13 @@ type Config struct {
 	Port        int    `json:"port"`
 	ChainPath   string `json:"chain_path"`
 	WalletsPath string `json:"wallets_path"`
+
+	// Network is the name of the network to run on: "main", "test", "regtest" or "poa".
+	Network string `json:"network"`
+
+	// Signers holds hex encoded public keys of nodes which seal blocks
+	// of a proof of authority network.
+	Signers []string `json:"signers,omitempty"`
 }
 
 // Default returns default node configuration.
@@ -69,6 +76,7 @@ func Default() (Config, error) {
 	cfg.Port = 8000
 	cfg.ChainPath = absPath + "/data/" + fmt.Sprintf(utils.DBFile, cfg.Port)
 	cfg.WalletsPath = absPath + "/data/" + fmt.Sprintf(utils.WalletFile, cfg.Port)
+	cfg.Network = "main"
 
 	return cfg, nil
 }
@@ -103,6 +111,18 @@ func (cfg Config) SetWalletsPath(path string) Config {
 	return cfg
 }
 
+// SetNetwork sets a name of the network to run on.
+func (cfg Config) SetNetwork(network string) Config {
+	cfg.Network = network
+	return cfg
+}
+
+// SetSigners sets public keys of signers of a proof of authority network.
+func (cfg Config) SetSigners(signers []string) Config {
+	cfg.Signers = signers
+	return cfg
+}
+
 // Exists checks if configuration file exists on disk.
 func Exists() bool {
 	_, err := os.Stat(configLocation)
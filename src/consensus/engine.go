@@ -0,0 +1,43 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package consensus
+
+import (
+	"context"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+)
+
+// HeaderGetter retrieves a block header by block hash.
+type HeaderGetter func(hash []byte) (types.BlockHeader, error)
+
+// Engine decides which blocks may extend the chain: it seals new blocks
+// and verifies seals of blocks created by other nodes. Implementations
+// are safe for concurrent use.
+type Engine interface {
+	// CalcNextBits returns bits which a block built on top of given parent must have.
+	CalcNextBits(parent types.BlockHeader, getHeader HeaderGetter) (uint32, error)
+
+	// Seal completes the header of given block, so the block is accepted by
+	// VerifySeal, and sets the block's hash. The header must be linked to the
+	// chain and commit to the block's transactions. Sealing stops with the
+	// context's error when the context is done.
+	Seal(ctx context.Context, block types.Block, getHeader HeaderGetter) (types.Block, error)
+
+	// VerifySeal checks that the block is sealed by the rules of the engine
+	// and that its hash is the hash of its header.
+	VerifySeal(block types.Block) error
+}
@@ -15,7 +15,33 @@
 
 package consensus
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+)
+
+const (
+	// MERKLE_HASH_SIZE is the number of bytes of hashes of merkle tree nodes.
+	MERKLE_HASH_SIZE = sha256.Size
+
+	// MAX_MERKLE_PROOF_DEPTH limits the number of hashes of a proof,
+	// so the index of a leaf fits in 32 bits.
+	MAX_MERKLE_PROOF_DEPTH = 32
+
+	// Leaves and inner nodes are hashed with different prefixes, so 64 bytes
+	// of two child hashes can not be passed off as the data of a leaf.
+	MERKLE_LEAF_PREFIX = 0x00
+	MERKLE_NODE_PREFIX = 0x01
+)
+
+var (
+	ErrLeafIndexOutOfRange = errors.New("merkle leaf index is out of range")
+	ErrInvalidMerkleProof  = errors.New("invalid merkle proof encoding")
+)
 
 type MerkleNode struct {
 	Left  *MerkleNode
@@ -23,33 +49,208 @@ type MerkleNode struct {
 	Data  []byte
 }
 
-func ComputeMerkleRoot(data [][]byte) []byte {
-	var nodes []MerkleNode
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
-	}
+// MerkleTree is a binary tree of hashes whose leaves are hashes of data, see
+// MerkleLeaf. A level with an odd number of nodes is padded by duplicating its
+// last node, so a single leaf is paired with itself too. Padding makes trees
+// of the same leaves with and without the duplicated ones have the same root,
+// so the number of leaves must be known to the verifier of a proof.
+type MerkleTree struct {
+	// levels[0] holds padded leaves, every next level holds parents of nodes
+	// of the previous one and the last level holds the root only.
+	levels [][]*MerkleNode
+	size   int
+}
+
+// NewMerkleTree builds the merkle tree of given data.
+func NewMerkleTree(data [][]byte) *MerkleTree {
+	var leaves [][]byte
 	for _, datum := range data {
-		node := newMerkleNode(nil, nil, datum)
-		nodes = append(nodes, *node)
-	}
-	for i := 0; i < len(data)/2; i++ {
-		var newLevel []MerkleNode
-		for j := 0; j < len(nodes); j += 2 {
-			node := newMerkleNode(&nodes[j], &nodes[j+1], nil)
-			newLevel = append(newLevel, *node)
+		leaves = append(leaves, MerkleLeaf(datum))
+	}
+	return NewMerkleTreeFromLeaves(leaves)
+}
+
+// NewMerkleTreeFromLeaves builds the merkle tree of leaves created by
+// MerkleLeaf, so the tree can be built by parties which know only hashes
+// of the data, e.g. by miners.
+func NewMerkleTreeFromLeaves(leaves [][]byte) *MerkleTree {
+	tree := &MerkleTree{size: len(leaves)}
+	if len(leaves) == 0 {
+		return tree
+	}
+	var level []*MerkleNode
+	for _, leaf := range leaves {
+		level = append(level, &MerkleNode{Data: leaf})
+	}
+	for {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		tree.levels = append(tree.levels, level)
+		var parents []*MerkleNode
+		for j := 0; j < len(level); j += 2 {
+			parents = append(parents, newMerkleNode(level[j], level[j+1], nil))
+		}
+		level = parents
+		if len(level) == 1 {
+			break
 		}
-		nodes = newLevel
 	}
-	return nodes[0].Data
+	tree.levels = append(tree.levels, level)
+	return tree
+}
+
+// Root returns the root hash of the tree, nil if the tree has no leaves.
+func (t *MerkleTree) Root() []byte {
+	if len(t.levels) == 0 {
+		return nil
+	}
+	return t.levels[len(t.levels)-1][0].Data
+}
+
+// Size returns the number of leaves of the tree without padding.
+func (t *MerkleTree) Size() int {
+	return t.size
+}
+
+// Proof returns the proof that the leaf at given index is included in the tree.
+func (t *MerkleTree) Proof(index int) (MerkleProof, error) {
+	if index < 0 || index >= t.size {
+		return MerkleProof{}, ErrLeafIndexOutOfRange
+	}
+	proof := MerkleProof{Index: index, Size: t.size}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		proof.Hashes = append(proof.Hashes, level[index^1].Data)
+		index >>= 1
+	}
+	return proof, nil
+}
+
+// MerkleProof proves that a leaf is included in a merkle tree. Hashes holds
+// siblings of nodes on the path from the leaf to the root, bits of Index tell
+// on which side of the path each sibling is, starting from the lowest bit.
+// Size is the number of leaves of the tree, the root does not commit to it,
+// so it must be checked against a trusted one, e.g. the number of block's
+// transactions.
+type MerkleProof struct {
+	Index  int
+	Size   int
+	Hashes [][]byte
+}
+
+// Verify checks that given data is the leaf at the proof's index
+// of the merkle tree with given root.
+func (p MerkleProof) Verify(data, root []byte) bool {
+	return p.VerifyLeaf(MerkleLeaf(data), root)
+}
+
+// VerifyLeaf checks that given leaf created by MerkleLeaf is at the proof's
+// index of the merkle tree of the proof's size with given root. Indices of
+// leaves which pad the tree are not valid.
+func (p MerkleProof) VerifyLeaf(leaf, root []byte) bool {
+	if p.Index < 0 || p.Index >= p.Size || len(p.Hashes) != merkleDepth(p.Size) {
+		return false
+	}
+	node := &MerkleNode{Data: leaf}
+	for i, hash := range p.Hashes {
+		sibling := &MerkleNode{Data: hash}
+		if p.Index>>uint(i)&1 == 0 {
+			node = newMerkleNode(node, sibling, nil)
+		} else {
+			node = newMerkleNode(sibling, node, nil)
+		}
+	}
+	return bytes.Equal(node.Data, root)
+}
+
+// Serialize encodes the proof as 4 bytes of the index, 4 bytes of the size,
+// 1 byte of the number of hashes and MERKLE_HASH_SIZE bytes of each hash.
+func (p MerkleProof) Serialize() []byte {
+	data := make([]byte, 9, 9+len(p.Hashes)*MERKLE_HASH_SIZE)
+	binary.BigEndian.PutUint32(data, uint32(p.Index))
+	binary.BigEndian.PutUint32(data[4:], uint32(p.Size))
+	data[8] = byte(len(p.Hashes))
+	for _, hash := range p.Hashes {
+		data = append(data, hash...)
+	}
+	return data
+}
+
+// DeserializeMerkleProof decodes a proof encoded by MerkleProof.Serialize.
+func DeserializeMerkleProof(data []byte) (MerkleProof, error) {
+	if len(data) < 9 {
+		return MerkleProof{}, ErrInvalidMerkleProof
+	}
+	count := int(data[8])
+	if count > MAX_MERKLE_PROOF_DEPTH || len(data) != 9+count*MERKLE_HASH_SIZE {
+		return MerkleProof{}, ErrInvalidMerkleProof
+	}
+	proof := MerkleProof{
+		Index: int(binary.BigEndian.Uint32(data)),
+		Size:  int(binary.BigEndian.Uint32(data[4:])),
+	}
+	for i := 0; i < count; i++ {
+		offset := 9 + i*MERKLE_HASH_SIZE
+		proof.Hashes = append(proof.Hashes, append([]byte{}, data[offset:offset+MERKLE_HASH_SIZE]...))
+	}
+	return proof, nil
+}
+
+// ComputeMerkleRoot returns the root hash of the merkle tree of given data.
+func ComputeMerkleRoot(data [][]byte) []byte {
+	return NewMerkleTree(data).Root()
+}
+
+// HashTransactions returns the merkle root of serialized transactions
+// which a block header commits to.
+func HashTransactions(transactions []types.Transaction) []byte {
+	return newTransactionTree(transactions).Root()
+}
+
+// TransactionProof returns the proof that the transaction at given index is
+// committed to by the merkle root of transactions, it is verified against
+// the root with the serialized transaction, see MerkleProof.Verify.
+func TransactionProof(transactions []types.Transaction, index int) (MerkleProof, error) {
+	return newTransactionTree(transactions).Proof(index)
+}
+
+func newTransactionTree(transactions []types.Transaction) *MerkleTree {
+	var data [][]byte
+	for _, tx := range transactions {
+		data = append(data, tx.Serialize())
+	}
+	return NewMerkleTree(data)
+}
+
+// MerkleLeaf returns the hash of given data as a leaf of the merkle tree.
+func MerkleLeaf(data []byte) []byte {
+	return newMerkleNode(nil, nil, data).Data
+}
+
+// ComputeMerkleRootFromLeaves returns the merkle root of leaves created by
+// MerkleLeaf, so the root can be computed by parties which know only hashes
+// of the data, e.g. by miners.
+func ComputeMerkleRootFromLeaves(leaves [][]byte) []byte {
+	return NewMerkleTreeFromLeaves(leaves).Root()
+}
+
+// merkleDepth returns the number of levels above the leaves
+// of the tree with given number of leaves.
+func merkleDepth(size int) int {
+	depth := 0
+	for width := size; width > 1 || depth == 0; width = (width + 1) / 2 {
+		depth++
+	}
+	return depth
 }
 
 func newMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	mNode := MerkleNode{}
 	if left == nil && right == nil {
-		hash := sha256.Sum256(data)
+		hash := sha256.Sum256(append([]byte{MERKLE_LEAF_PREFIX}, data...))
 		mNode.Data = hash[:]
 	} else {
-		prevHashes := append(left.Data, right.Data...)
+		prevHashes := append(append([]byte{MERKLE_NODE_PREFIX}, left.Data...), right.Data...)
 		hash := sha256.Sum256(prevHashes)
 		mNode.Data = hash[:]
 	}
@@ -57,4 +258,3 @@ func newMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	mNode.Right = right
 	return &mNode
 }
-
@@ -16,6 +16,7 @@
 package consensus
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"testing"
@@ -41,13 +42,13 @@ func TestNewMerkleNode(test *testing.T) {
 	// Level 3
 	n7 := newMerkleNode(n5, n6, nil)
 
-	if "64b04b718d8b7c5b6fd17f7ec221945c034cfce3be4118da33244966150c4bd4" != hex.EncodeToString(n5.Data) {
+	if "3cbea6c40e91c3bf19801606c56b3ed61d46707b12f98d007638a2e71bafeab3" != hex.EncodeToString(n5.Data) {
 		test.Error("Level 1 hash 1 is incorrect")
 	}
-	if "08bd0d1426f87a78bfc2f0b13eccdf6f5b58dac6b37a7b9441c1a2fab415d76c" != hex.EncodeToString(n6.Data) {
+	if "4339266e7296a485ce1cc97a6194eae7817da4753d9d6c6b4174fbff5104b0c1" != hex.EncodeToString(n6.Data) {
 		test.Error("Level 1 hash 2 is incorrect")
 	}
-	if "4e3e44e55926330ab6c31892f980f8bfd1a6e910ff1ebc3f778211377f35227e" != hex.EncodeToString(n7.Data) {
+	if "031821f82b630c276d9037c9af1c5b74a271a41bc04679ae0af6b8bb1b0f46d3" != hex.EncodeToString(n7.Data) {
 		test.Error("Root hash is incorrect")
 	}
 }
@@ -78,3 +79,137 @@ func TestNewMerkleTree(test *testing.T) {
 		test.Error("Merkle tree root hash is incorrect")
 	}
 }
+
+func TestComputeMerkleRootFromLeaves(test *testing.T) {
+	data := [][]byte{
+		[]byte("node1"),
+		[]byte("node2"),
+		[]byte("node3"),
+	}
+	var leaves [][]byte
+	for _, datum := range data {
+		leaves = append(leaves, MerkleLeaf(datum))
+	}
+	expected := ComputeMerkleRoot(data)
+	if actual := ComputeMerkleRootFromLeaves(leaves); !bytes.Equal(actual, expected) {
+		test.Errorf("invalid merkle root:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+}
+
+func TestComputeMerkleRoot_OddLevels(test *testing.T) {
+	var data [][]byte
+	var leaves []*MerkleNode
+	for i := 0; i < 5; i++ {
+		data = append(data, []byte(fmt.Sprintf("node%d", i)))
+		leaves = append(leaves, newMerkleNode(nil, nil, data[i]))
+	}
+
+	// Odd levels are padded by their last nodes: 5 leaves -> 6, 3 nodes -> 4.
+	n01 := newMerkleNode(leaves[0], leaves[1], nil)
+	n23 := newMerkleNode(leaves[2], leaves[3], nil)
+	n44 := newMerkleNode(leaves[4], leaves[4], nil)
+	n0123 := newMerkleNode(n01, n23, nil)
+	n4444 := newMerkleNode(n44, n44, nil)
+	expected := newMerkleNode(n0123, n4444, nil).Data
+	if actual := ComputeMerkleRoot(data); !bytes.Equal(actual, expected) {
+		test.Errorf("invalid merkle root:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+
+	// A single leaf is paired with itself.
+	expected = newMerkleNode(leaves[0], leaves[0], nil).Data
+	if actual := ComputeMerkleRoot(data[:1]); !bytes.Equal(actual, expected) {
+		test.Errorf("invalid merkle root:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+}
+
+func TestMerkleTree_Proof(test *testing.T) {
+	var data [][]byte
+	for size := 1; size <= 17; size++ {
+		data = append(data, []byte(fmt.Sprintf("node%d", size)))
+		tree := NewMerkleTree(data)
+		root := ComputeMerkleRoot(data)
+		if !bytes.Equal(tree.Root(), root) {
+			test.Errorf("consensus.TestMerkleTree_Proof[%d]: invalid root:\nactual:\n%x\nexpected:\n%x", size, tree.Root(), root)
+		}
+		for i := range data {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				test.Fatal(err)
+			}
+			if !proof.Verify(data[i], root) {
+				test.Errorf("consensus.TestMerkleTree_Proof[%d]: proof of leaf %d is not verified", size, i)
+			}
+			if proof.Verify([]byte("other"), root) {
+				test.Errorf("consensus.TestMerkleTree_Proof[%d]: proof of leaf %d verifies other data", size, i)
+			}
+			proof.Index ^= 1
+			if i^1 < size && proof.Verify(data[i], root) {
+				test.Errorf("consensus.TestMerkleTree_Proof[%d]: proof of leaf %d verifies other index", size, i)
+			}
+		}
+		if _, err := tree.Proof(size); err != ErrLeafIndexOutOfRange {
+			test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrLeafIndexOutOfRange)
+		}
+	}
+	if root := NewMerkleTree(nil).Root(); root != nil {
+		test.Errorf("invalid root of empty tree:\nactual:\n%x\nexpected:\nnil", root)
+	}
+}
+
+func TestMerkleProof_InnerNodeForgery(test *testing.T) {
+	data := [][]byte{[]byte("node1"), []byte("node2"), []byte("node3"), []byte("node4")}
+	tree := NewMerkleTree(data)
+
+	// Hashes of two children are 64 bytes which could be given as the data of
+	// a leaf of the tree with the children's level removed.
+	children := tree.levels[0]
+	forged := append(append([]byte{}, children[0].Data...), children[1].Data...)
+	proof := MerkleProof{Index: 0, Size: 2, Hashes: [][]byte{tree.levels[1][1].Data}}
+	if proof.Verify(forged, tree.Root()) {
+		test.Error("proof verifies the hashes of an inner node's children as a leaf")
+	}
+}
+
+func TestMerkleProof_PaddingForgery(test *testing.T) {
+	data := [][]byte{[]byte("node1"), []byte("node2"), []byte("node3")}
+	tree := NewMerkleTree(data)
+	proof, err := tree.Proof(2)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The last leaf is duplicated to pad the tree, its copy must not be proven.
+	proof.Index = 3
+	if proof.Verify(data[2], tree.Root()) {
+		test.Error("proof verifies the leaf at the padding index")
+	}
+	proof.Index = 2
+	proof.Hashes = append(proof.Hashes, tree.Root())
+	if proof.Verify(data[2], tree.Root()) {
+		test.Error("proof with extra hashes is verified")
+	}
+}
+
+func TestMerkleProof_Serialize(test *testing.T) {
+	data := [][]byte{[]byte("node1"), []byte("node2"), []byte("node3"), []byte("node4"), []byte("node5")}
+	proof, err := NewMerkleTree(data).Proof(4)
+	if err != nil {
+		test.Fatal(err)
+	}
+	serialized := proof.Serialize()
+	if expected := 9 + len(proof.Hashes)*MERKLE_HASH_SIZE; len(serialized) != expected {
+		test.Errorf("invalid size:\nactual:\n%d\nexpected:\n%d", len(serialized), expected)
+	}
+	actual, err := DeserializeMerkleProof(serialized)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !bytes.Equal(actual.Serialize(), serialized) || !actual.Verify(data[4], ComputeMerkleRoot(data)) {
+		test.Errorf("invalid proof:\nactual:\n%v\nexpected:\n%v", actual, proof)
+	}
+	for _, invalid := range [][]byte{nil, serialized[:8], serialized[:len(serialized)-1]} {
+		if _, err := DeserializeMerkleProof(invalid); err != ErrInvalidMerkleProof {
+			test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrInvalidMerkleProof)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package amount implements fixed-point amounts of coins stored as
+// integer numbers of the smallest currency units.
+package amount
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a number of the smallest currency units.
+type Amount int64
+
+const (
+	// DECIMALS is a number of digits after the decimal point of a coin.
+	DECIMALS = 6
+
+	// UNIT is the smallest currency unit.
+	UNIT Amount = 1
+
+	// COIN is a number of units in a single coin.
+	COIN Amount = 1000000
+
+	// MAX_AMOUNT is the greatest amount a single output or a sum of
+	// outputs may have, it is greater than all coins ever created.
+	MAX_AMOUNT = 84000000 * COIN
+)
+
+var (
+	ErrInvalidAmount  = errors.New("invalid amount")
+	ErrAmountOverflow = errors.New("amount overflow")
+)
+
+// InRange reports whether the amount is not negative and does not exceed MAX_AMOUNT.
+func (a Amount) InRange() bool {
+	return a >= 0 && a <= MAX_AMOUNT
+}
+
+// String formats the amount as a decimal number of coins without trailing zeros.
+func (a Amount) String() string {
+	sign := ""
+	units := uint64(a)
+	if a < 0 {
+		sign = "-"
+		units = uint64(-a)
+	}
+	coins := units / uint64(COIN)
+	fraction := units % uint64(COIN)
+	if fraction == 0 {
+		return fmt.Sprintf("%s%d", sign, coins)
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", DECIMALS, fraction), "0")
+	return fmt.Sprintf("%s%d.%s", sign, coins, digits)
+}
+
+// Parse converts a decimal number of coins to the amount. It fails if the number
+// has more than DECIMALS digits after the decimal point or does not fit Amount.
+func Parse(s string) (Amount, error) {
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if whole == "" && fraction == "" || len(fraction) > DECIMALS || !isDigits(whole) || !isDigits(fraction) {
+		return 0, ErrInvalidAmount
+	}
+	fraction += strings.Repeat("0", DECIMALS-len(fraction))
+	units, err := strconv.ParseUint(whole+fraction, 10, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, ErrAmountOverflow
+		}
+		return 0, err
+	}
+	if units > math.MaxInt64 {
+		return 0, ErrAmountOverflow
+	}
+	if negative {
+		return -Amount(units), nil
+	}
+	return Amount(units), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
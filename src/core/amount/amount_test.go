@@ -0,0 +1,92 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package amount
+
+import (
+	"math"
+	"testing"
+)
+
+var parseData = []struct {
+	input    string
+	expected Amount
+	err      error
+}{
+	{"0", 0, nil},
+	{"50", 50 * COIN, nil},
+	{"1.0567", 1056700, nil},
+	{"0.000001", UNIT, nil},
+	{".5", COIN / 2, nil},
+	{"3.", 3 * COIN, nil},
+	{"-2.25", -2250000, nil},
+	{"9223372036854.775807", math.MaxInt64, nil},
+	{"9223372036854.775808", 0, ErrAmountOverflow},
+	{"100000000000000000000", 0, ErrAmountOverflow},
+	{"0.0000001", 0, ErrInvalidAmount},
+	{"1e6", 0, ErrInvalidAmount},
+	{"+1", 0, ErrInvalidAmount},
+	{".", 0, ErrInvalidAmount},
+	{"", 0, ErrInvalidAmount},
+}
+
+func TestParse(test *testing.T) {
+	for _, data := range parseData {
+		actual, err := Parse(data.input)
+		if err != data.err {
+			test.Errorf("invalid error for '%s':\nactual:\n%v\nexpected:\n%v", data.input, err, data.err)
+		}
+		if actual != data.expected {
+			test.Errorf("invalid amount for '%s':\nactual:\n%d\nexpected:\n%d", data.input, actual, data.expected)
+		}
+	}
+}
+
+var stringData = []struct {
+	input    Amount
+	expected string
+}{
+	{0, "0"},
+	{50 * COIN, "50"},
+	{1056700, "1.0567"},
+	{UNIT, "0.000001"},
+	{-2250000, "-2.25"},
+	{math.MaxInt64, "9223372036854.775807"},
+	{math.MinInt64, "-9223372036854.775808"},
+}
+
+func TestAmount_String(test *testing.T) {
+	for _, data := range stringData {
+		if actual := data.input.String(); actual != data.expected {
+			test.Errorf("invalid string:\nactual:\n%s\nexpected:\n%s", actual, data.expected)
+		}
+	}
+}
+
+func TestAmount_InRange(test *testing.T) {
+	for _, data := range []struct {
+		input    Amount
+		expected bool
+	}{
+		{0, true},
+		{MAX_AMOUNT, true},
+		{MAX_AMOUNT + 1, false},
+		{-UNIT, false},
+	} {
+		if actual := data.input.InRange(); actual != data.expected {
+			test.Errorf("invalid range check of %d:\nactual:\n%v\nexpected:\n%v", data.input, actual, data.expected)
+		}
+	}
+}
@@ -17,15 +17,18 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"math/big"
 	"time"
 
 	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
 	"github.com/YuriyLisovskiy/blockchain-go/src/config"
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
@@ -33,133 +36,260 @@ import (
 	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
 
+// ChainListener is called when the best chain changes. Disconnected blocks
+// are the ones removed from the best chain, connected blocks are added to it.
+// Both lists are ordered from the fork point up to the tip.
+type ChainListener func(disconnected, connected []types.Block)
+
 type BlockChain struct {
-	tip []byte
-	db  *db_pkg.DB
+	tip      []byte
+	db       *db_pkg.DB
+	orphans  *orphanPool
+	params   *params.ChainParams
+	listener ChainListener
 }
 
-func CreateBlockChain(address string, cfg config.Config) BlockChain {
+func CreateBlockChain(address string, cfg config.Config) (BlockChain, error) {
 	utils.DBFile = cfg.ChainPath
 	if utils.DBExists(utils.DBFile) {
-		fmt.Printf("%s already exists.\n", utils.DBFile)
-		os.Exit(1)
+		return BlockChain{}, ErrChainExists
+	}
+	chainParams, err := chainParamsFromConfig(cfg)
+	if err != nil {
+		return BlockChain{}, err
 	}
-	cbTx := NewCoinBaseTX(address, 0)
-	genesis, err := NewGenesisBlock(cbTx)
+	cbTx := NewCoinBaseTX(address, CalcBlockSubsidy(0, chainParams), 0)
+	genesis, err := NewGenesisBlock(cbTx, chainParams)
 	if err != nil {
-		log.Panic(err)
+		return BlockChain{}, err
 	}
 	db, err := db_pkg.Open(utils.DBFile, 0600, nil)
 	if err != nil {
-		log.Panic(err)
+		return BlockChain{}, err
 	}
 	keys := [][]byte{
 		genesis.Hash,
 		utils.LAST_BLOCK_HASH,
+		utils.CHAIN_VERSION_KEY,
 	}
 	values := [][]byte{
-		genesis.Serialize(), // genesis.Hash
-		genesis.Hash,        // utils.LAST_BLOCK_HASH
+		genesis.Serialize(),           // genesis.Hash
+		genesis.Hash,                  // utils.LAST_BLOCK_HASH
+		[]byte{vars.CHAIN_DB_VERSION}, // utils.CHAIN_VERSION_KEY
 	}
 	err = db.PutArray(keys, values, utils.BLOCKS_BUCKET, false)
-
-	/*
-		err = db.Update(func(tx *db_pkg.Tx) error {
-			b, err := tx.CreateBucket([]byte(utils.BLOCKS_BUCKET))
-			if err != nil {
-				log.Panic(err)
-			}
-			err = b.Put(genesis.Hash, genesis.Serialize())
-			if err != nil {
-				log.Panic(err)
-			}
-			err = b.Put([]byte("l"), genesis.Hash)
-			if err != nil {
-				log.Panic(err)
-			}
-			return nil
-		})
-	*/
-
 	if err != nil {
-		log.Panic(err)
+		db.Close()
+		return BlockChain{}, err
 	}
-	return BlockChain{genesis.Hash, db}
+	err = db.Put(genesis.Hash, genesis.BlockHeader.Serialize(), utils.HEADERS_BUCKET, false)
+	if err != nil {
+		db.Close()
+		return BlockChain{}, err
+	}
+	err = db.Put(heightKey(genesis.Height), genesis.Hash, utils.HEIGHT_INDEX_BUCKET, false)
+	if err != nil {
+		db.Close()
+		return BlockChain{}, err
+	}
+	return BlockChain{genesis.Hash, db, newOrphanPool(), chainParams, nil}, nil
 }
 
-func NewBlockChain(cfg config.Config) BlockChain {
+func NewBlockChain(cfg config.Config) (BlockChain, error) {
 	utils.DBFile = cfg.ChainPath
 	if utils.DBExists(utils.DBFile) == false {
-		fmt.Println("No existing blockchain found. Create one first.")
-		os.Exit(1)
+		return BlockChain{}, ErrChainNotFound
+	}
+	chainParams, err := chainParamsFromConfig(cfg)
+	if err != nil {
+		return BlockChain{}, err
 	}
 	db, err := db_pkg.Open(cfg.ChainPath, 0600, nil)
 	if err != nil {
-		log.Panic(err)
+		return BlockChain{}, err
+	}
+	err = checkChainVersion(db)
+	if err != nil {
+		db.Close()
+		return BlockChain{}, err
 	}
 
 	tip, err := db.Get(utils.LAST_BLOCK_HASH, utils.BLOCKS_BUCKET)
+	if err == nil {
+		err = buildHeightIndex(db)
+	}
+	if err != nil {
+		db.Close()
+		return BlockChain{}, err
+	}
+	return BlockChain{tip, db, newOrphanPool(), chainParams, nil}, nil
+}
+
+// checkChainVersion returns ErrChainVersion if blocks and unspent outputs
+// of the database are encoded differently than this version encodes them,
+// e.g. if the database was created before the version was stored.
+func checkChainVersion(db *db_pkg.DB) error {
+	version, err := db.Get(utils.CHAIN_VERSION_KEY, utils.BLOCKS_BUCKET)
+	if err == db_pkg.ErrKeyNotFound {
+		return ErrChainVersion
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(version, []byte{vars.CHAIN_DB_VERSION}) {
+		return ErrChainVersion
+	}
+	return nil
+}
 
-	//	err = db.View(func(tx *db_pkg.Tx) error {
-	//		b := tx.Bucket([]byte(utils.BLOCKS_BUCKET))
-	//		tip = b.Get([]byte("l"))
-	//		return nil
-	//	})
+// chainParamsFromConfig returns parameters of the network the node is configured
+// to run on. Signers of a proof of authority network are set by the config.
+func chainParamsFromConfig(cfg config.Config) (*params.ChainParams, error) {
+	chainParams, err := params.Get(cfg.Network)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
+	}
+	if chainParams.Consensus != params.CONSENSUS_POA {
+		return chainParams, nil
 	}
-	return BlockChain{tip, db}
+	poaParams := *chainParams
+	poaParams.Signers = nil
+	for _, signer := range cfg.Signers {
+		publicKey, err := hex.DecodeString(signer)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid public key of signer %s: %s", signer, err.Error()))
+		}
+		poaParams.Signers = append(poaParams.Signers, publicKey)
+	}
+	return &poaParams, nil
 }
 
 // AddBlock writes given block to the database if it does not exist.
-func (bc *BlockChain) AddBlock(block types.Block) {
+//
+// The best chain is the one with the most accumulated work. If the block
+// extends a side branch which becomes heavier than the current best chain,
+// blocks of the current chain are disconnected down to the fork point and
+// blocks of the side branch are connected, UTXO set is updated accordingly.
+// If the block's parent is unknown, the block is kept as an orphan and
+// ErrOrphanBlock is returned, so the caller can request the missing parent.
+// Blocks which violate consensus rules are rejected with RuleError.
+// Changes of the best chain are reported to the listener, see SetListener.
+func (bc *BlockChain) AddBlock(block types.Block) error {
 
 	// Check if given block already exists in the database.
 	// If exists then returns from function, else performs adding new block logic.
 	blockInDb, err := bc.db.Get(block.Hash, utils.BLOCKS_BUCKET)
 	if blockInDb != nil {
-		return
+		return nil
 	}
 	if err != nil && err != db_pkg.ErrKeyNotFound {
-		log.Panic(err)
+		return err
+	}
+	err = CheckBlock(block, bc.params)
+	if err != nil {
+		return err
 	}
 
 	// Lock thread while changing database content.
+	var disconnected, connected []types.Block
 	vars.DBMutex.Lock()
-	err = bc.db.Batch(func(tx *db_pkg.Tx) error {
-		b := tx.Bucket(utils.BLOCKS_BUCKET)
-
-		// Write new block to the database
-		blockData := block.Serialize()
-		err := b.Put(block.Hash, blockData)
-		if err != nil {
-			log.Panic(err)
-		}
+	err = bc.db.Update(func(tx *db_pkg.Tx) error {
+		var err error
+		disconnected, connected, err = bc.addBlock(tx, block)
+		return err
+	})
+	vars.DBMutex.Unlock()
+	if err == ErrOrphanBlock && bc.orphans != nil {
+		bc.orphans.add(block)
+	}
+	if err != nil {
+		return err
+	}
+	if bc.listener != nil && len(connected) > 0 {
+		bc.listener(disconnected, connected)
+	}
 
-		// Check if given block is the newest one.
-		lastHash := b.Get(utils.LAST_BLOCK_HASH)
-		lastBlockData := b.Get(lastHash)
-		lastBlock := DeserializeBlock(lastBlockData)
-		if block.Height > lastBlock.Height {
-			err = b.Put(utils.LAST_BLOCK_HASH, block.Hash)
+	// Add orphans which were waiting for this block.
+	if bc.orphans != nil {
+		for _, orphan := range bc.orphans.take(block.Hash) {
+			err = bc.AddBlock(orphan)
 			if err != nil {
-				log.Panic(err)
+				utils.PrintLog(fmt.Sprintf("Orphan block %x is rejected: %s\n", orphan.Hash, err.Error()))
 			}
-			//	bc.tip = block.Hash
 		}
-		return nil
-	})
+	}
+	return nil
+}
+
+// addBlock stores the block and switches to the chain ending with it if that
+// chain is the best one, blocks disconnected and connected by the switch are
+// returned, see reorganize.
+func (bc *BlockChain) addBlock(tx *db_pkg.Tx, block types.Block) ([]types.Block, []types.Block, error) {
+	b := tx.Bucket(utils.BLOCKS_BUCKET)
+	if b == nil {
+		return nil, nil, errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+	}
+	if b.Get(block.Hash) != nil {
+		return nil, nil, nil
+	}
+	if len(block.PrevBlockHash) == 0 {
+		return nil, nil, errors.New(fmt.Sprintf("block %x is a genesis block of another chain", block.Hash))
+	}
+	err := bc.checkBlockContext(tx, block)
 	if err != nil {
-		log.Panic(err)
+		return nil, nil, err
 	}
-	vars.DBMutex.Unlock()
+
+	// Write new block to the database with total work of the chain it ends.
+	parentWork, err := getChainWork(tx, block.PrevBlockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	work := new(big.Int).Add(parentWork, blockWork(block.BlockHeader))
+	err = b.Put(block.Hash, block.Serialize())
+	if err != nil {
+		return nil, nil, err
+	}
+	err = putBlockHeader(tx, block)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = putChainWork(tx, block.Hash, work)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Switch to the chain ending with given block if it has more work than the best one.
+	tipWork, err := getChainWork(tx, b.Get(utils.LAST_BLOCK_HASH))
+	if err != nil {
+		return nil, nil, err
+	}
+	if work.Cmp(tipWork) <= 0 {
+		return nil, nil, nil
+	}
+	return bc.reorganize(tx, block)
+}
+
+// Params returns consensus parameters of the network the chain belongs to.
+func (bc *BlockChain) Params() *params.ChainParams {
+	return bc.params
+}
+
+// SetListener sets the function which is called by AddBlock when blocks
+// are connected to or disconnected from the best chain. It is called after
+// changes are written to the database and must be set before blocks are added.
+func (bc *BlockChain) SetListener(listener ChainListener) {
+	bc.listener = listener
 }
 
 // GetBestHeight returns the height of the last block.
-func (bc *BlockChain) GetBestHeight() int {
-	var lastBlock types.Block
+func (bc *BlockChain) GetBestHeight() (int, error) {
+	var lastHeader types.BlockHeader
 	err := bc.db.View(func(tx *db_pkg.Tx) error {
 		b := tx.Bucket([]byte(utils.BLOCKS_BUCKET))
+		if b == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+		}
 
 		// Retrieve the link to the last block is written in the database.
 		lastHash := b.Get(utils.LAST_BLOCK_HASH)
@@ -167,28 +297,39 @@ func (bc *BlockChain) GetBestHeight() int {
 			return errors.New("bc.GetBestHeight: last block hash does not exist")
 		}
 
-		// Get the last block from the database to retrieve its height.
-		blockData := b.Get(lastHash)
-		if blockData == nil {
-			return errors.New("bc.GetBestHeight: last block does not exist or last hash is invalid")
+		// Get the last block's header from the database to retrieve its height.
+		var err error
+		lastHeader, err = headerGetterFromTx(tx)(lastHash)
+		return err
+	})
+	return lastHeader.Height, err
+}
+
+// GetBestHash returns the hash of the last block of the best chain.
+func (bc *BlockChain) GetBestHash() ([]byte, error) {
+	var lastHash []byte
+	err := bc.db.View(func(tx *db_pkg.Tx) error {
+		b := tx.Bucket(utils.BLOCKS_BUCKET)
+		if b == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
 		}
-		lastBlock = DeserializeBlock(blockData)
+		lastHash = append([]byte{}, b.Get(utils.LAST_BLOCK_HASH)...)
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
-	return lastBlock.Height
+	return lastHash, err
 }
 
 // GetBlock retrieves a block by given hash and deserialize it.
+// Returns ErrBlockNotFound if the block is not stored.
 func (bc *BlockChain) GetBlock(blockHash []byte) (types.Block, error) {
-	var block types.Block
 	blockData, err := bc.db.Get(blockHash, utils.BLOCKS_BUCKET)
+	if err == db_pkg.ErrKeyNotFound {
+		return types.Block{}, ErrBlockNotFound
+	}
 	if err != nil {
-		return block, err
+		return types.Block{}, err
 	}
-	return DeserializeBlock(blockData), nil
+	return DeserializeBlock(blockData)
 
 	/*
 		err := bc.db.View(func(tx *db_pkg.Tx) error {
@@ -203,25 +344,52 @@ func (bc *BlockChain) GetBlock(blockHash []byte) (types.Block, error) {
 	*/
 }
 
-func (bc *BlockChain) GetBlockHashes(height int) [][]byte {
+// GetBlockHeader retrieves a block header by given hash. It does not
+// require block's transactions to be deserialized.
+func (bc *BlockChain) GetBlockHeader(blockHash []byte) (types.BlockHeader, error) {
+	headerData, err := bc.db.Get(blockHash, utils.HEADERS_BUCKET)
+	if err == nil {
+		return types.DeserializeBlockHeader(headerData)
+	}
+
+	// Headers of blocks stored before headers bucket was introduced are taken from blocks.
+	block, err := bc.GetBlock(blockHash)
+	if err != nil {
+		return types.BlockHeader{}, err
+	}
+	return block.BlockHeader, nil
+}
+
+// GetBlockHashes returns hashes of the best chain's blocks
+// above given height in ascending order of heights.
+func (bc *BlockChain) GetBlockHashes(height int) ([][]byte, error) {
 	var blocks [][]byte
-	bci := bc.Iterator()
-	for !bci.End() {
-		block := bci.Next()
-		if block.Height <= height {
-			break
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	for h := height + 1; h <= bestHeight; h++ {
+		hash, err := bc.GetBlockHashByHeight(h)
+		if err != nil {
+			return nil, err
 		}
-		blocks = append(blocks, block.Hash)
+		blocks = append(blocks, hash)
 	}
-	return blocks
+	return blocks, nil
 }
 
-func (bc *BlockChain) FindUTXO() map[string]tx_io.TXOutputs {
+func (bc *BlockChain) FindUTXO() (map[string]tx_io.TXOutputs, error) {
 	UTXO := make(map[string]tx_io.TXOutputs)
 	spentTXOs := make(map[string][]int)
-	bci := bc.Iterator()
+	bci, err := bc.Iterator()
+	if err != nil {
+		return nil, err
+	}
 	for !bci.End() {
-		block := bci.Next()
+		block, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.Hash)
 		Outputs:
@@ -234,7 +402,12 @@ func (bc *BlockChain) FindUTXO() map[string]tx_io.TXOutputs {
 					}
 				}
 				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				if outs.Outputs == nil {
+					outs.Outputs = make(map[int]tx_io.TXOutput)
+					outs.Height = block.Height
+					outs.IsCoinBase = tx.IsCoinBase()
+				}
+				outs.Outputs[outIdx] = out
 				UTXO[txID] = outs
 			}
 			if tx.IsCoinBase() == false {
@@ -245,163 +418,419 @@ func (bc *BlockChain) FindUTXO() map[string]tx_io.TXOutputs {
 			}
 		}
 	}
-	return UTXO
+	return UTXO, nil
 }
 
 // Iterator creates and returns a new blockchain iterator
-func (bc *BlockChain) Iterator() BlockChainIterator {
+func (bc *BlockChain) Iterator() (BlockChainIterator, error) {
 
 	// Retrieve last block hash.
 	tip, err := bc.db.Get(utils.LAST_BLOCK_HASH, utils.BLOCKS_BUCKET)
 	if err != nil {
-		log.Panic(err)
+		return BlockChainIterator{}, err
 	}
 	bc.tip = tip
-	return BlockChainIterator{bc.tip, bc.db}
+	return BlockChainIterator{bc.tip, bc.db}, nil
 }
 
-func NewUTXOTransaction(targetWallet *wallet.Wallet, to string, amount, fee float64, utxoSet *UTXOSet) types.Transaction {
-	var inputs []tx_io.TXInput
-	var outputs []tx_io.TXOutput
+// NewUTXOTransaction creates a transaction which sends given amount to the
+// recipient and returns the change to the sender. The fee is calculated from
+// the size of the signed transaction at given fee rate and is taken from the
+// change, so spent outputs must cover both the amount and the fee, otherwise
+// ErrInsufficientFunds is returned. A replaceable transaction may be replaced
+// by one paying higher fee until it is included in a block.
+func NewUTXOTransaction(targetWallet *wallet.Wallet, to string, value, feePerByte amount.Amount, replaceable bool, utxoSet *UTXOSet) (types.Transaction, error) {
 	pubKeyHash := wallet.HashPubKey(targetWallet.PublicKey)
-	acc, validOutputs := utxoSet.FindSpendableOutputs(pubKeyHash, amount, )
-	if acc < amount {
-		log.Panic("ERROR: Not enough funds")
+	from := string(targetWallet.GetAddress())
+	tx := types.Transaction{
+		Version:   vars.TX_VERSION,
+		Hash:      nil,
+		Timestamp: time.Now().Unix(),
+		Fee:       0,
 	}
-	for txId, outs := range validOutputs {
-		prevTx, err := hex.DecodeString(txId)
+
+	// Sequences of inputs disable relative lock times and signal whether
+	// the transaction may be replaced in memory pools, see BumpFee.
+	sequence := uint32(vars.SEQUENCE_FINAL - 1)
+	if replaceable {
+		sequence = vars.MAX_BIP125_RBF_SEQUENCE
+	}
+
+	// The fee depends on the size of inputs and their signatures, so the
+	// transaction is signed and its fee is raised until the fee covers it.
+	acc, validOutputs, err := utxoSet.FindSpendableOutputs(pubKeyHash, value)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	for {
+		if acc < value+tx.Fee {
+			nextAcc, nextOutputs, err := utxoSet.FindSpendableOutputs(pubKeyHash, value+tx.Fee)
+			if err != nil {
+				return types.Transaction{}, err
+			}
+			if nextAcc <= acc {
+				return types.Transaction{}, ErrInsufficientFunds
+			}
+			acc, validOutputs = nextAcc, nextOutputs
+			continue
+		}
+		tx.VIn = nil
+		for txId, outs := range validOutputs {
+			prevTx, err := hex.DecodeString(txId)
+			if err != nil {
+				return types.Transaction{}, err
+			}
+			for _, out := range outs {
+				tx.VIn = append(tx.VIn, tx_io.TXInput{PreviousTx: prevTx, VOut: out, ScriptSig: nil, Sequence: sequence})
+			}
+		}
+		tx.VOut = []tx_io.TXOutput{tx_io.NewTXOutput(value, to)}
+		if acc > value+tx.Fee {
+			tx.VOut = append(tx.VOut, tx_io.NewTXOutput(acc-value-tx.Fee, from)) // a change
+		}
+		tx.Hash = tx.CalcHash()
+		tx, err = utxoSet.BlockChain.SignTransaction(tx, targetWallet.PrivateKey)
 		if err != nil {
-			log.Panic(err)
+			return types.Transaction{}, err
 		}
-		for _, out := range outs {
-			inputs = append(inputs, tx_io.TXInput{PreviousTx: prevTx, VOut: out, Signature: nil, PubKey: targetWallet.PublicKey})
+		fee := tx.CalculateFee(feePerByte)
+		if fee <= tx.Fee {
+			return tx, nil
+		}
+		tx.Fee = fee
+	}
+}
+
+// BumpFee rebuilds a replaceable transaction created by NewUTXOTransaction,
+// which is not included in a block yet, to pay given fee rate. The new
+// transaction spends the same outputs and takes the additional fee from the
+// change. Its fee also covers the fee of the original and its own size at the
+// minimum relay fee rate, so memory pools replace the original with it.
+func BumpFee(targetWallet *wallet.Wallet, original types.Transaction, feePerByte amount.Amount, utxoSet *UTXOSet) (types.Transaction, error) {
+	for _, vin := range original.VIn {
+		if vin.Sequence > vars.MAX_BIP125_RBF_SEQUENCE {
+			return types.Transaction{}, ErrNotReplaceable
+		}
+	}
+	oldFee, err := utxoSet.BlockChain.CheckTransactionInputs(original)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+
+	// The change is the last output returned to the sender.
+	pubKeyHash := wallet.HashPubKey(targetWallet.PublicKey)
+	change := -1
+	for i, out := range original.VOut {
+		if out.IsLockedWithKey(pubKeyHash) {
+			change = i
 		}
 	}
-	from := fmt.Sprintf("%x", targetWallet.GetAddress())
-	outputs = append(outputs, tx_io.NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, tx_io.NewTXOutput(acc-amount, from)) // a change
+	if change < 0 {
+		return types.Transaction{}, ErrNoChange
 	}
+	available := original.VOut[change].Value + oldFee
 	tx := types.Transaction{
-		Hash:      nil,
-		VIn:       inputs,
-		VOut:      outputs,
+		Version:   original.Version,
 		Timestamp: time.Now().Unix(),
-		Fee:       0,
+		LockTime:  original.LockTime,
+		VIn:       make([]tx_io.TXInput, len(original.VIn)),
+		VOut:      make([]tx_io.TXOutput, len(original.VOut)),
+		Fee:       oldFee,
+	}
+	copy(tx.VOut, original.VOut)
+	for {
+		if tx.Fee >= available {
+			return types.Transaction{}, ErrNoChange
+		}
+		for i, vin := range original.VIn {
+			tx.VIn[i] = tx_io.TXInput{PreviousTx: vin.PreviousTx, VOut: vin.VOut, Sequence: vin.Sequence}
+		}
+		tx.VOut[change].Value = available - tx.Fee
+		tx.Hash = tx.CalcHash()
+		tx, err = utxoSet.BlockChain.SignTransaction(tx, targetWallet.PrivateKey)
+		if err != nil {
+			return types.Transaction{}, err
+		}
+		fee := tx.CalculateFee(feePerByte)
+		if minFee := oldFee + tx.CalculateFee(vars.MIN_FEE_PER_BYTE); fee < minFee {
+			fee = minFee
+		}
+		if fee <= tx.Fee {
+			return tx, nil
+		}
+		tx.Fee = fee
 	}
-	tx.Hash = tx.CalcHash()
-	tx.Fee = tx.CalculateFee(fee)
-	return utxoSet.BlockChain.SignTransaction(tx, targetWallet.PrivateKey)
 }
 
-// MineBlock generates new block.
-func (bc *BlockChain) MineBlock(minerAddress string, transactions []types.Transaction) (types.Block, error) {
-	var lastHash []byte
-	var lastHeight int
-	fees := 0.0
+// MineBlock generates new block on top of the best chain and seals it with given
+// consensus engine, see NewEngine. Transactions are included in the given order,
+// so parents must go before their children, see mining.NewBlockTemplate. Sealing
+// stops with the context's error when the context is done, e.g. because the best
+// chain has changed.
+func (bc *BlockChain) MineBlock(ctx context.Context, engine consensus.Engine, minerAddress string, transactions []types.Transaction) (types.Block, error) {
+	candidate, err := bc.NewBlockCandidate(minerAddress, transactions)
+	if err != nil {
+		return types.Block{}, err
+	}
+
+	// Generate new block.
+	newBlock, err := engine.Seal(ctx, candidate, bc.GetBlockHeader)
+	if err != nil {
+		return types.Block{}, err
+	}
 
-	// Verify all given transactions
-	// If transaction is invalid, ignore it and send an error to its owner
-	for _, tx := range transactions {
-		if !bc.VerifyTransaction(tx) {
+	// Store the block and apply it to the UTXO set.
+	err = bc.AddBlock(newBlock)
+	if err != nil {
+		return types.Block{}, err
+	}
+	return bc.GetBlock(newBlock.Hash)
+}
 
-			// TODO: send an error to transaction's author
+// NewBlockCandidate creates a block on top of the best chain which is not sealed
+// yet: its header has no nonce or seal and the block has no hash. The coinbase paying
+// to given address goes first, valid transactions follow in the given order.
+func (bc *BlockChain) NewBlockCandidate(minerAddress string, transactions []types.Transaction) (types.Block, error) {
+	var header types.BlockHeader
 
-		} else {
-			fees += tx.Fee
-		}
+	// Verify all given transactions, invalid ones are not included into the block.
+	// TODO: send an error to transaction's author
+	transactions, fees, err := bc.selectTransactions(transactions)
+	if err != nil {
+		return types.Block{}, err
 	}
 
-	// Retrieve last block height.
-	err := bc.db.View(func(tx *db_pkg.Tx) error {
+	// Link the new block to the last one and calculate its difficulty.
+	engine, err := NewEngine(bc.params, nil, nil)
+	if err != nil {
+		return types.Block{}, err
+	}
+	err = bc.db.View(func(tx *db_pkg.Tx) error {
 		b := tx.Bucket(utils.BLOCKS_BUCKET)
 		if b == nil {
 			return errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
 		}
 
 		// Get a link to the last block.
-		lastHash = b.Get([]byte("l"))
+		lastHash := b.Get(utils.LAST_BLOCK_HASH)
+
+		// Get the last block header.
+		getHeader := headerGetterFromTx(tx)
+		lastHeader, err := getHeader(lastHash)
+		if err != nil {
+			return err
+		}
+		// The hash is copied, database memory is valid only inside the transaction.
+		header.PrevBlockHash = append([]byte{}, lastHash...)
+		header.Height = lastHeader.Height + 1
+		header.Bits, err = engine.CalcNextBits(lastHeader, getHeader)
+		if err != nil {
+			return err
+		}
 
-		// Get and deserialize the last block.
-		blockData := b.Get(lastHash)
-		block := DeserializeBlock(blockData)
-		lastHeight = block.Height
+		// Timestamp must be after median time of the last blocks.
+		medianTime, err := CalcPastMedianTime(lastHeader, getHeader)
+		if err != nil {
+			return err
+		}
+		header.Timestamp = time.Now().Unix()
+		if header.Timestamp <= medianTime {
+			header.Timestamp = medianTime + 1
+		}
 		return nil
 	})
 	if err != nil {
-		log.Panic(err)
-	}
-
-	// Add coin base transaction to a list of transaction.
-	transactions = append(transactions, NewCoinBaseTX(minerAddress, fees))
-
-	// Generate new block.
-	newBlock, err := NewBlock(transactions, lastHash, lastHeight+1)
-	if err != nil {
-		fmt.Println(err.Error())
 		return types.Block{}, err
 	}
 
-	// Lock thread for safe database update.
-	vars.DBMutex.Lock()
-	err = bc.db.Batch(func(tx *db_pkg.Tx) error {
-		b := tx.Bucket(utils.BLOCKS_BUCKET)
+	// Coin base transaction goes first in the block.
+	subsidy := CalcBlockSubsidy(header.Height, bc.params)
+	transactions = append([]types.Transaction{NewCoinBaseTX(minerAddress, subsidy+fees, header.Height)}, transactions...)
+	header.Version = vars.BLOCK_VERSION
+	block := types.Block{BlockHeader: header, Transactions: transactions, Hash: []byte{}}
+	block.MerkleRoot = consensus.HashTransactions(block.Transactions)
+	return block, nil
+}
+
+// selectTransactions returns transactions which can be included into a block
+// on top of the best chain in the given order and the total fee they pay.
+// A transaction may spend outputs of transactions selected before it.
+// Transactions which exceed size or signature operations limits of the
+// block are skipped.
+func (bc *BlockChain) selectTransactions(transactions []types.Transaction) ([]types.Transaction, amount.Amount, error) {
+	var selected []types.Transaction
+	fees := amount.Amount(0)
+	size, sigOps := vars.COINBASE_RESERVED_SIZE, vars.COINBASE_RESERVED_SIGOPS
+	err := bc.db.View(func(tx *db_pkg.Tx) error {
+		b := tx.Bucket(vars.UTXO_BUCKET)
 		if b == nil {
-			return errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UTXO_BUCKET))
 		}
-		err := b.Put(newBlock.Hash, newBlock.Serialize())
+		height, medianTime, err := nextBlockContext(tx)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		err = b.Put(utils.LAST_BLOCK_HASH, newBlock.Hash)
-		if err != nil {
-			log.Panic(err)
+		spent := make(map[string]bool)
+		created := make(map[string]tx_io.TXOutput)
+		getOutput := func(txHash []byte, index int) (utxoEntry, bool, error) {
+			outpoint := fmt.Sprintf("%x:%d", txHash, index)
+			if spent[outpoint] {
+				return utxoEntry{}, false, nil
+			}
+			if out, ok := created[outpoint]; ok {
+				return utxoEntry{Output: out, Height: height}, true, nil
+			}
+			return getUnspentOutput(b, txHash, index)
+		}
+		getMedianTime := medianTimeGetterFromTx(tx)
+		for _, transaction := range transactions {
+			if transaction.IsCoinBase() || CheckTransaction(transaction, bc.params) != nil {
+				continue
+			}
+			txSize, txSigOps := transaction.Size(), CountSigOps(transaction)
+			if size+txSize > bc.params.MaxBlockSize || sigOps+txSigOps > bc.params.MaxBlockSigOps {
+				continue
+			}
+			fee, err := checkTransactionInputs(transaction, getOutput)
+			if err == nil {
+				err = checkTransactionLocks(transaction, height, medianTime, bc.params, getOutput, getMedianTime)
+			}
+			if _, ok := err.(RuleError); ok {
+				utils.PrintLog(fmt.Sprintf("Transaction %x is skipped: %s\n", transaction.Hash, err.Error()))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			for _, vin := range transaction.VIn {
+				spent[fmt.Sprintf("%x:%d", vin.PreviousTx, vin.VOut)] = true
+			}
+			for outIdx, out := range transaction.VOut {
+				created[fmt.Sprintf("%x:%d", transaction.Hash, outIdx)] = out
+			}
+			selected = append(selected, transaction)
+			fees += fee
+			size += txSize
+			sigOps += txSigOps
 		}
 		return nil
 	})
-	vars.DBMutex.Unlock()
-	if err != nil {
-		log.Panic(err)
-	}
-	return bc.GetBlock(newBlock.Hash)
+	return selected, fees, err
 }
 
+// FindTransaction looks for a transaction by given id in the best chain.
+// Uses the transaction index if it is enabled, otherwise scans blocks from the tip.
 func (bc *BlockChain) FindTransaction(ID []byte) (types.Transaction, error) {
-	bci := bc.Iterator()
+	tx, indexed, err := bc.findIndexedTransaction(ID)
+	if indexed {
+		return tx, err
+	}
+	bci, err := bc.Iterator()
+	if err != nil {
+		return types.Transaction{}, err
+	}
 	for !bci.End() {
-		block := bci.Next()
+		block, err := bci.Next()
+		if err != nil {
+			return types.Transaction{}, err
+		}
 		for _, tx := range block.Transactions {
 			if bytes.Compare(tx.Hash, ID) == 0 {
 				return tx, nil
 			}
 		}
 	}
-	return types.Transaction{}, errors.New("transaction is not found")
+	return types.Transaction{}, ErrTxNotFound
 }
 
-func (bc *BlockChain) VerifyTransaction(tx types.Transaction) bool {
-	if tx.IsCoinBase() {
-		return true
-	}
+// findPrevTransactions returns transactions which created outputs spent by given one.
+func (bc *BlockChain) findPrevTransactions(tx types.Transaction) (map[string]types.Transaction, error) {
 	prevTXs := make(map[string]types.Transaction)
 	for _, vin := range tx.VIn {
 		prevTX, err := bc.FindTransaction(vin.PreviousTx)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
 		prevTXs[hex.EncodeToString(prevTX.Hash)] = prevTX
 	}
+	return prevTXs, nil
+}
+
+// VerifyTransaction checks signatures of the transaction, returns
+// ErrInvalidSignature if any of them is not valid.
+func (bc *BlockChain) VerifyTransaction(tx types.Transaction) error {
+	if tx.IsCoinBase() {
+		return nil
+	}
+	prevTXs, err := bc.findPrevTransactions(tx)
+	if err != nil {
+		return err
+	}
 	return tx.Verify(prevTXs)
 }
 
-func (bc *BlockChain) SignTransaction(tx types.Transaction, privKey []byte) types.Transaction {
-	prevTXs := make(map[string]types.Transaction)
-	for _, vin := range tx.VIn {
-		prevTX, err := bc.FindTransaction(vin.PreviousTx)
+// CheckTransactionInputs checks that the transaction spends unspent outputs
+// of the best chain with valid signatures and returns the fee it pays.
+func (bc *BlockChain) CheckTransactionInputs(transaction types.Transaction) (amount.Amount, error) {
+	var fee amount.Amount
+	err := bc.db.View(func(tx *db_pkg.Tx) error {
+		b := tx.Bucket(vars.UTXO_BUCKET)
+		if b == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UTXO_BUCKET))
+		}
+		getOutput := func(txHash []byte, index int) (utxoEntry, bool, error) {
+			return getUnspentOutput(b, txHash, index)
+		}
+		var err error
+		fee, err = checkTransactionInputs(transaction, getOutput)
+		return err
+	})
+	return fee, err
+}
+
+// UnconfirmedOutputGetter returns an output of an unconfirmed transaction.
+// Conflicts between unconfirmed transactions are not checked by the chain.
+type UnconfirmedOutputGetter func(txHash []byte, index int) (tx_io.TXOutput, bool)
+
+// CheckUnconfirmedTransaction checks that the transaction can be included in
+// the next block of the best chain after unconfirmed transactions, which
+// outputs are returned by getUnconfirmed, and returns the fee it pays. Both
+// inputs and locks of the transaction are checked, see CheckTransactionInputs
+// and CheckTransactionLocks.
+func (bc *BlockChain) CheckUnconfirmedTransaction(transaction types.Transaction, getUnconfirmed UnconfirmedOutputGetter) (amount.Amount, error) {
+	err := CheckTransaction(transaction, bc.params)
+	if err != nil {
+		return 0, err
+	}
+	var fee amount.Amount
+	err = bc.db.View(func(tx *db_pkg.Tx) error {
+		b := tx.Bucket(vars.UTXO_BUCKET)
+		if b == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UTXO_BUCKET))
+		}
+		height, medianTime, err := nextBlockContext(tx)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		prevTXs[hex.EncodeToString(prevTX.Hash)] = prevTX
+		getOutput := func(txHash []byte, index int) (utxoEntry, bool, error) {
+			if out, ok := getUnconfirmed(txHash, index); ok {
+				return utxoEntry{Output: out, Height: height}, true, nil
+			}
+			return getUnspentOutput(b, txHash, index)
+		}
+		fee, err = checkTransactionInputs(transaction, getOutput)
+		if err != nil {
+			return err
+		}
+		return checkTransactionLocks(transaction, height, medianTime, bc.params, getOutput, medianTimeGetterFromTx(tx))
+	})
+	return fee, err
+}
+
+func (bc *BlockChain) SignTransaction(tx types.Transaction, privKey []byte) (types.Transaction, error) {
+	prevTXs, err := bc.findPrevTransactions(tx)
+	if err != nil {
+		return types.Transaction{}, err
 	}
 	return tx.Sign(privKey, prevTXs)
 }
@@ -15,8 +15,439 @@
 
 package core
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
 
-func Test(test *testing.T) {
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/config"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
 
+func newTestChain(test *testing.T) (BlockChain, *wallet.Wallet, func()) {
+	dir, err := ioutil.TempDir("", "blockchain")
+	if err != nil {
+		test.Fatal(err)
+	}
+	db, err := db_pkg.Open(filepath.Join(dir, "chain.db"), 0600, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	w := wallet.NewWallet()
+	genesis := newTestBlock(test, []types.Transaction{NewCoinBaseTX(string(w.GetAddress()), CalcBlockSubsidy(0, &params.RegTestParams), 0)}, []byte{}, 0)
+	err = db.PutArray(
+		[][]byte{genesis.Hash, utils.LAST_BLOCK_HASH},
+		[][]byte{genesis.Serialize(), genesis.Hash},
+		utils.BLOCKS_BUCKET, false,
+	)
+	if err != nil {
+		test.Fatal(err)
+	}
+	err = buildHeightIndex(db)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// Tests spend block rewards in the next blocks unless they check maturity.
+	chainParams := params.RegTestParams
+	chainParams.CoinbaseMaturity = 0
+	bc := BlockChain{genesis.Hash, db, newOrphanPool(), &chainParams, nil}
+	err = UTXOSet{BlockChain: bc}.Reindex()
+	if err != nil {
+		test.Fatal(err)
+	}
+	return bc, w, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// testHasher hashes headers of blocks created by tests,
+// they are validated by rules of the regression test network.
+var testHasher, _ = NewPowHasher(params.RegTestParams.PowAlgorithm)
+
+func newTestBlock(test *testing.T, transactions []types.Transaction, prevBlockHash []byte, height int) types.Block {
+	header := types.BlockHeader{
+		PrevBlockHash: prevBlockHash,
+		Timestamp:     time.Now().Unix() + int64(height),
+		Bits:          BigToCompact(params.RegTestParams.PowLimit),
+		Height:        height,
+	}
+	block, err := NewBlock(header, transactions, testHasher)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return block
+}
+
+func newTestSignedTx(test *testing.T, bc BlockChain, tx types.Transaction, privKey []byte) types.Transaction {
+	tx.Hash = tx.CalcHash()
+	tx, err := bc.SignTransaction(tx, privKey)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return tx
+}
+
+// newTestCoinBase returns a coinbase paying to a new address, so coinbases
+// of tests differ regardless of heights of their blocks.
+func newTestCoinBase() types.Transaction {
+	return NewCoinBaseTX(string(wallet.NewWallet().GetAddress()), params.RegTestParams.InitialSubsidy, 0)
+}
+
+func TestNewBlockChain(test *testing.T) {
+	dir, err := ioutil.TempDir("", "blockchain")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := config.Config{ChainPath: filepath.Join(dir, "chain.db"), Network: "regtest"}
+	bc, err := CreateBlockChain(string(wallet.NewWallet().GetAddress()), cfg)
+	if err != nil {
+		test.Fatal(err)
+	}
+	bc.CloseDB(false)
+	bc, err = NewBlockChain(cfg)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// Databases created before the version was stored are not opened.
+	err = bc.db.Delete(utils.CHAIN_VERSION_KEY, utils.BLOCKS_BUCKET, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	bc.CloseDB(false)
+	if _, err := NewBlockChain(cfg); err != ErrChainVersion {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrChainVersion)
+	}
+}
+
+func TestBlockChain_AddBlock(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+	genesis := bc.tip
+	genesisBlock, err := bc.GetBlock(genesis)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The first branch spends the genesis reward which must be restored after switching.
+	spend := types.Transaction{
+		VIn:       []tx_io.TXInput{{PreviousTx: genesisBlock.Transactions[0].Hash, VOut: 0}},
+		VOut:      []tx_io.TXOutput{tx_io.NewTXOutput(params.RegTestParams.InitialSubsidy, string(w.GetAddress()))},
+		Timestamp: time.Now().Unix(),
+	}
+	spend = newTestSignedTx(test, bc, spend, w.PrivateKey)
+	a1 := newTestBlock(test, []types.Transaction{newTestCoinBase(), spend}, genesis, 1)
+	if err := bc.AddBlock(a1); err != nil {
+		test.Fatal(err)
+	}
+	b1 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, genesis, 1)
+	if err := bc.AddBlock(b1); err != nil {
+		test.Fatal(err)
+	}
+
+	// The first seen block wins when both branches have equal work.
+	if tip, err := bc.GetBestHash(); err != nil || !bytes.Equal(tip, a1.Hash) {
+		test.Errorf("invalid tip:\nactual:\n%x\nexpected:\n%x", tip, a1.Hash)
+	}
+
+	b2 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, b1.Hash, 2)
+	if err := bc.AddBlock(b2); err != nil {
+		test.Fatal(err)
+	}
+	if tip, err := bc.GetBestHash(); err != nil || !bytes.Equal(tip, b2.Hash) {
+		test.Errorf("invalid tip after reorganization:\nactual:\n%x\nexpected:\n%x", tip, b2.Hash)
+	}
+
+	utxoSet := UTXOSet{BlockChain: bc}
+	for _, tx := range a1.Transactions {
+		if _, err := bc.db.Get(tx.Hash, vars.UTXO_BUCKET); err == nil {
+			test.Error("outputs of disconnected block are still in the UTXO set")
+		}
+	}
+	for _, block := range []types.Block{genesisBlock, b1, b2} {
+		if _, err := bc.db.Get(block.Transactions[0].Hash, vars.UTXO_BUCKET); err != nil {
+			test.Errorf("outputs of connected block %x are not in the UTXO set", block.Hash)
+		}
+	}
+	if count, err := utxoSet.CountTransactions(); err != nil || count != 3 {
+		test.Errorf("invalid UTXO set size:\nactual:\n%d\nexpected:\n3", count)
+	}
+
+	for height, block := range []types.Block{genesisBlock, b1, b2} {
+		hash, err := bc.GetBlockHashByHeight(height)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if !bytes.Equal(hash, block.Hash) {
+			test.Errorf("invalid hash at height %d:\nactual:\n%x\nexpected:\n%x", height, hash, block.Hash)
+		}
+	}
+	if bc.IsInMainChain(a1.Hash) {
+		test.Error("disconnected block is still in the main chain")
+	}
+	if _, err := bc.GetBlockByHeight(3); err != ErrBlockNotFound {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBlockNotFound)
+	}
+	hashes, err := bc.GetBlockHashes(0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(hashes) != 2 || !bytes.Equal(hashes[0], b1.Hash) || !bytes.Equal(hashes[1], b2.Hash) {
+		test.Errorf("invalid block hashes:\nactual:\n%x\nexpected:\n%x", hashes, [][]byte{b1.Hash, b2.Hash})
+	}
+}
+
+func TestBlockChain_AddBlockOrphan(test *testing.T) {
+	bc, _, closeChain := newTestChain(test)
+	defer closeChain()
+
+	b1 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, bc.tip, 1)
+	b2 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, b1.Hash, 2)
+	if err := bc.AddBlock(b2); err != ErrOrphanBlock {
+		test.Fatalf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrOrphanBlock)
+	}
+	if err := bc.AddBlock(b1); err != nil {
+		test.Fatal(err)
+	}
+	if height, err := bc.GetBestHeight(); err != nil || height != 2 {
+		test.Errorf("invalid best height:\nactual:\n%d\nexpected:\n2", height)
+	}
+}
+
+func TestBlockChain_SetListener(test *testing.T) {
+	bc, _, closeChain := newTestChain(test)
+	defer closeChain()
+	var disconnected, connected []types.Block
+	bc.SetListener(func(d, c []types.Block) {
+		disconnected = append(disconnected, d...)
+		connected = append(connected, c...)
+	})
+
+	a1 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, bc.tip, 1)
+	a2 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, a1.Hash, 2)
+	b1 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, bc.tip, 1)
+	b2 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, b1.Hash, 2)
+	b3 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, b2.Hash, 3)
+	for _, block := range []types.Block{a1, a2, b1, b3} {
+		if err := bc.AddBlock(block); err != nil && err != ErrOrphanBlock {
+			test.Fatal(err)
+		}
+	}
+	if len(disconnected) != 0 || len(connected) != 2 {
+		test.Fatalf("invalid number of blocks:\nactual:\n%d %d\nexpected:\n0 2", len(disconnected), len(connected))
+	}
+
+	// The missing block connects the orphan and makes the side branch the best one.
+	disconnected, connected = nil, nil
+	if err := bc.AddBlock(b2); err != nil {
+		test.Fatal(err)
+	}
+	for i, expected := range [][]types.Block{{a1, a2}, {b1, b2, b3}} {
+		actual := [][]types.Block{disconnected, connected}[i]
+		if len(actual) != len(expected) {
+			test.Fatalf("invalid number of blocks:\nactual:\n%d\nexpected:\n%d", len(actual), len(expected))
+		}
+		for j := range expected {
+			if !bytes.Equal(actual[j].Hash, expected[j].Hash) {
+				test.Errorf("invalid block:\nactual:\n%x\nexpected:\n%x", actual[j].Hash, expected[j].Hash)
+			}
+		}
+	}
+}
+
+func TestBlockChain_MineBlock(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+	engine, err := NewEngine(bc.params, &Miner{Threads: 1}, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// Coinbases of the genesis and mined blocks pay the same value to the same address.
+	for height := 1; height <= 2; height++ {
+		block, err := bc.MineBlock(context.Background(), engine, string(w.GetAddress()), nil)
+		if err != nil {
+			test.Fatalf("can not mine block at height %d: %v", height, err)
+		}
+		if block.Height != height {
+			test.Errorf("invalid height:\nactual:\n%d\nexpected:\n%d", block.Height, height)
+		}
+	}
+	if height, err := bc.GetBestHeight(); err != nil || height != 2 {
+		test.Errorf("invalid best height:\nactual:\n%d\nexpected:\n2", height)
+	}
+}
+
+func TestBlockChain_FindTransaction(test *testing.T) {
+	bc, _, closeChain := newTestChain(test)
+	defer closeChain()
+
+	a1 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, bc.tip, 1)
+	if err := bc.AddBlock(a1); err != nil {
+		test.Fatal(err)
+	}
+	if count, err := bc.ReindexTransactions(); err != nil || count != 2 {
+		test.Fatalf("invalid reindex result:\nactual:\n%d %v\nexpected:\n2 <nil>", count, err)
+	}
+
+	// Blocks connected after enabling the index and by a reorganization must be indexed too.
+	b1 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, a1.PrevBlockHash, 1)
+	b2 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, b1.Hash, 2)
+	for _, block := range []types.Block{b1, b2} {
+		if err := bc.AddBlock(block); err != nil {
+			test.Fatal(err)
+		}
+	}
+	for _, block := range []types.Block{b1, b2} {
+		tx, err := bc.FindTransaction(block.Transactions[0].Hash)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if !bytes.Equal(tx.Hash, block.Transactions[0].Hash) {
+			test.Errorf("invalid transaction:\nactual:\n%x\nexpected:\n%x", tx.Hash, block.Transactions[0].Hash)
+		}
+	}
+	if _, err := bc.FindTransaction(a1.Transactions[0].Hash); err != ErrTxNotFound {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrTxNotFound)
+	}
+}
+
+func TestNewUTXOTransaction(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+
+	utxoSet := UTXOSet{BlockChain: bc}
+	to := string(wallet.NewWallet().GetAddress())
+	_, err := NewUTXOTransaction(w, to, params.RegTestParams.InitialSubsidy+1, vars.MIN_FEE_PER_BYTE, false, &utxoSet)
+	if err != ErrInsufficientFunds {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrInsufficientFunds)
+	}
+	tx, err := NewUTXOTransaction(w, to, params.RegTestParams.InitialSubsidy/2, vars.MIN_FEE_PER_BYTE, false, &utxoSet)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := bc.VerifyTransaction(tx); err != nil {
+		test.Errorf("invalid verification result:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+
+	// The fee must cover the size of the signed transaction at the requested rate.
+	feePerByte := 3 * vars.MIN_FEE_PER_BYTE
+	tx, err = NewUTXOTransaction(w, to, params.RegTestParams.InitialSubsidy/2, feePerByte, false, &utxoSet)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fee, err := bc.CheckTransactionInputs(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if minFee := amount.Amount(tx.Size()) * feePerByte; fee < minFee || fee != tx.Fee {
+		test.Errorf("invalid fee:\nactual:\n%s\nexpected:\n%s", fee, minFee)
+	}
+}
+
+func TestBumpFee(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+
+	utxoSet := UTXOSet{BlockChain: bc}
+	to := string(wallet.NewWallet().GetAddress())
+	value := params.RegTestParams.InitialSubsidy / 2
+	final, err := NewUTXOTransaction(w, to, value, vars.MIN_FEE_PER_BYTE, false, &utxoSet)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := BumpFee(w, final, 2*vars.MIN_FEE_PER_BYTE, &utxoSet); err != ErrNotReplaceable {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNotReplaceable)
+	}
+	original, err := NewUTXOTransaction(w, to, value, vars.MIN_FEE_PER_BYTE, true, &utxoSet)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The fee is not lowered, even if the requested rate is lower.
+	for _, feePerByte := range []amount.Amount{vars.MIN_FEE_PER_BYTE, 5 * vars.MIN_FEE_PER_BYTE} {
+		tx, err := BumpFee(w, original, feePerByte, &utxoSet)
+		if err != nil {
+			test.Fatal(err)
+		}
+		fee, err := bc.CheckTransactionInputs(tx)
+		if err != nil {
+			test.Fatal(err)
+		}
+		minFee := original.Fee + amount.Amount(tx.Size())*vars.MIN_FEE_PER_BYTE
+		if rateFee := amount.Amount(tx.Size()) * feePerByte; rateFee > minFee {
+			minFee = rateFee
+		}
+		if fee < minFee || fee != tx.Fee {
+			test.Errorf("invalid fee:\nactual:\n%s\nexpected:\n%s", fee, minFee)
+		}
+		if tx.VOut[0].Value != value || len(tx.VIn) != len(original.VIn) {
+			test.Error("payment is changed by bumping the fee")
+		}
+	}
+	if _, err := BumpFee(w, original, params.RegTestParams.InitialSubsidy, &utxoSet); err != ErrNoChange {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNoChange)
+	}
+}
+
+func TestBlockChain_CheckUnconfirmedTransaction(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+	genesisBlock, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fee := params.RegTestParams.InitialSubsidy / 100
+	parent := types.Transaction{
+		Version:   vars.TX_VERSION,
+		VIn:       []tx_io.TXInput{{PreviousTx: genesisBlock.Transactions[0].Hash, VOut: 0}},
+		VOut:      []tx_io.TXOutput{tx_io.NewTXOutput(params.RegTestParams.InitialSubsidy-fee, string(w.GetAddress()))},
+		Timestamp: time.Now().Unix(),
+	}
+	parent = newTestSignedTx(test, bc, parent, w.PrivateKey)
+	child := types.Transaction{
+		Version:   vars.TX_VERSION,
+		VIn:       []tx_io.TXInput{{PreviousTx: parent.Hash, VOut: 0}},
+		VOut:      []tx_io.TXOutput{tx_io.NewTXOutput(params.RegTestParams.InitialSubsidy-2*fee, string(w.GetAddress()))},
+		Timestamp: time.Now().Unix(),
+	}
+	child.Hash = child.CalcHash()
+	child, err = child.Sign(w.PrivateKey, map[string]types.Transaction{hex.EncodeToString(parent.Hash): parent})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	noUnconfirmed := func(txHash []byte, index int) (tx_io.TXOutput, bool) {
+		return tx_io.TXOutput{}, false
+	}
+	if actual, err := bc.CheckUnconfirmedTransaction(parent, noUnconfirmed); err != nil || actual != fee {
+		test.Errorf("invalid fee:\nactual:\n%s %v\nexpected:\n%s <nil>", actual, err, fee)
+	}
+	if _, err := bc.CheckUnconfirmedTransaction(child, noUnconfirmed); !IsRuleError(err, ErrMissingInput) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrMissingInput)
+	}
+	getUnconfirmed := func(txHash []byte, index int) (tx_io.TXOutput, bool) {
+		if bytes.Equal(txHash, parent.Hash) && index == 0 {
+			return parent.VOut[0], true
+		}
+		return tx_io.TXOutput{}, false
+	}
+	if actual, err := bc.CheckUnconfirmedTransaction(child, getUnconfirmed); err != nil || actual != fee {
+		test.Errorf("invalid fee:\nactual:\n%s %v\nexpected:\n%s <nil>", actual, err, fee)
+	}
 }
@@ -17,49 +17,145 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
-	"log"
 	"time"
 
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 )
 
-func NewBlock(transactions []types.Transaction, prevBlockHash []byte, height int) (types.Block, error) {
+// Miner holds settings of the proof of work search for new blocks.
+type Miner struct {
+	// Threads is the number of goroutines searching for a nonce,
+	// runtime.NumCPU() goroutines are used if it is not positive.
+	Threads int
+
+	// Stats, if set, counts hashes computed by the miner.
+	Stats *MiningStats
+
+	// maxNonce limits the nonce space of the header, vars.MAX_NONCE if zero.
+	maxNonce int
+}
+
+// NewBlock creates a block with given transactions and header fields which
+// link it to the chain: PrevBlockHash, Height, Bits and Timestamp. If Timestamp
+// is zero, current time is used. Then the block is mined with given hasher
+// using all CPUs.
+func NewBlock(header types.BlockHeader, transactions []types.Transaction, hasher PowHasher) (types.Block, error) {
+	var miner Miner
+	return miner.NewBlock(context.Background(), header, transactions, hasher)
+}
+
+// NewBlock creates and mines a block like the NewBlock function does,
+// mining stops with the context's error when the context is done.
+//
+// When no nonce of the header satisfies proof of work, the timestamp is moved
+// to the current time and the extra nonce in the coinbase's input script is
+// increased, so the header changes and the search goes on. ErrNonceExhausted
+// is returned if the block has no coinbase and the timestamp can not be moved,
+// or if the extra nonce reaches MAX_EXTRA_NONCE.
+func (m *Miner) NewBlock(ctx context.Context, header types.BlockHeader, transactions []types.Transaction, hasher PowHasher) (types.Block, error) {
+	header.Version = vars.BLOCK_VERSION
+	header.Nonce = 0
+	if header.Timestamp == 0 {
+		header.Timestamp = time.Now().Unix()
+	}
 	block := types.Block{
-		Timestamp:     time.Now().Unix(),
-		Transactions:  transactions,
-		PrevBlockHash: prevBlockHash,
-		Hash:          []byte{},
-		Nonce:         0,
-		Height:        height,
+		BlockHeader:  header,
+		Transactions: append([]types.Transaction{}, transactions...),
+		Hash:         []byte{},
 	}
-	worker := NewProofOfWork(block)
-	nonce, hash, err := worker.Run()
-	block.Hash = hash
-	block.Nonce = nonce
-	return block, err
+	hasCoinBase := len(block.Transactions) > 0 && block.Transactions[0].IsCoinBase()
+	for extraNonce := int64(0); ; {
+		block.MerkleRoot = consensus.HashTransactions(block.Transactions)
+		worker := NewProofOfWork(block, hasher)
+		if m.maxNonce > 0 {
+			worker.maxNonce = m.maxNonce
+		}
+		nonce, hash, err := worker.Run(ctx, m.Threads, m.Stats)
+		if err == nil {
+			block.Hash = hash
+			block.Nonce = nonce
+			return block, nil
+		}
+		if err != ErrNonceExhausted {
+			return types.Block{}, err
+		}
+		now := time.Now().Unix()
+		rolled := now > block.Timestamp
+		if rolled {
+			block.Timestamp = now
+		}
+		if hasCoinBase && extraNonce < MAX_EXTRA_NONCE {
+			extraNonce++
+			block.Transactions[0], err = setExtraNonce(block.Transactions[0], block.Height, extraNonce)
+			if err != nil {
+				return types.Block{}, err
+			}
+		} else if !rolled {
+			return types.Block{}, ErrNonceExhausted
+		}
+	}
+}
+
+// coinBaseScript returns the input script of a coinbase of the block at
+// given height. A single number push never exceeds script limits.
+func coinBaseScript(height int) []byte {
+	scriptSig, _ := script.NewBuilder().AddInt64(int64(height)).Script()
+	return scriptSig
 }
 
-func NewGenesisBlock(coinBase types.Transaction) (types.Block, error) {
-	return NewBlock([]types.Transaction{coinBase}, []byte{}, 0)
+// setExtraNonce returns a copy of the coinbase of the block at given height
+// with the height and the extra nonce pushed by its input script.
+func setExtraNonce(coinBase types.Transaction, height int, extraNonce int64) (types.Transaction, error) {
+	scriptSig, err := script.NewBuilder().AddInt64(int64(height)).AddInt64(extraNonce).Script()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	coinBase.VIn = append([]tx_io.TXInput{}, coinBase.VIn...)
+	coinBase.VIn[0].ScriptSig = scriptSig
+	coinBase.Hash = coinBase.CalcHash()
+	return coinBase, nil
+}
+
+// NewGenesisBlock creates the first block of the chain and seals it
+// with the consensus engine of the network.
+func NewGenesisBlock(coinBase types.Transaction, chainParams *params.ChainParams) (types.Block, error) {
+	header := types.BlockHeader{
+		PrevBlockHash: []byte{},
+		Height:        0,
+		Bits:          BigToCompact(chainParams.PowLimit),
+	}
+	engine, err := NewEngine(chainParams, nil, nil)
+	if err != nil {
+		return types.Block{}, err
+	}
+	block := types.Block{BlockHeader: header, Transactions: []types.Transaction{coinBase}}
+	return engine.Seal(context.Background(), block, nil)
 }
 
-func DeserializeBlock(d []byte) types.Block {
+func DeserializeBlock(d []byte) (types.Block, error) {
 	var block types.Block
 	decoder := gob.NewDecoder(bytes.NewReader(d))
 	err := decoder.Decode(&block)
-	if err != nil {
-		log.Panic(err)
-	}
-	return block
+	return block, err
 }
 
-func NewCoinBaseTX(to string, fees float64) types.Transaction {
-	txIn := tx_io.TXInput{PreviousTx: []byte{}, VOut: -1, Signature: nil}
-	txOut := tx_io.NewTXOutput(vars.MINING_REWARD+fees, to)
+// NewCoinBaseTX creates a transaction which pays given value, i.e. the block
+// subsidy and fees of the block's transactions, to the miner. The input script
+// pushes the height of the block, so coinbases of different blocks paying the
+// same value to the same address have different hashes.
+func NewCoinBaseTX(to string, value amount.Amount, height int) types.Transaction {
+	txIn := tx_io.TXInput{PreviousTx: []byte{}, VOut: -1, ScriptSig: coinBaseScript(height), Sequence: vars.SEQUENCE_FINAL}
+	txOut := tx_io.NewTXOutput(value, to)
 	tx := types.Transaction{
+		Version:     vars.TX_VERSION,
 		Hash:        nil,
 		VIn:       []tx_io.TXInput{txIn},
 		VOut:      []tx_io.TXOutput{txOut},
@@ -70,12 +166,9 @@ func NewCoinBaseTX(to string, fees float64) types.Transaction {
 	return tx
 }
 
-func DeserializeTransaction(data []byte) types.Transaction {
+func DeserializeTransaction(data []byte) (types.Transaction, error) {
 	var transaction types.Transaction
 	decoder := gob.NewDecoder(bytes.NewReader(data))
 	err := decoder.Decode(&transaction)
-	if err != nil {
-		log.Panic(err)
-	}
-	return transaction
+	return transaction, err
 }
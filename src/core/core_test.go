@@ -16,18 +16,24 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"math/big"
 	"testing"
+	"time"
 
-	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
 )
 
 func TestNewCoinBaseTX(test *testing.T) {
 	w := wallet.NewWallet()
-	coinBaseTx := NewCoinBaseTX(string(w.GetAddress()), 1.0567)
+	coinBaseTx := NewCoinBaseTX(string(w.GetAddress()), 51056700, 17)
 
 	if coinBaseTx.Fee != 0 {
-		test.Errorf("invalid coin base tx fee:\nactual:\n%f\nexpected:\n0", coinBaseTx.Fee)
+		test.Errorf("invalid coin base tx fee:\nactual:\n%s\nexpected:\n0", coinBaseTx.Fee)
 	}
 	if len(coinBaseTx.VIn) != 1 {
 		test.Errorf("invalid coin base tx inputs len:\nactual:\n%d\nexpected:\n1", len(coinBaseTx.VIn))
@@ -38,14 +44,14 @@ func TestNewCoinBaseTX(test *testing.T) {
 	if coinBaseTx.VIn[0].VOut != -1 {
 		test.Errorf("invalid coin base tx input out referance:\nactual:\n%d\nexpected:\n-1", coinBaseTx.VIn[0].VOut)
 	}
-	if coinBaseTx.VIn[0].Signature != nil {
-		test.Errorf("invalid coin base tx input signature:\nactual:\n%x\nexpected:\nnil", coinBaseTx.VIn[0].Signature)
+	if expected := []byte{1, 17}; !bytes.Equal(coinBaseTx.VIn[0].ScriptSig, expected) {
+		test.Errorf("invalid coin base tx input script:\nactual:\n%x\nexpected:\n%x", coinBaseTx.VIn[0].ScriptSig, expected)
 	}
 	if len(coinBaseTx.VOut) != 1 {
 		test.Errorf("invalid coin base tx outs len:\nactual:\n%d\nexpected:\n1", len(coinBaseTx.VOut))
 	}
-	if coinBaseTx.VOut[0].Value != vars.MINING_REWARD+1.0567 {
-		test.Errorf("invalid coin base tx output value:\nactual:\n%f\nexpected:\n%f", coinBaseTx.VOut[0].Value, vars.MINING_REWARD+1.0567)
+	if coinBaseTx.VOut[0].Value != 51056700 {
+		test.Errorf("invalid coin base tx output value:\nactual:\n%s\nexpected:\n51.0567", coinBaseTx.VOut[0].Value)
 	}
 	expectedHash := coinBaseTx.CalcHash()
 	if len(coinBaseTx.Hash) != len(expectedHash) {
@@ -57,3 +63,30 @@ func TestNewCoinBaseTX(test *testing.T) {
 		}
 	}
 }
+
+func TestMiner_NewBlock(test *testing.T) {
+	// Two nonces are not enough to meet the target, so the extra nonce is rolled.
+	miner := Miner{Threads: 1, maxNonce: 2}
+	target := new(big.Int).Rsh(params.RegTestParams.PowLimit, 7)
+	header := types.BlockHeader{PrevBlockHash: []byte{}, Bits: BigToCompact(target)}
+	coinBase := newTestCoinBase()
+	block, err := miner.NewBlock(context.Background(), header, []types.Transaction{coinBase}, testHasher)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := CheckBlock(block, &params.RegTestParams); err != nil {
+		test.Errorf("invalid block:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+	if block.Nonce >= miner.maxNonce {
+		test.Errorf("invalid nonce:\nactual:\n%d\nexpected:\n< %d", block.Nonce, miner.maxNonce)
+	}
+
+	// Neither the extra nonce nor the timestamp of a future block can be rolled.
+	tx := types.Transaction{VIn: []tx_io.TXInput{{PreviousTx: coinBase.Hash}}, VOut: coinBase.VOut}
+	tx.Hash = tx.CalcHash()
+	header.Bits = BigToCompact(big.NewInt(1))
+	header.Timestamp = time.Now().Unix() + 1000
+	if _, err := miner.NewBlock(context.Background(), header, []types.Transaction{tx}, testHasher); err != ErrNonceExhausted {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNonceExhausted)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+// headerGetter retrieves a block header by block hash.
+type headerGetter = consensus.HeaderGetter
+
+// CalcNextBits returns bits which a block built on top of given parent must
+// have according to the retarget algorithm selected by chain parameters.
+func CalcNextBits(chainParams *params.ChainParams, parent types.BlockHeader, getHeader headerGetter) (uint32, error) {
+	switch chainParams.RetargetAlgorithm {
+	case params.RETARGET_BITCOIN:
+		return calcNextBitsBitcoin(chainParams, parent, getHeader)
+	case params.RETARGET_DARK_GRAVITY_WAVE:
+		return calcNextBitsDGW(chainParams, parent, getHeader)
+	case params.RETARGET_NONE:
+		return parent.Bits, nil
+	}
+	return 0, errors.New(fmt.Sprintf("unknown retarget algorithm %d", chainParams.RetargetAlgorithm))
+}
+
+// calcNextBitsBitcoin keeps the difficulty during RetargetInterval blocks and
+// then scales the target by the ratio of the actual time the interval took to
+// the expected one. The adjustment is limited to a factor of 4 in each direction.
+func calcNextBitsBitcoin(chainParams *params.ChainParams, parent types.BlockHeader, getHeader headerGetter) (uint32, error) {
+	if (parent.Height+1)%chainParams.RetargetInterval != 0 {
+		return parent.Bits, nil
+	}
+
+	// Go back to the first block of the interval.
+	first := parent
+	var err error
+	for i := 0; i < chainParams.RetargetInterval-1; i++ {
+		first, err = getHeader(first.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+	targetTimespan := int64(chainParams.RetargetInterval) * chainParams.TargetSpacing
+	actualTimespan := clampTimespan(parent.Timestamp-first.Timestamp, targetTimespan/4, targetTimespan*4)
+	return retarget(chainParams, CompactToBig(parent.Bits), actualTimespan, targetTimespan), nil
+}
+
+// calcNextBitsDGW implements DarkGravityWave v3 used by Dash: the target is
+// a weighted average of targets of DGWPastBlocks last blocks, scaled by the
+// ratio of the time these blocks took to the expected one. The adjustment is
+// limited to a factor of 3 in each direction.
+func calcNextBitsDGW(chainParams *params.ChainParams, parent types.BlockHeader, getHeader headerGetter) (uint32, error) {
+	pastBlocks := chainParams.DGWPastBlocks
+	if parent.Height < pastBlocks {
+		return BigToCompact(chainParams.PowLimit), nil
+	}
+	header := parent
+	averageTarget := new(big.Int)
+	var err error
+	for count := 1; count <= pastBlocks; count++ {
+		target := CompactToBig(header.Bits)
+		if count == 1 {
+			averageTarget.Set(target)
+		} else {
+			averageTarget.Mul(averageTarget, big.NewInt(int64(count)))
+			averageTarget.Add(averageTarget, target)
+			averageTarget.Div(averageTarget, big.NewInt(int64(count+1)))
+		}
+		if count != pastBlocks {
+			header, err = getHeader(header.PrevBlockHash)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	targetTimespan := int64(pastBlocks) * chainParams.TargetSpacing
+	actualTimespan := clampTimespan(parent.Timestamp-header.Timestamp, targetTimespan/3, targetTimespan*3)
+	return retarget(chainParams, averageTarget, actualTimespan, targetTimespan), nil
+}
+
+func clampTimespan(timespan, min, max int64) int64 {
+	if timespan < min {
+		return min
+	}
+	if timespan > max {
+		return max
+	}
+	return timespan
+}
+
+// retarget scales given target by actualTimespan / targetTimespan,
+// the result is limited by proof of work limit of the network.
+func retarget(chainParams *params.ChainParams, target *big.Int, actualTimespan, targetTimespan int64) uint32 {
+	newTarget := new(big.Int).Mul(target, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+	if newTarget.Cmp(chainParams.PowLimit) > 0 {
+		newTarget.Set(chainParams.PowLimit)
+	}
+	return BigToCompact(newTarget)
+}
+
+// CalcPastMedianTime returns the median timestamp of the last
+// vars.MEDIAN_TIME_SPAN blocks ending with given header.
+func CalcPastMedianTime(header types.BlockHeader, getHeader headerGetter) (int64, error) {
+	timestamps := []int64{header.Timestamp}
+	var err error
+	for len(timestamps) < vars.MEDIAN_TIME_SPAN && len(header.PrevBlockHash) > 0 {
+		header, err = getHeader(header.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, header.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return timestamps[len(timestamps)/2], nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// newTestHeaders builds a chain of count headers with given bits
+// where each block is found spacing seconds after the previous one.
+func newTestHeaders(count int, bits uint32, spacing int64) ([]types.BlockHeader, headerGetter) {
+	headers := make([]types.BlockHeader, count)
+	byHash := make(map[string]types.BlockHeader)
+	var prevHash []byte
+	for i := range headers {
+		headers[i] = types.BlockHeader{
+			PrevBlockHash: prevHash,
+			Timestamp:     1500000000 + int64(i)*spacing,
+			Bits:          bits,
+			Height:        i,
+		}
+		prevHash = utils.IntToHex(int64(i + 1))
+		byHash[hex.EncodeToString(prevHash)] = headers[i]
+	}
+	return headers, func(hash []byte) (types.BlockHeader, error) {
+		header, ok := byHash[hex.EncodeToString(hash)]
+		if !ok {
+			return header, errors.New("header is not found")
+		}
+		return header, nil
+	}
+}
+
+func TestCalcNextBitsBitcoin(test *testing.T) {
+	chainParams := params.TestNetParams
+	chainParams.RetargetInterval = 10
+	bits := BigToCompact(new(big.Int).Rsh(chainParams.PowLimit, 4))
+
+	// Blocks are found twice as fast as expected, so the target is halved.
+	headers, getHeader := newTestHeaders(10, bits, chainParams.TargetSpacing/2)
+	actual, err := CalcNextBits(&chainParams, headers[8], getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if actual != bits {
+		test.Errorf("bits are changed before retarget interval:\nactual:\n%08x\nexpected:\n%08x", actual, bits)
+	}
+	actual, err = CalcNextBits(&chainParams, headers[9], getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The interval consists of 10 blocks, but only 9 spacings are measured.
+	expected := new(big.Int).Mul(CompactToBig(bits), big.NewInt(9*chainParams.TargetSpacing/2))
+	expected.Div(expected, big.NewInt(10*chainParams.TargetSpacing))
+	if actual != BigToCompact(expected) {
+		test.Errorf("invalid bits:\nactual:\n%08x\nexpected:\n%08x", actual, BigToCompact(expected))
+	}
+
+	// Difficulty can not fall below the limit.
+	headers, getHeader = newTestHeaders(10, BigToCompact(chainParams.PowLimit), chainParams.TargetSpacing*10)
+	actual, err = CalcNextBits(&chainParams, headers[9], getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if actual != BigToCompact(chainParams.PowLimit) {
+		test.Errorf("invalid bits:\nactual:\n%08x\nexpected:\n%08x", actual, BigToCompact(chainParams.PowLimit))
+	}
+}
+
+func TestCalcNextBitsDGW(test *testing.T) {
+	chainParams := params.MainNetParams
+	bits := BigToCompact(new(big.Int).Rsh(chainParams.PowLimit, 8))
+	headers, getHeader := newTestHeaders(50, bits, chainParams.TargetSpacing)
+
+	// Not enough blocks to average.
+	actual, err := CalcNextBits(&chainParams, headers[10], getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if actual != BigToCompact(chainParams.PowLimit) {
+		test.Errorf("invalid bits:\nactual:\n%08x\nexpected:\n%08x", actual, BigToCompact(chainParams.PowLimit))
+	}
+
+	// Blocks come on time, the target is scaled by 23 measured spacings out of 24.
+	actual, err = CalcNextBits(&chainParams, headers[49], getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	expected := new(big.Int).Mul(CompactToBig(bits), big.NewInt(23))
+	expected.Div(expected, big.NewInt(24))
+	if actual != BigToCompact(expected) {
+		test.Errorf("invalid bits:\nactual:\n%08x\nexpected:\n%08x", actual, BigToCompact(expected))
+	}
+
+	// Blocks come much faster, the adjustment is limited by factor of 3.
+	headers, getHeader = newTestHeaders(50, bits, 1)
+	actual, err = CalcNextBits(&chainParams, headers[49], getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	expected = new(big.Int).Div(CompactToBig(bits), big.NewInt(3))
+	if actual != BigToCompact(expected) {
+		test.Errorf("invalid bits:\nactual:\n%08x\nexpected:\n%08x", actual, BigToCompact(expected))
+	}
+}
+
+func TestCalcPastMedianTime(test *testing.T) {
+	headers, getHeader := newTestHeaders(20, 0, 10)
+	actual, err := CalcPastMedianTime(headers[19], getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if actual != headers[14].Timestamp {
+		test.Errorf("invalid median time:\nactual:\n%d\nexpected:\n%d", actual, headers[14].Timestamp)
+	}
+}
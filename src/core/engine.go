@@ -0,0 +1,84 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+)
+
+// NewEngine returns the consensus engine selected by chain parameters.
+// Blocks of proof of work networks are mined by given miner, blocks of proof
+// of authority networks are signed with given private key. Engines created
+// without a miner or a key are used to verify seals of blocks.
+func NewEngine(chainParams *params.ChainParams, miner *Miner, signerKey []byte) (consensus.Engine, error) {
+	switch chainParams.Consensus {
+	case params.CONSENSUS_POW:
+		return NewPowEngine(chainParams, miner)
+	case params.CONSENSUS_POA:
+		return NewPoAEngine(chainParams, signerKey)
+	}
+	return nil, errors.New(fmt.Sprintf("unknown consensus %d", chainParams.Consensus))
+}
+
+// PowEngine seals blocks by searching for a nonce which makes the hash
+// of the header lower than the target set by the header's bits.
+type PowEngine struct {
+	params *params.ChainParams
+	hasher PowHasher
+	miner  *Miner
+}
+
+// NewPowEngine creates an engine which mines blocks with given miner,
+// the miner which uses all CPUs is used if it is nil.
+func NewPowEngine(chainParams *params.ChainParams, miner *Miner) (*PowEngine, error) {
+	hasher, err := NewPowHasher(chainParams.PowAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if miner == nil {
+		miner = &Miner{}
+	}
+	return &PowEngine{params: chainParams, hasher: hasher, miner: miner}, nil
+}
+
+// CalcNextBits returns bits calculated by the retarget algorithm of the network.
+func (e *PowEngine) CalcNextBits(parent types.BlockHeader, getHeader consensus.HeaderGetter) (uint32, error) {
+	return CalcNextBits(e.params, parent, getHeader)
+}
+
+// Seal mines the block, see Miner.NewBlock.
+func (e *PowEngine) Seal(ctx context.Context, block types.Block, getHeader consensus.HeaderGetter) (types.Block, error) {
+	return e.miner.NewBlock(ctx, block.BlockHeader, block.Transactions, e.hasher)
+}
+
+// VerifySeal checks that the block's target does not exceed the limit
+// of the network and that the block's hash satisfies it.
+func (e *PowEngine) VerifySeal(block types.Block) error {
+	worker := NewProofOfWork(block, e.hasher)
+	if worker.target.Cmp(e.params.PowLimit) > 0 {
+		return ruleError(ErrBadProofOfWork, "target of block %x is above the limit", block.Hash)
+	}
+	if !worker.Validate() {
+		return ruleError(ErrBadProofOfWork, "block %x does not satisfy proof of work", block.Hash)
+	}
+	return nil
+}
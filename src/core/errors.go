@@ -0,0 +1,135 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+)
+
+var (
+	// ErrOrphanBlock is returned when a block's parent is not known yet.
+	// Such block is kept in memory and added when its parent arrives.
+	ErrOrphanBlock = errors.New("parent of the block is not found")
+
+	// ErrBlockNotFound is returned when a requested block is not stored
+	// or the best chain has no block at requested height.
+	ErrBlockNotFound = errors.New("block is not found")
+
+	// ErrNotBestTip is returned when a block other than the last one of the
+	// best chain is disconnected.
+	ErrNotBestTip = errors.New("block is not the tip of the best chain")
+
+	// ErrTxNotFound is returned when a transaction is not found in the best chain.
+	ErrTxNotFound = errors.New("transaction is not found")
+
+	// ErrInsufficientFunds is returned when unspent outputs of a wallet
+	// do not cover the amount to send and the fee.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+
+	// ErrNotReplaceable is returned by BumpFee when the transaction
+	// does not signal that it may be replaced.
+	ErrNotReplaceable = errors.New("transaction is not replaceable")
+
+	// ErrNoChange is returned by BumpFee when the transaction has no change
+	// output or the change does not cover the higher fee.
+	ErrNoChange = errors.New("change does not cover the fee")
+
+	// ErrNotInTurn is returned by PoAEngine.Seal when the block
+	// at its height must be sealed by another signer.
+	ErrNotInTurn = errors.New("signer is not in turn")
+
+	// ErrNoSigners is returned when a proof of authority network has no signers.
+	ErrNoSigners = errors.New("no signers are configured")
+
+	// ErrNoSignerKey is returned by PoAEngine.Seal when the engine
+	// is created without a private key.
+	ErrNoSignerKey = errors.New("no signer key to seal blocks with")
+
+	ErrChainExists   = errors.New("blockchain already exists")
+	ErrChainNotFound = errors.New("no existing blockchain found, create one first")
+	ErrChainVersion  = errors.New("blockchain database has an unsupported format, remove it and sync the chain again")
+
+	// Block validation errors.
+	ErrBadProofOfWork   = errors.New("high-hash")
+	ErrBadHeight        = errors.New("bad-height")
+	ErrBadDiffBits      = errors.New("bad-diffbits")
+	ErrTimeTooOld       = errors.New("time-too-old")
+	ErrTimeTooNew       = errors.New("time-too-new")
+	ErrBadMerkleRoot    = errors.New("bad-txnmrklroot")
+	ErrBlockEmpty       = errors.New("bad-blk-length")
+	ErrBadCoinBase      = errors.New("bad-cb")
+	ErrBadCoinBaseValue = errors.New("bad-cb-amount")
+	ErrDuplicateTx      = errors.New("bad-txns-duplicate")
+	ErrNonFinalTx       = errors.New("bad-txns-nonfinal")
+	ErrSequenceLocked   = errors.New("non-BIP68-final")
+	ErrBlockTooBig      = errors.New("bad-blk-size")
+	ErrTooManySigOps    = errors.New("bad-blk-sigops")
+	ErrBadBlockHash     = errors.New("bad-blk-hash")
+	ErrBadSeal          = errors.New("bad-blk-seal")
+
+	// Transaction validation errors.
+	ErrBadTxHash          = errors.New("bad-txns-hash")
+	ErrTxTooBig           = errors.New("bad-txns-oversize")
+	ErrTxVInEmpty         = types.ErrTxVInEmpty
+	ErrTxVOutEmpty        = types.ErrTxVOutEmpty
+	ErrNegativeOutput     = errors.New("bad-txns-vout-negative")
+	ErrOutputTooLarge     = errors.New("bad-txns-vout-toolarge")
+	ErrOutTotalTooLarge   = errors.New("bad-txns-txouttotal-toolarge")
+	ErrInputsOutOfRange   = errors.New("bad-txns-inputvalues-outofrange")
+	ErrDuplicateInput     = errors.New("bad-txns-inputs-duplicate")
+	ErrMissingInput       = errors.New("bad-txns-inputs-missingorspent")
+	ErrInputsBelowOut     = errors.New("bad-txns-in-belowout")
+	ErrImmatureSpend      = errors.New("bad-txns-premature-spend-of-coinbase")
+	ErrInvalidSignature   = types.ErrInvalidSignature
+	ErrInvalidSigHashType = types.ErrInvalidSigHashType
+	ErrSigHashSingle      = types.ErrSigHashSingle
+
+	// Standardness errors, transactions which violate them are valid,
+	// but are not accepted to the memory pool and are not relayed.
+	ErrBadTxVersion         = errors.New("version")
+	ErrNonStandardScript    = errors.New("scriptpubkey")
+	ErrScriptSigSize        = errors.New("scriptsig-size")
+	ErrScriptSigNotPushOnly = errors.New("scriptsig-not-pushonly")
+	ErrMultiOpReturn        = errors.New("multi-op-return")
+	ErrMinRelayFee          = errors.New("min relay fee not met")
+)
+
+// RuleError is returned when a block or a transaction violates a consensus rule
+// or a standardness policy. Reason holds one of the errors declared above.
+type RuleError struct {
+	Reason      error
+	Description string
+}
+
+func (e RuleError) Error() string {
+	if e.Description == "" {
+		return e.Reason.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Reason.Error(), e.Description)
+}
+
+func ruleError(reason error, format string, args ...interface{}) RuleError {
+	return RuleError{Reason: reason, Description: fmt.Sprintf(format, args...)}
+}
+
+// IsRuleError reports whether given error is a RuleError caused by given reason.
+func IsRuleError(err error, reason error) bool {
+	ruleErr, ok := err.(RuleError)
+	return ok && ruleErr.Reason == reason
+}
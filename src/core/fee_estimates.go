@@ -0,0 +1,40 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/fees"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// LoadFeeEstimator restores the fee estimator saved by SaveFeeEstimator.
+// A new estimator is returned if none is saved.
+func (bc *BlockChain) LoadFeeEstimator() (*fees.Estimator, error) {
+	data, err := bc.db.Get(utils.FEE_ESTIMATOR_KEY, utils.FEE_ESTIMATES_BUCKET)
+	if err == db_pkg.ErrBucketNotFound || err == db_pkg.ErrKeyNotFound {
+		return fees.NewEstimator(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fees.DeserializeEstimator(data)
+}
+
+// SaveFeeEstimator writes data of the fee estimator to the database.
+func (bc *BlockChain) SaveFeeEstimator(estimator *fees.Estimator) error {
+	return bc.db.Put(utils.FEE_ESTIMATOR_KEY, estimator.Serialize(), utils.FEE_ESTIMATES_BUCKET, false)
+}
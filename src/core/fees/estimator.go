@@ -0,0 +1,351 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package fees implements estimation of fee rates transactions must pay
+// to be included in a block within a given number of blocks.
+//
+// Transactions accepted to the memory pool are grouped into buckets by their
+// fee rate. When a block includes a tracked transaction, the number of blocks
+// it waited for is recorded in its bucket. The estimate for a target is the
+// lowest fee rate of buckets in which most transactions were confirmed within
+// the target. Older data decays, so the estimator follows recent conditions.
+// Last processed blocks can be rolled back when they are disconnected from
+// the best chain.
+package fees
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+const (
+	// MAX_CONFIRM_TARGET is the greatest number of blocks fees are estimated for,
+	// transactions which wait longer are counted as not confirmed.
+	MAX_CONFIRM_TARGET = 25
+
+	// DEFAULT_CONFIRM_TARGET is the number of blocks used when the user
+	// does not choose a fee rate.
+	DEFAULT_CONFIRM_TARGET = 6
+
+	// Bounds of fee rate buckets grow by FEE_SPACING from vars.MIN_FEE_PER_BYTE
+	// up to MAX_FEE_PER_BYTE, higher fee rates fall into the last bucket.
+	FEE_SPACING      = 1.1
+	MAX_FEE_PER_BYTE = 10000 * vars.MIN_FEE_PER_BYTE
+
+	// Counters are multiplied by DECAY on every block, so data
+	// of the last few hundreds blocks dominates the estimate.
+	DECAY = 0.998
+
+	// SUCCESS_THRESHOLD is the share of transactions of a fee rate range which
+	// must be confirmed within the target, SUFFICIENT_TXS is the least number
+	// of transactions, decayed, the range must have to be taken into account.
+	SUCCESS_THRESHOLD = 0.85
+	SUFFICIENT_TXS    = 1.0
+
+	// MAX_UNDO_BLOCKS is the number of last processed blocks which can be
+	// rolled back, deeper reorganizations are not rolled back completely.
+	MAX_UNDO_BLOCKS = MAX_CONFIRM_TARGET
+)
+
+var (
+	ErrInvalidTarget    = errors.New("confirmation target is out of range")
+	ErrInsufficientData = errors.New("insufficient data to estimate fee")
+	ErrInvalidState     = errors.New("fee estimator state does not match buckets")
+)
+
+// feeBuckets holds lower bounds of fee rate buckets in ascending order.
+var feeBuckets = newFeeBuckets()
+
+func newFeeBuckets() []amount.Amount {
+	var buckets []amount.Amount
+	for bound := float64(vars.MIN_FEE_PER_BYTE); bound < float64(MAX_FEE_PER_BYTE); bound *= FEE_SPACING {
+		buckets = append(buckets, amount.Amount(bound))
+	}
+	return buckets
+}
+
+// bucketIndex returns index of the bucket given fee rate falls into.
+func bucketIndex(feePerByte amount.Amount) int {
+	i := 0
+	for i+1 < len(feeBuckets) && feeBuckets[i+1] <= feePerByte {
+		i++
+	}
+	return i
+}
+
+type trackedTx struct {
+	Height int
+	Bucket int
+}
+
+// confirmTarget returns the least target a tracked transaction
+// included in a block at given height is confirmed within.
+func (tx trackedTx) confirmTarget(height int) int {
+	if height-tx.Height < 1 {
+		return 1
+	}
+	return height - tx.Height
+}
+
+// blockUndo holds transactions a processed block stopped tracking,
+// so the block can be rolled back.
+type blockUndo struct {
+	Hash      []byte
+	Confirmed map[string]trackedTx
+	Expired   map[string]trackedTx
+}
+
+// estimatorState is the part of the estimator which is saved between runs.
+type estimatorState struct {
+	BestHeight int
+
+	// Confirmed[t-1][i] is the number of transactions of bucket i
+	// confirmed within t blocks, Total[i] is the number of transactions
+	// of bucket i which were either confirmed or expired.
+	Confirmed [][]float64
+	Total     []float64
+
+	// Txs holds transactions of the memory pool waiting for
+	// confirmation keyed by their hashes.
+	Txs map[string]trackedTx
+
+	// Blocks holds undo data of consecutive processed blocks up to
+	// the best one, which is the last.
+	Blocks []blockUndo
+}
+
+// Estimator learns how long transactions of different fee rates wait for
+// confirmation and estimates fee rates for confirmation targets.
+// It is safe for concurrent use.
+type Estimator struct {
+	mutex sync.Mutex
+	state estimatorState
+}
+
+func NewEstimator() *Estimator {
+	state := estimatorState{
+		BestHeight: -1,
+		Confirmed:  make([][]float64, MAX_CONFIRM_TARGET),
+		Total:      make([]float64, len(feeBuckets)),
+		Txs:        make(map[string]trackedTx),
+	}
+	for i := range state.Confirmed {
+		state.Confirmed[i] = make([]float64, len(feeBuckets))
+	}
+	return &Estimator{state: state}
+}
+
+// BestHeight returns height of the last processed block, -1 if there is none.
+func (e *Estimator) BestHeight() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.state.BestHeight
+}
+
+// BestHash returns hash of the last processed block, nil if there is none
+// or the block can not be rolled back.
+func (e *Estimator) BestHash() []byte {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if len(e.state.Blocks) == 0 {
+		return nil
+	}
+	return e.state.Blocks[len(e.state.Blocks)-1].Hash
+}
+
+// ProcessTransaction starts tracking a transaction accepted to the memory pool
+// when the best chain has given height. Transactions which are tracked already
+// are ignored.
+func (e *Estimator) ProcessTransaction(hash []byte, feePerByte amount.Amount, height int) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	txID := hex.EncodeToString(hash)
+	if _, ok := e.state.Txs[txID]; ok {
+		return
+	}
+	e.state.Txs[txID] = trackedTx{Height: height, Bucket: bucketIndex(feePerByte)}
+}
+
+// RemoveTransaction stops tracking a transaction removed from the memory pool
+// without being confirmed, e.g. because it conflicts with a block.
+func (e *Estimator) RemoveTransaction(hash []byte) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.state.Txs, hex.EncodeToString(hash))
+}
+
+// ProcessBlock records confirmations of tracked transactions included in a block
+// of given hash at given height. Blocks at heights which were processed already
+// are ignored to not count transactions twice, blocks disconnected from the best
+// chain must be rolled back by DisconnectBlock first.
+func (e *Estimator) ProcessBlock(height int, hash []byte, txHashes [][]byte) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if height <= e.state.BestHeight {
+		return
+	}
+	if height != e.state.BestHeight+1 {
+		e.state.Blocks = nil
+	}
+	e.state.BestHeight = height
+	undo := blockUndo{
+		Hash:      hash,
+		Confirmed: make(map[string]trackedTx),
+		Expired:   make(map[string]trackedTx),
+	}
+	for i := range e.state.Total {
+		e.state.Total[i] *= DECAY
+		for t := range e.state.Confirmed {
+			e.state.Confirmed[t][i] *= DECAY
+		}
+	}
+	for _, hash := range txHashes {
+		txID := hex.EncodeToString(hash)
+		tx, ok := e.state.Txs[txID]
+		if !ok {
+			continue
+		}
+		delete(e.state.Txs, txID)
+		undo.Confirmed[txID] = tx
+		for t := tx.confirmTarget(height); t <= MAX_CONFIRM_TARGET; t++ {
+			e.state.Confirmed[t-1][tx.Bucket]++
+		}
+		e.state.Total[tx.Bucket]++
+	}
+
+	// Transactions which were not confirmed within the greatest target
+	// are failures for all targets.
+	for txID, tx := range e.state.Txs {
+		if height-tx.Height >= MAX_CONFIRM_TARGET {
+			e.state.Total[tx.Bucket]++
+			delete(e.state.Txs, txID)
+			undo.Expired[txID] = tx
+		}
+	}
+	e.state.Blocks = append(e.state.Blocks, undo)
+	if len(e.state.Blocks) > MAX_UNDO_BLOCKS {
+		e.state.Blocks = e.state.Blocks[1:]
+	}
+}
+
+// DisconnectBlock rolls back the last processed block, which is disconnected
+// from the best chain. Transactions confirmed by the block are tracked again.
+// If undo data of the block is not kept, only the best height is moved back.
+func (e *Estimator) DisconnectBlock() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.state.BestHeight < 0 {
+		return
+	}
+	height := e.state.BestHeight
+	e.state.BestHeight--
+	if len(e.state.Blocks) == 0 {
+		return
+	}
+	undo := e.state.Blocks[len(e.state.Blocks)-1]
+	e.state.Blocks = e.state.Blocks[:len(e.state.Blocks)-1]
+	for txID, tx := range undo.Confirmed {
+		for t := tx.confirmTarget(height); t <= MAX_CONFIRM_TARGET; t++ {
+			e.state.Confirmed[t-1][tx.Bucket]--
+		}
+		e.state.Total[tx.Bucket]--
+		e.state.Txs[txID] = tx
+	}
+	for txID, tx := range undo.Expired {
+		e.state.Total[tx.Bucket]--
+		e.state.Txs[txID] = tx
+	}
+	for i := range e.state.Total {
+		e.state.Total[i] /= DECAY
+		for t := range e.state.Confirmed {
+			e.state.Confirmed[t][i] /= DECAY
+		}
+	}
+}
+
+// EstimateFee returns the lowest fee rate per byte at which transactions were
+// confirmed within given number of blocks in most cases. ErrInsufficientData
+// is returned if not enough transactions were tracked to estimate it.
+func (e *Estimator) EstimateFee(target int) (amount.Amount, error) {
+	if target < 1 || target > MAX_CONFIRM_TARGET {
+		return 0, ErrInvalidTarget
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Buckets are grouped from the highest fee rate until each group has
+	// enough transactions, the search stops at the first group which fails.
+	confirmed := e.state.Confirmed[target-1]
+	best := -1
+	groupConfirmed, groupTotal := 0.0, 0.0
+	for i := len(feeBuckets) - 1; i >= 0; i-- {
+		groupConfirmed += confirmed[i]
+		groupTotal += e.state.Total[i]
+		if groupTotal < SUFFICIENT_TXS {
+			continue
+		}
+		if groupConfirmed/groupTotal < SUCCESS_THRESHOLD {
+			break
+		}
+		best = i
+		groupConfirmed, groupTotal = 0, 0
+	}
+	if best < 0 {
+		return 0, ErrInsufficientData
+	}
+	return feeBuckets[best], nil
+}
+
+// Serialize encodes the estimator's data, so it can be restored after restart.
+func (e *Estimator) Serialize() []byte {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var buff bytes.Buffer
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(e.state)
+	if err != nil {
+		log.Panic(err)
+	}
+	return buff.Bytes()
+}
+
+// DeserializeEstimator restores an estimator from data created by Serialize.
+func DeserializeEstimator(data []byte) (*Estimator, error) {
+	var state estimatorState
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&state)
+	if err != nil {
+		return nil, err
+	}
+	if len(state.Total) != len(feeBuckets) || len(state.Confirmed) != MAX_CONFIRM_TARGET {
+		return nil, ErrInvalidState
+	}
+	for _, confirmed := range state.Confirmed {
+		if len(confirmed) != len(feeBuckets) {
+			return nil, ErrInvalidState
+		}
+	}
+	if state.Txs == nil {
+		state.Txs = make(map[string]trackedTx)
+	}
+	return &Estimator{state: state}, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package fees
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+func TestBucketIndex(test *testing.T) {
+	data := []struct {
+		feePerByte amount.Amount
+		expected   int
+	}{
+		{0, 0},
+		{vars.MIN_FEE_PER_BYTE, 0},
+		{feeBuckets[1] - 1, 0},
+		{feeBuckets[1], 1},
+		{feeBuckets[5] + 1, 5},
+		{MAX_FEE_PER_BYTE * 2, len(feeBuckets) - 1},
+	}
+	for i, item := range data {
+		if actual := bucketIndex(item.feePerByte); actual != item.expected {
+			test.Errorf("fees.TestBucketIndex[%d]: invalid index:\nactual:\n%d\nexpected:\n%d", i, actual, item.expected)
+		}
+	}
+}
+
+func TestEstimator_EstimateFee(test *testing.T) {
+	estimator := NewEstimator()
+	if _, err := estimator.EstimateFee(1); err != ErrInsufficientData {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrInsufficientData)
+	}
+	if _, err := estimator.EstimateFee(MAX_CONFIRM_TARGET + 1); err != ErrInvalidTarget {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrInvalidTarget)
+	}
+
+	// Transactions paying the high fee rate are confirmed in the next block,
+	// ones paying the low fee rate wait for 5 blocks.
+	lowFee, highFee := feeBuckets[0], feeBuckets[10]
+	for height := 1; height <= 60; height++ {
+		included := [][]byte{{byte(height - 1), 1}}
+		if height > 5 {
+			included = append(included, []byte{byte(height - 5), 0})
+		}
+		estimator.ProcessBlock(height, []byte{byte(height)}, included)
+		estimator.ProcessTransaction([]byte{byte(height), 0}, lowFee, height)
+		estimator.ProcessTransaction([]byte{byte(height), 1}, highFee, height)
+	}
+	data := []struct {
+		target   int
+		expected amount.Amount
+	}{
+		{1, highFee},
+		{4, highFee},
+		{5, lowFee},
+		{MAX_CONFIRM_TARGET, lowFee},
+	}
+	for i, item := range data {
+		actual, err := estimator.EstimateFee(item.target)
+		if err != nil || actual != item.expected {
+			test.Errorf("fees.TestEstimator_EstimateFee[%d]: invalid estimate:\nactual:\n%s %v\nexpected:\n%s <nil>", i, actual, err, item.expected)
+		}
+	}
+
+	restored, err := DeserializeEstimator(estimator.Serialize())
+	if err != nil {
+		test.Fatal(err)
+	}
+	if restored.BestHeight() != estimator.BestHeight() {
+		test.Errorf("invalid best height:\nactual:\n%d\nexpected:\n%d", restored.BestHeight(), estimator.BestHeight())
+	}
+	if actual, err := restored.EstimateFee(1); err != nil || actual != highFee {
+		test.Errorf("invalid estimate:\nactual:\n%s %v\nexpected:\n%s <nil>", actual, err, highFee)
+	}
+}
+
+func TestEstimator_DisconnectBlock(test *testing.T) {
+	estimator := NewEstimator()
+	estimator.ProcessTransaction([]byte{0}, feeBuckets[0], 0)
+	estimator.ProcessTransaction([]byte{1}, feeBuckets[10], 0)
+	estimator.ProcessTransaction([]byte{2}, feeBuckets[10], 0)
+	estimator.ProcessBlock(1, []byte{1}, [][]byte{{2}})
+	for height := 2; height < MAX_CONFIRM_TARGET; height++ {
+		estimator.ProcessBlock(height, []byte{byte(height)}, nil)
+	}
+	expected := estimatorState{
+		BestHeight: estimator.state.BestHeight,
+		Total:      append([]float64{}, estimator.state.Total...),
+		Txs:        make(map[string]trackedTx),
+	}
+	for _, confirmed := range estimator.state.Confirmed {
+		expected.Confirmed = append(expected.Confirmed, append([]float64{}, confirmed...))
+	}
+	for txID, tx := range estimator.state.Txs {
+		expected.Txs[txID] = tx
+	}
+
+	// The block confirms one transaction and the other one expires.
+	estimator.ProcessBlock(MAX_CONFIRM_TARGET, []byte{0xff}, [][]byte{{1}})
+	if len(estimator.state.Txs) != 0 {
+		test.Fatalf("invalid number of tracked transactions:\nactual:\n%d\nexpected:\n0", len(estimator.state.Txs))
+	}
+	estimator.DisconnectBlock()
+	if actual, expectedHash := estimator.BestHash(), []byte{MAX_CONFIRM_TARGET - 1}; !bytes.Equal(actual, expectedHash) {
+		test.Errorf("invalid best hash:\nactual:\n%x\nexpected:\n%x", actual, expectedHash)
+	}
+	if estimator.state.BestHeight != expected.BestHeight {
+		test.Errorf("invalid best height:\nactual:\n%d\nexpected:\n%d", estimator.state.BestHeight, expected.BestHeight)
+	}
+	if !reflect.DeepEqual(estimator.state.Txs, expected.Txs) {
+		test.Errorf("invalid tracked transactions:\nactual:\n%v\nexpected:\n%v", estimator.state.Txs, expected.Txs)
+	}
+	for i := range expected.Total {
+		equal := math.Abs(estimator.state.Total[i]-expected.Total[i]) < 1e-9
+		for t := range expected.Confirmed {
+			equal = equal && math.Abs(estimator.state.Confirmed[t][i]-expected.Confirmed[t][i]) < 1e-9
+		}
+		if !equal {
+			test.Errorf("invalid counters of bucket %d after rollback", i)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// Height index maps heights of blocks of the best chain to their hashes.
+// It is updated in the same db transaction as blocks are connected and
+// disconnected, so it always matches the chain ending with the last block.
+
+func heightKey(height int) []byte {
+	return utils.IntToHex(int64(height))
+}
+
+func putHeightIndex(tx *db_pkg.Tx, height int, hash []byte) error {
+	b, err := tx.CreateBucketIfNotExists(utils.HEIGHT_INDEX_BUCKET)
+	if err != nil {
+		return err
+	}
+	return b.Put(heightKey(height), hash)
+}
+
+func deleteHeightIndex(tx *db_pkg.Tx, height int) error {
+	b := tx.Bucket(utils.HEIGHT_INDEX_BUCKET)
+	if b == nil {
+		return nil
+	}
+	return b.Delete(heightKey(height))
+}
+
+// buildHeightIndex creates the height index of blocks which were stored
+// before the index was introduced, walking the best chain from its tip.
+func buildHeightIndex(db *db_pkg.DB) error {
+	return db.Update(func(tx *db_pkg.Tx) error {
+		if tx.Bucket(utils.HEIGHT_INDEX_BUCKET) != nil {
+			return nil
+		}
+		blocks := tx.Bucket(utils.BLOCKS_BUCKET)
+		if blocks == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+		}
+		getHeader := headerGetterFromTx(tx)
+		hash := blocks.Get(utils.LAST_BLOCK_HASH)
+		for len(hash) > 0 {
+			header, err := getHeader(hash)
+			if err != nil {
+				return err
+			}
+			err = putHeightIndex(tx, header.Height, hash)
+			if err != nil {
+				return err
+			}
+			hash = header.PrevBlockHash
+		}
+		return nil
+	})
+}
+
+// GetBlockHashByHeight returns hash of the best chain's block at given height.
+func (bc *BlockChain) GetBlockHashByHeight(height int) ([]byte, error) {
+	hash, err := bc.db.Get(heightKey(height), utils.HEIGHT_INDEX_BUCKET)
+	if err == db_pkg.ErrKeyNotFound || err == db_pkg.ErrBucketNotFound {
+		return nil, ErrBlockNotFound
+	}
+	return hash, err
+}
+
+// GetBlockByHeight returns the best chain's block at given height.
+func (bc *BlockChain) GetBlockByHeight(height int) (types.Block, error) {
+	hash, err := bc.GetBlockHashByHeight(height)
+	if err != nil {
+		return types.Block{}, err
+	}
+	return bc.GetBlock(hash)
+}
+
+// IsInMainChain reports whether a block by given hash belongs to the best chain.
+func (bc *BlockChain) IsInMainChain(hash []byte) bool {
+	header, err := bc.GetBlockHeader(hash)
+	if err != nil {
+		return false
+	}
+	mainHash, err := bc.GetBlockHashByHeight(header.Height)
+	return err == nil && bytes.Compare(mainHash, hash) == 0
+}
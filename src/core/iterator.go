@@ -17,7 +17,6 @@ package core
 
 import (
 	"encoding/hex"
-	"log"
 
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
 	"github.com/YuriyLisovskiy/blockchain-go/src/db"
@@ -29,14 +28,18 @@ type BlockChainIterator struct {
 	db          *db.DB
 }
 
-func (bci *BlockChainIterator) Next() types.Block {
+// Next returns the current block and moves the iterator to its parent.
+func (bci *BlockChainIterator) Next() (types.Block, error) {
 	encodedBlock, err := bci.db.Get(bci.currentHash, utils.BLOCKS_BUCKET)
 	if err != nil {
-		log.Panic(err)
+		return types.Block{}, err
+	}
+	block, err := DeserializeBlock(encodedBlock)
+	if err != nil {
+		return types.Block{}, err
 	}
-	block := DeserializeBlock(encodedBlock)
 	bci.currentHash = block.PrevBlockHash
-	return block
+	return block, nil
 
 /*
 	err := i.db.View(func(tx *db_pkg.Tx) error {
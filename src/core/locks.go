@@ -0,0 +1,180 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// sequenceLock holds the last height and median time at which a transaction
+// is still locked by relative lock times of its inputs, -1 means no lock.
+type sequenceLock struct {
+	Height int
+	Time   int64
+}
+
+// medianTimeGetter returns median time of the last blocks of the best
+// chain ending with the block at given height.
+type medianTimeGetter func(height int) (int64, error)
+
+func medianTimeGetterFromTx(tx *db_pkg.Tx) medianTimeGetter {
+	getHeader := headerGetterFromTx(tx)
+	return func(height int) (int64, error) {
+		b := tx.Bucket(utils.HEIGHT_INDEX_BUCKET)
+		if b == nil {
+			return 0, errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.HEIGHT_INDEX_BUCKET))
+		}
+		hash := b.Get(heightKey(height))
+		if hash == nil {
+			return 0, ErrBlockNotFound
+		}
+		header, err := getHeader(hash)
+		if err != nil {
+			return 0, err
+		}
+		return CalcPastMedianTime(header, getHeader)
+	}
+}
+
+// nextBlockContext returns height of the next block of the best chain
+// and median time its transactions are checked against.
+func nextBlockContext(tx *db_pkg.Tx) (int, int64, error) {
+	b := tx.Bucket(utils.BLOCKS_BUCKET)
+	if b == nil {
+		return 0, 0, errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+	}
+	getHeader := headerGetterFromTx(tx)
+	tip, err := getHeader(b.Get(utils.LAST_BLOCK_HASH))
+	if err != nil {
+		return 0, 0, err
+	}
+	medianTime, err := CalcPastMedianTime(tip, getHeader)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tip.Height + 1, medianTime, nil
+}
+
+// calcSequenceLock calculates the lock set by relative lock times of the
+// transaction's inputs, see BIP68. inputHeights holds heights of blocks which
+// created outputs spent by the inputs. Relative lock times are enforced for
+// transactions of vars.TX_VERSION and higher only.
+func calcSequenceLock(tx types.Transaction, inputHeights []int, getMedianTime medianTimeGetter) (sequenceLock, error) {
+	lock := sequenceLock{Height: -1, Time: -1}
+	if tx.IsCoinBase() || tx.Version < vars.TX_VERSION {
+		return lock, nil
+	}
+	for i, vin := range tx.VIn {
+		if vin.Sequence&vars.SEQUENCE_LOCKTIME_DISABLE_FLAG != 0 {
+			continue
+		}
+		value := int64(vin.Sequence & vars.SEQUENCE_LOCKTIME_MASK)
+		if vin.Sequence&vars.SEQUENCE_LOCKTIME_TYPE_FLAG == 0 {
+			height := inputHeights[i] + int(value) - 1
+			if height > lock.Height {
+				lock.Height = height
+			}
+			continue
+		}
+
+		// Time interval starts at median time of the block preceding the one
+		// which created the output.
+		prevHeight := inputHeights[i] - 1
+		if prevHeight < 0 {
+			prevHeight = 0
+		}
+		medianTime, err := getMedianTime(prevHeight)
+		if err != nil {
+			return lock, err
+		}
+		lockTime := medianTime + value<<vars.SEQUENCE_LOCKTIME_GRANULARITY - 1
+		if lockTime > lock.Time {
+			lock.Time = lockTime
+		}
+	}
+	return lock, nil
+}
+
+// checkSequenceLock checks that relative lock times of the transaction's
+// inputs are passed by a block at given height with given median time of
+// previous blocks. Outputs which are not found are considered created at
+// the same height, as outputs of memory pool transactions.
+func checkSequenceLock(tx types.Transaction, height int, medianTime int64, getOutput outputGetter, getMedianTime medianTimeGetter) error {
+	if tx.IsCoinBase() || tx.Version < vars.TX_VERSION {
+		return nil
+	}
+	inputHeights := make([]int, len(tx.VIn))
+	for i, vin := range tx.VIn {
+		entry, ok, err := getOutput(vin.PreviousTx, vin.VOut)
+		if err != nil {
+			return err
+		}
+		inputHeights[i] = height
+		if ok {
+			inputHeights[i] = entry.Height
+		}
+	}
+	lock, err := calcSequenceLock(tx, inputHeights, getMedianTime)
+	if err != nil {
+		return err
+	}
+	if lock.Height >= height || lock.Time >= medianTime {
+		return ruleError(ErrSequenceLocked, "transaction %x is locked until height %d and time %d", tx.Hash, lock.Height, lock.Time)
+	}
+	return nil
+}
+
+// checkTransactionLocks checks that lock time of the transaction, relative
+// lock times of its inputs and maturity of coinbase outputs it spends are
+// passed by a block at given height.
+func checkTransactionLocks(tx types.Transaction, height int, medianTime int64, chainParams *params.ChainParams, getOutput outputGetter, getMedianTime medianTimeGetter) error {
+	if !tx.IsFinal(height, medianTime) {
+		return ruleError(ErrNonFinalTx, "transaction %x is locked until %d", tx.Hash, tx.LockTime)
+	}
+	err := checkCoinBaseMaturity(tx, height, chainParams.CoinbaseMaturity, getOutput)
+	if err != nil {
+		return err
+	}
+	return checkSequenceLock(tx, height, medianTime, getOutput, getMedianTime)
+}
+
+// CheckTransactionLocks checks that the transaction can be included in the
+// next block of the best chain, i.e. its lock time, relative lock times of
+// its inputs and maturity of spent coinbase outputs have passed. It is used
+// before the transaction is accepted to the memory pool.
+func (bc *BlockChain) CheckTransactionLocks(transaction types.Transaction) error {
+	return bc.db.View(func(tx *db_pkg.Tx) error {
+		height, medianTime, err := nextBlockContext(tx)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket(vars.UTXO_BUCKET)
+		if b == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UTXO_BUCKET))
+		}
+		getOutput := func(txHash []byte, index int) (utxoEntry, bool, error) {
+			return getUnspentOutput(b, txHash, index)
+		}
+		return checkTransactionLocks(transaction, height, medianTime, bc.params, getOutput, medianTimeGetterFromTx(tx))
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+func TestCalcSequenceLock(test *testing.T) {
+	// Median time of the block at height h is 1000*h.
+	getMedianTime := func(height int) (int64, error) {
+		return int64(1000 * height), nil
+	}
+	timeLock := uint32(vars.SEQUENCE_LOCKTIME_TYPE_FLAG | 2)
+	data := []struct {
+		version      int
+		sequences    []uint32
+		inputHeights []int
+		expected     sequenceLock
+	}{
+		{vars.TX_VERSION, []uint32{5}, []int{10}, sequenceLock{Height: 14, Time: -1}},
+		{vars.TX_VERSION, []uint32{5, 2}, []int{10, 20}, sequenceLock{Height: 21, Time: -1}},
+		{vars.TX_VERSION, []uint32{timeLock}, []int{10}, sequenceLock{Height: -1, Time: 9000 + 2<<vars.SEQUENCE_LOCKTIME_GRANULARITY - 1}},
+		{vars.TX_VERSION, []uint32{vars.SEQUENCE_LOCKTIME_DISABLE_FLAG | 5}, []int{10}, sequenceLock{Height: -1, Time: -1}},
+		{1, []uint32{5}, []int{10}, sequenceLock{Height: -1, Time: -1}},
+	}
+	for i, item := range data {
+		tx := types.Transaction{Version: item.version}
+		for j, sequence := range item.sequences {
+			tx.VIn = append(tx.VIn, tx_io.TXInput{PreviousTx: []byte{byte(j + 1)}, Sequence: sequence})
+		}
+		lock, err := calcSequenceLock(tx, item.inputHeights, getMedianTime)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if lock != item.expected {
+			test.Errorf("core.TestCalcSequenceLock[%d]: invalid lock:\nactual:\n%v\nexpected:\n%v", i, lock, item.expected)
+		}
+	}
+}
+
+func TestBlockChain_CheckTransactionLocks(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The genesis output can be spent three blocks after the genesis block.
+	spend := types.Transaction{
+		Version:   vars.TX_VERSION,
+		VIn:       []tx_io.TXInput{{PreviousTx: genesis.Transactions[0].Hash, VOut: 0, Sequence: 3}},
+		VOut:      []tx_io.TXOutput{tx_io.NewTXOutput(10, string(w.GetAddress()))},
+		Timestamp: time.Now().UnixNano(),
+	}
+	spend = newTestSignedTx(test, bc, spend, w.PrivateKey)
+	if err := bc.CheckTransactionLocks(spend); !IsRuleError(err, ErrSequenceLocked) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrSequenceLocked)
+	}
+	locked := newTestBlock(test, []types.Transaction{newTestCoinBase(), spend}, genesis.Hash, 1)
+	if err := bc.AddBlock(locked); !IsRuleError(err, ErrSequenceLocked) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrSequenceLocked)
+	}
+
+	prevHash := genesis.Hash
+	for height := 1; height <= 2; height++ {
+		block := newTestBlock(test, []types.Transaction{newTestCoinBase()}, prevHash, height)
+		if err := bc.AddBlock(block); err != nil {
+			test.Fatal(err)
+		}
+		prevHash = block.Hash
+	}
+	if err := bc.CheckTransactionLocks(spend); err != nil {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+	unlocked := newTestBlock(test, []types.Transaction{newTestCoinBase(), spend}, prevHash, 3)
+	if err := bc.AddBlock(unlocked); err != nil {
+		test.Fatal(err)
+	}
+
+	// Lock time is enforced unless all inputs have final sequences.
+	lockTime := types.Transaction{
+		Version:  vars.TX_VERSION,
+		VIn:      []tx_io.TXInput{{PreviousTx: spend.Hash, VOut: 0}},
+		VOut:     []tx_io.TXOutput{tx_io.NewTXOutput(10, string(w.GetAddress()))},
+		LockTime: 10,
+	}
+	lockTime = newTestSignedTx(test, bc, lockTime, w.PrivateKey)
+	if err := bc.CheckTransactionLocks(lockTime); !IsRuleError(err, ErrNonFinalTx) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNonFinalTx)
+	}
+	lockTime.VIn[0].Sequence = vars.SEQUENCE_FINAL
+	lockTime = newTestSignedTx(test, bc, lockTime, w.PrivateKey)
+	if err := bc.CheckTransactionLocks(lockTime); err != nil {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mempool
+
+import "errors"
+
+var (
+	// ErrAlreadyHave is returned when the transaction is in the pool or among orphans.
+	ErrAlreadyHave = errors.New("txn-already-in-mempool")
+
+	// ErrCoinBase is returned for coinbase transactions, which are valid in blocks only.
+	ErrCoinBase = errors.New("coinbase")
+
+	// ErrConflict is returned when the transaction spends an output which is
+	// spent by a transaction of the pool already, and that transaction does
+	// not signal that it may be replaced.
+	ErrConflict = errors.New("txn-mempool-conflict")
+
+	// Replacement errors are returned when the transaction conflicts with
+	// replaceable transactions of the pool, but does not follow the rules
+	// of replacement, see Pool.checkReplacement.
+	ErrInsufficientFee              = errors.New("insufficient fee")
+	ErrTooManyReplacements          = errors.New("too many potential replacements")
+	ErrReplacementAddsUnconfirmed   = errors.New("replacement-adds-unconfirmed")
+	ErrReplacementSpendsConflicting = errors.New("bad-txns-spends-conflicting-tx")
+
+	// ErrPoolFull is returned when the pool reached its size limit and the
+	// transaction pays lower fee rate than transactions in the pool.
+	ErrPoolFull = errors.New("mempool full")
+
+	// ErrOrphanTx is returned when outputs spent by the transaction are not
+	// found. The transaction is kept as an orphan until its parents arrive.
+	ErrOrphanTx = errors.New("orphan transaction")
+
+	// ErrOrphanTooLarge is returned when an orphan transaction is too large to be kept.
+	ErrOrphanTooLarge = errors.New("orphan transaction is too large")
+)
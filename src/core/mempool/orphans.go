@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mempool
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+)
+
+type orphanTx struct {
+	tx    types.Transaction
+	added time.Time
+}
+
+// orphanPool keeps transactions whose parents are not known yet. Orphans are
+// indexed by hashes of transactions they spend, so they are found when one
+// of the parents arrives. It is guarded by the mutex of the Pool.
+type orphanPool struct {
+	txs    map[string]orphanTx
+	byPrev map[string]map[string]bool
+}
+
+func newOrphanPool() orphanPool {
+	return orphanPool{
+		txs:    make(map[string]orphanTx),
+		byPrev: make(map[string]map[string]bool),
+	}
+}
+
+func (op *orphanPool) has(txID string) bool {
+	_, ok := op.txs[txID]
+	return ok
+}
+
+// add puts given transaction to the pool. If the pool is full,
+// an arbitrary orphan is dropped, it can be requested again later.
+func (op *orphanPool) add(tx types.Transaction, now time.Time) error {
+	if tx.Size() > MAX_ORPHAN_TX_SIZE {
+		return ErrOrphanTooLarge
+	}
+	for txID := range op.txs {
+		if len(op.txs) < MAX_ORPHAN_TXS {
+			break
+		}
+		op.remove(txID)
+	}
+	txID := hex.EncodeToString(tx.Hash)
+	op.txs[txID] = orphanTx{tx: tx, added: now}
+	for _, vin := range tx.VIn {
+		prevID := hex.EncodeToString(vin.PreviousTx)
+		if op.byPrev[prevID] == nil {
+			op.byPrev[prevID] = make(map[string]bool)
+		}
+		op.byPrev[prevID][txID] = true
+	}
+	return nil
+}
+
+func (op *orphanPool) remove(txID string) {
+	orphan, ok := op.txs[txID]
+	if !ok {
+		return
+	}
+	delete(op.txs, txID)
+	for _, vin := range orphan.tx.VIn {
+		prevID := hex.EncodeToString(vin.PreviousTx)
+		delete(op.byPrev[prevID], txID)
+		if len(op.byPrev[prevID]) == 0 {
+			delete(op.byPrev, prevID)
+		}
+	}
+}
+
+// take removes and returns orphans which spend outputs of a transaction by given id.
+func (op *orphanPool) take(parentID string) []types.Transaction {
+	var children []types.Transaction
+	for txID := range op.byPrev[parentID] {
+		children = append(children, op.txs[txID].tx)
+		op.remove(txID)
+	}
+	return children
+}
+
+// expire removes orphans which were added earlier than given time.
+func (op *orphanPool) expire(before time.Time) {
+	for txID, orphan := range op.txs {
+		if orphan.added.Before(before) {
+			op.remove(txID)
+		}
+	}
+}
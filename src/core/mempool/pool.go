@@ -0,0 +1,574 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package mempool implements the pool of valid transactions which are not
+// included in blocks yet. The pool is safe for concurrent use.
+//
+// Transactions of the pool may spend outputs of each other, but no two of
+// them spend the same output. When the pool exceeds its size limit, the
+// transactions paying the lowest fee rate are evicted together with their
+// descendants. Transactions whose parents are not known are kept apart as
+// orphans until the parents are accepted.
+//
+// A transaction which spends an output spent by the pool already replaces
+// the spender if the spender signals replaceability and the new transaction
+// pays more, following BIP125.
+package mempool
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/fees"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+const (
+	// DEFAULT_MAX_SIZE is the default limit of the total size of pool's transactions in bytes.
+	DEFAULT_MAX_SIZE = 100 * 1000 * 1000
+
+	// DEFAULT_EXPIRY is the default time after which unconfirmed transactions are removed.
+	DEFAULT_EXPIRY = 14 * 24 * time.Hour
+
+	// Orphans are limited in number and size and are removed after ORPHAN_EXPIRY.
+	MAX_ORPHAN_TXS     = 100
+	MAX_ORPHAN_TX_SIZE = 100000
+	ORPHAN_EXPIRY      = 20 * time.Minute
+
+	// MAX_REPLACEMENT_EVICTIONS is the greatest number of transactions,
+	// including descendants, a single replacement can remove from the pool.
+	MAX_REPLACEMENT_EVICTIONS = 100
+)
+
+// Chain is the block chain transactions of the pool are validated against,
+// it is implemented by core.BlockChain.
+type Chain interface {
+	CheckUnconfirmedTransaction(tx types.Transaction, getUnconfirmed core.UnconfirmedOutputGetter) (amount.Amount, error)
+	GetBestHeight() (int, error)
+}
+
+type Config struct {
+	Chain Chain
+
+	// MaxSize is the limit of the total size of pool's transactions in bytes.
+	MaxSize int
+
+	// Expiry is the time after which unconfirmed transactions are removed.
+	Expiry time.Duration
+
+	// FeeEstimator, if set, tracks transactions accepted to the pool.
+	FeeEstimator *fees.Estimator
+}
+
+// TxDesc describes a transaction of the pool.
+type TxDesc struct {
+	Tx         types.Transaction
+	Fee        amount.Amount
+	Size       int
+	FeePerByte amount.Amount
+	SigOps     int
+
+	// Height is the height of the best chain when the transaction was added.
+	Height int
+	Added  time.Time
+}
+
+type Pool struct {
+	mutex  sync.RWMutex
+	config Config
+	txs    map[string]*TxDesc
+
+	// spent maps outputs spent by pool's transactions to ids of the spenders.
+	spent map[string]string
+
+	// byFeeRate holds pool's transactions in ascending order of fee rates.
+	byFeeRate []*TxDesc
+	size      int
+	orphans   orphanPool
+}
+
+// New creates an empty pool, zero limits of the config are set to defaults.
+func New(config Config) *Pool {
+	if config.MaxSize == 0 {
+		config.MaxSize = DEFAULT_MAX_SIZE
+	}
+	if config.Expiry == 0 {
+		config.Expiry = DEFAULT_EXPIRY
+	}
+	return &Pool{
+		config:  config,
+		txs:     make(map[string]*TxDesc),
+		spent:   make(map[string]string),
+		orphans: newOrphanPool(),
+	}
+}
+
+func outpoint(txHash []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txHash, index)
+}
+
+// lessFeeRate orders transactions by fee rate, transactions
+// of the same fee rate are ordered by their hashes.
+func lessFeeRate(a, b *TxDesc) bool {
+	if a.FeePerByte != b.FeePerByte {
+		return a.FeePerByte < b.FeePerByte
+	}
+	return bytes.Compare(a.Tx.Hash, b.Tx.Hash) < 0
+}
+
+// Count returns the number of transactions in the pool, orphans are not counted.
+func (p *Pool) Count() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return len(p.txs)
+}
+
+// Size returns the total size of pool's transactions in bytes.
+func (p *Pool) Size() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.size
+}
+
+// Have reports whether the transaction by given hash is in the pool or among orphans.
+func (p *Pool) Have(txHash []byte) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	txID := hex.EncodeToString(txHash)
+	return p.txs[txID] != nil || p.orphans.has(txID)
+}
+
+// Get returns the pool's transaction by given hash.
+func (p *Pool) Get(txHash []byte) (types.Transaction, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	desc, ok := p.txs[hex.EncodeToString(txHash)]
+	if !ok {
+		return types.Transaction{}, false
+	}
+	return desc.Tx, true
+}
+
+// Descs returns descriptions of pool's transactions in descending order
+// of fee rates, parents always go before transactions spending them.
+func (p *Pool) Descs() []TxDesc {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	var descs []TxDesc
+	added := make(map[string]bool)
+	var addDesc func(desc *TxDesc)
+	addDesc = func(desc *TxDesc) {
+		txID := hex.EncodeToString(desc.Tx.Hash)
+		if added[txID] {
+			return
+		}
+		added[txID] = true
+		for _, vin := range desc.Tx.VIn {
+			if parent, ok := p.txs[hex.EncodeToString(vin.PreviousTx)]; ok {
+				addDesc(parent)
+			}
+		}
+		descs = append(descs, *desc)
+	}
+	for i := len(p.byFeeRate) - 1; i >= 0; i-- {
+		addDesc(p.byFeeRate[i])
+	}
+	return descs
+}
+
+// Transactions returns pool's transactions in the order of Descs.
+func (p *Pool) Transactions() []types.Transaction {
+	var txs []types.Transaction
+	for _, desc := range p.Descs() {
+		txs = append(txs, desc.Tx)
+	}
+	return txs
+}
+
+// ProcessTransaction validates the transaction and adds it to the pool.
+// Orphans which spend outputs of the transaction are accepted too, all
+// accepted transactions are returned. If outputs spent by the transaction
+// are not found, it is kept as an orphan and ErrOrphanTx is returned.
+func (p *Pool) ProcessTransaction(tx types.Transaction) ([]TxDesc, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	desc, err := p.maybeAccept(tx, now)
+	if err == ErrOrphanTx {
+		err = p.orphans.add(tx, now)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrOrphanTx
+	}
+	if err != nil {
+		return nil, err
+	}
+	accepted := append([]TxDesc{*desc}, p.processOrphans(desc.Tx, now)...)
+	return accepted, nil
+}
+
+// maybeAccept validates the transaction against the best chain and the pool and adds it.
+func (p *Pool) maybeAccept(tx types.Transaction, now time.Time) (*TxDesc, error) {
+	txID := hex.EncodeToString(tx.Hash)
+	if p.txs[txID] != nil || p.orphans.has(txID) {
+		return nil, ErrAlreadyHave
+	}
+	if tx.IsCoinBase() {
+		return nil, ErrCoinBase
+	}
+	err := core.CheckTransactionStandard(tx)
+	if err != nil {
+		return nil, err
+	}
+	p.expire(now)
+	conflicts := make(map[string]*TxDesc)
+	for _, vin := range tx.VIn {
+		if spender, ok := p.spent[outpoint(vin.PreviousTx, vin.VOut)]; ok {
+			if !p.signalsReplacement(p.txs[spender]) {
+				return nil, ErrConflict
+			}
+			conflicts[spender] = p.txs[spender]
+		}
+	}
+	fee, err := p.config.Chain.CheckUnconfirmedTransaction(tx, p.getOutput)
+	if core.IsRuleError(err, core.ErrMissingInput) {
+		return nil, ErrOrphanTx
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = core.CheckTransactionFee(tx, fee)
+	if err != nil {
+		return nil, err
+	}
+	height, err := p.config.Chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	size := tx.Size()
+	desc := &TxDesc{
+		Tx:         tx,
+		Fee:        fee,
+		Size:       size,
+		FeePerByte: fee / amount.Amount(size),
+		SigOps:     core.CountSigOps(tx),
+		Height:     height,
+		Added:      now,
+	}
+	var evicted []string
+	if len(conflicts) > 0 {
+		evicted, err = p.checkReplacement(desc, conflicts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The pool is left untouched if the transaction would not stay in it,
+	// so a replacement never removes its conflicts for nothing.
+	if p.evictedBySize(desc, evicted) {
+		return nil, ErrPoolFull
+	}
+	for _, txID := range evicted {
+		p.removeTx(txID, false)
+	}
+	p.addTx(desc)
+	if p.config.FeeEstimator != nil {
+		p.config.FeeEstimator.ProcessTransaction(tx.Hash, desc.FeePerByte, height)
+	}
+	p.limitSize()
+	return desc, nil
+}
+
+// processOrphans accepts orphans which spend outputs of given transaction,
+// then orphans spending outputs of accepted ones and so on.
+func (p *Pool) processOrphans(parent types.Transaction, now time.Time) []TxDesc {
+	var accepted []TxDesc
+	parents := []types.Transaction{parent}
+	for len(parents) > 0 {
+		parentID := hex.EncodeToString(parents[0].Hash)
+		parents = parents[1:]
+		for _, orphan := range p.orphans.take(parentID) {
+			desc, err := p.maybeAccept(orphan, now)
+			if err == ErrOrphanTx {
+				p.orphans.add(orphan, now)
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			accepted = append(accepted, *desc)
+			parents = append(parents, orphan)
+		}
+	}
+	return accepted
+}
+
+// signalsReplacement reports whether the pool's transaction may be replaced,
+// i.e. it or one of its ancestors in the pool has a replaceable input.
+func (p *Pool) signalsReplacement(desc *TxDesc) bool {
+	for _, vin := range desc.Tx.VIn {
+		if vin.Sequence <= vars.MAX_BIP125_RBF_SEQUENCE {
+			return true
+		}
+	}
+	for _, vin := range desc.Tx.VIn {
+		if parent, ok := p.txs[hex.EncodeToString(vin.PreviousTx)]; ok && p.signalsReplacement(parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplacement checks that the transaction may replace pool's transactions
+// it conflicts with and returns ids of the transactions to evict, that is the
+// conflicts and their descendants. The replacement must pay higher fee rate
+// than every conflict and more fee than all evicted transactions together,
+// the excess covering its own size at the minimum relay fee rate. It must not
+// spend outputs of unconfirmed transactions the conflicts do not spend.
+func (p *Pool) checkReplacement(desc *TxDesc, conflicts map[string]*TxDesc) ([]string, error) {
+	evicted := make(map[string]bool)
+	var collect func(txID string)
+	collect = func(txID string) {
+		if evicted[txID] {
+			return
+		}
+		evicted[txID] = true
+		for i := range p.txs[txID].Tx.VOut {
+			if child, ok := p.spent[outpoint(p.txs[txID].Tx.Hash, i)]; ok {
+				collect(child)
+			}
+		}
+	}
+	parents := make(map[string]bool)
+	for txID, conflict := range conflicts {
+		if desc.FeePerByte <= conflict.FeePerByte {
+			return nil, ErrInsufficientFee
+		}
+		collect(txID)
+		for _, vin := range conflict.Tx.VIn {
+			parents[hex.EncodeToString(vin.PreviousTx)] = true
+		}
+	}
+	if len(evicted) > MAX_REPLACEMENT_EVICTIONS {
+		return nil, ErrTooManyReplacements
+	}
+	for _, vin := range desc.Tx.VIn {
+		parentID := hex.EncodeToString(vin.PreviousTx)
+		if evicted[parentID] {
+			return nil, ErrReplacementSpendsConflicting
+		}
+		if p.txs[parentID] != nil && !parents[parentID] {
+			return nil, ErrReplacementAddsUnconfirmed
+		}
+	}
+	var evictedFees amount.Amount
+	var txIDs []string
+	for txID := range evicted {
+		evictedFees += p.txs[txID].Fee
+		txIDs = append(txIDs, txID)
+	}
+	if desc.Fee-evictedFees < amount.Amount(desc.Size)*vars.MIN_FEE_PER_BYTE {
+		return nil, ErrInsufficientFee
+	}
+	return txIDs, nil
+}
+
+// getOutput returns an output of a pool's transaction. Outputs spent by the
+// pool are returned too, conflicts are checked by maybeAccept.
+func (p *Pool) getOutput(txHash []byte, index int) (tx_io.TXOutput, bool) {
+	desc, ok := p.txs[hex.EncodeToString(txHash)]
+	if !ok || index < 0 || index >= len(desc.Tx.VOut) {
+		return tx_io.TXOutput{}, false
+	}
+	return desc.Tx.VOut[index], true
+}
+
+func (p *Pool) addTx(desc *TxDesc) {
+	txID := hex.EncodeToString(desc.Tx.Hash)
+	p.txs[txID] = desc
+	for _, vin := range desc.Tx.VIn {
+		p.spent[outpoint(vin.PreviousTx, vin.VOut)] = txID
+	}
+	i := sort.Search(len(p.byFeeRate), func(i int) bool {
+		return !lessFeeRate(p.byFeeRate[i], desc)
+	})
+	p.byFeeRate = append(p.byFeeRate, nil)
+	copy(p.byFeeRate[i+1:], p.byFeeRate[i:])
+	p.byFeeRate[i] = desc
+	p.size += desc.Size
+}
+
+// removeTx removes a transaction by given id from the pool. Descendants of
+// a confirmed transaction stay valid, otherwise they are removed too.
+func (p *Pool) removeTx(txID string, confirmed bool) {
+	desc, ok := p.txs[txID]
+	if !ok {
+		return
+	}
+	if !confirmed {
+		for i := range desc.Tx.VOut {
+			if child, ok := p.spent[outpoint(desc.Tx.Hash, i)]; ok {
+				p.removeTx(child, false)
+			}
+		}
+	}
+	delete(p.txs, txID)
+	for _, vin := range desc.Tx.VIn {
+		delete(p.spent, outpoint(vin.PreviousTx, vin.VOut))
+	}
+	i := sort.Search(len(p.byFeeRate), func(i int) bool {
+		return !lessFeeRate(p.byFeeRate[i], desc)
+	})
+	p.byFeeRate = append(p.byFeeRate[:i], p.byFeeRate[i+1:]...)
+	p.size -= desc.Size
+
+	// Confirmed transactions are counted by the estimator when it processes the block.
+	if !confirmed && p.config.FeeEstimator != nil {
+		p.config.FeeEstimator.RemoveTransaction(desc.Tx.Hash)
+	}
+}
+
+// limitSize evicts transactions paying the lowest fee rate
+// with their descendants until the pool fits its size limit.
+func (p *Pool) limitSize() {
+	for p.size > p.config.MaxSize && len(p.byFeeRate) > 0 {
+		p.removeTx(hex.EncodeToString(p.byFeeRate[0].Tx.Hash), false)
+	}
+}
+
+// evictedBySize reports whether limitSize would evict the transaction if it
+// was added to the pool in place of the transactions by given ids.
+func (p *Pool) evictedBySize(desc *TxDesc, replaced []string) bool {
+	size := p.size + desc.Size
+	removed := make(map[string]bool)
+	var remove func(txID string)
+	remove = func(txID string) {
+		if removed[txID] {
+			return
+		}
+		removed[txID] = true
+		size -= p.txs[txID].Size
+		for i := range p.txs[txID].Tx.VOut {
+			if child, ok := p.spent[outpoint(p.txs[txID].Tx.Hash, i)]; ok {
+				remove(child)
+			}
+		}
+	}
+	for _, txID := range replaced {
+		remove(txID)
+	}
+	for _, next := range p.byFeeRate {
+		if size <= p.config.MaxSize {
+			return false
+		}
+		txID := hex.EncodeToString(next.Tx.Hash)
+		if removed[txID] {
+			continue
+		}
+		if !lessFeeRate(next, desc) {
+			return true
+		}
+		remove(txID)
+
+		// Descendants of evicted transactions are evicted too.
+		for _, vin := range desc.Tx.VIn {
+			if removed[hex.EncodeToString(vin.PreviousTx)] {
+				return true
+			}
+		}
+	}
+	return size > p.config.MaxSize
+}
+
+// expire removes transactions and orphans which are in the pool for too long.
+func (p *Pool) expire(now time.Time) {
+	for txID, desc := range p.txs {
+		if now.Sub(desc.Added) > p.config.Expiry {
+			p.removeTx(txID, false)
+		}
+	}
+	p.orphans.expire(now.Add(-ORPHAN_EXPIRY))
+}
+
+// BlockConnected removes transactions included in the block connected to
+// the best chain and transactions which conflict with them. Orphans which
+// spend outputs of the block's transactions are accepted, if possible.
+func (p *Pool) BlockConnected(block types.Block) []TxDesc {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, tx := range block.Transactions {
+		txID := hex.EncodeToString(tx.Hash)
+		p.removeTx(txID, true)
+		p.orphans.remove(txID)
+		if tx.IsCoinBase() {
+			continue
+		}
+		for _, vin := range tx.VIn {
+			if spender, ok := p.spent[outpoint(vin.PreviousTx, vin.VOut)]; ok {
+				p.removeTx(spender, false)
+			}
+		}
+	}
+	var accepted []TxDesc
+	now := time.Now()
+	for _, tx := range block.Transactions {
+		accepted = append(accepted, p.processOrphans(tx, now)...)
+	}
+	return accepted
+}
+
+// BlockDisconnected returns transactions of the block disconnected from the
+// best chain to the pool, the coinbase is dropped. Transactions which are not
+// valid on top of the new best chain are dropped too, so it must be called
+// after the best chain is switched, for blocks from the fork point up.
+func (p *Pool) BlockDisconnected(block types.Block) []TxDesc {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var accepted []TxDesc
+	now := time.Now()
+	for _, tx := range block.Transactions {
+		if tx.IsCoinBase() {
+			continue
+		}
+		desc, err := p.maybeAccept(tx, now)
+		if err != nil {
+			continue
+		}
+		accepted = append(accepted, *desc)
+		accepted = append(accepted, p.processOrphans(desc.Tx, now)...)
+	}
+	return accepted
+}
+
+// ChainChanged updates the pool when the best chain changes, it is
+// a core.ChainListener. Transactions of disconnected blocks are returned
+// to the pool, then transactions of connected blocks are removed.
+func (p *Pool) ChainChanged(disconnected, connected []types.Block) {
+	for _, block := range disconnected {
+		p.BlockDisconnected(block)
+	}
+	for _, block := range connected {
+		p.BlockConnected(block)
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+// testChain holds unspent outputs keyed by outpoints, it does not check signatures.
+type testChain struct {
+	outputs map[string]tx_io.TXOutput
+}
+
+func (c *testChain) CheckUnconfirmedTransaction(tx types.Transaction, getUnconfirmed core.UnconfirmedOutputGetter) (amount.Amount, error) {
+	inputSum := amount.Amount(0)
+	for _, vin := range tx.VIn {
+		out, ok := getUnconfirmed(vin.PreviousTx, vin.VOut)
+		if !ok {
+			out, ok = c.outputs[outpoint(vin.PreviousTx, vin.VOut)]
+		}
+		if !ok {
+			return 0, core.RuleError{Reason: core.ErrMissingInput}
+		}
+		inputSum += out.Value
+	}
+	for _, out := range tx.VOut {
+		inputSum -= out.Value
+	}
+	return inputSum, nil
+}
+
+func (c *testChain) GetBestHeight() (int, error) {
+	return 1, nil
+}
+
+var testAddress = string(wallet.NewWallet().GetAddress())
+
+// newTestPool creates a pool on top of a chain with given number of unspent
+// outputs of a single coin, returns the pool and hashes of transactions
+// which created the outputs.
+func newTestPool(outputs int) (*Pool, [][]byte) {
+	chain := &testChain{outputs: make(map[string]tx_io.TXOutput)}
+	var hashes [][]byte
+	for i := 0; i < outputs; i++ {
+		hash := []byte{byte(i), 0xff}
+		chain.outputs[outpoint(hash, 0)] = tx_io.NewTXOutput(amount.COIN, testAddress)
+		hashes = append(hashes, hash)
+	}
+	return New(Config{Chain: chain}), hashes
+}
+
+// newTestTx creates a transaction which spends the first output of the
+// previous transaction of given value and pays given fee. The transaction
+// does not signal replaceability.
+func newTestTx(prevTx []byte, value, fee amount.Amount) types.Transaction {
+	tx := types.Transaction{
+		Version:   vars.TX_VERSION,
+		VIn:       []tx_io.TXInput{{PreviousTx: prevTx, VOut: 0, Sequence: vars.SEQUENCE_FINAL}},
+		VOut:      []tx_io.TXOutput{tx_io.NewTXOutput(value-fee, testAddress)},
+		Timestamp: time.Now().UnixNano(),
+	}
+	tx.Hash = tx.CalcHash()
+	return tx
+}
+
+// replaceable makes all inputs of the transaction signal replaceability.
+func replaceable(tx types.Transaction) types.Transaction {
+	for i := range tx.VIn {
+		tx.VIn[i].Sequence = vars.MAX_BIP125_RBF_SEQUENCE
+	}
+	tx.Hash = tx.CalcHash()
+	return tx
+}
+
+func txHashes(descs []TxDesc) [][]byte {
+	var hashes [][]byte
+	for _, desc := range descs {
+		hashes = append(hashes, desc.Tx.Hash)
+	}
+	return hashes
+}
+
+func equalHashes(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPool_ProcessTransaction(test *testing.T) {
+	pool, prevTxs := newTestPool(2)
+	fee := amount.COIN / 100
+	parent := newTestTx(prevTxs[0], amount.COIN, fee)
+	if _, err := pool.ProcessTransaction(parent); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := pool.ProcessTransaction(parent); err != ErrAlreadyHave {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrAlreadyHave)
+	}
+	conflict := newTestTx(prevTxs[0], amount.COIN, 2*fee)
+	if _, err := pool.ProcessTransaction(conflict); err != ErrConflict {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrConflict)
+	}
+	noFee := newTestTx(prevTxs[1], amount.COIN, 0)
+	if _, err := pool.ProcessTransaction(noFee); !core.IsRuleError(err, core.ErrMinRelayFee) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, core.ErrMinRelayFee)
+	}
+	coinBase := core.NewCoinBaseTX(testAddress, amount.COIN, 1)
+	if _, err := pool.ProcessTransaction(coinBase); err != ErrCoinBase {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrCoinBase)
+	}
+
+	// The child pays the highest fee rate, but must follow its parent.
+	child := newTestTx(parent.Hash, amount.COIN-fee, 3*fee)
+	other := newTestTx(prevTxs[1], amount.COIN, 2*fee)
+	for _, tx := range []types.Transaction{child, other} {
+		if _, err := pool.ProcessTransaction(tx); err != nil {
+			test.Fatal(err)
+		}
+	}
+	expected := [][]byte{parent.Hash, child.Hash, other.Hash}
+	if actual := txHashes(pool.Descs()); !equalHashes(actual, expected) {
+		test.Errorf("invalid order:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+	if pool.Count() != 3 || pool.Size() != parent.Size()+child.Size()+other.Size() {
+		test.Errorf("invalid pool size:\nactual:\n%d %d\nexpected:\n3 %d", pool.Count(), pool.Size(), parent.Size()+child.Size()+other.Size())
+	}
+}
+
+func TestPool_Orphans(test *testing.T) {
+	pool, prevTxs := newTestPool(1)
+	fee := amount.COIN / 100
+	parent := newTestTx(prevTxs[0], amount.COIN, fee)
+	child := newTestTx(parent.Hash, amount.COIN-fee, fee)
+	grandChild := newTestTx(child.Hash, amount.COIN-2*fee, fee)
+	for _, tx := range []types.Transaction{grandChild, child} {
+		if _, err := pool.ProcessTransaction(tx); err != ErrOrphanTx {
+			test.Fatalf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrOrphanTx)
+		}
+	}
+	if pool.Count() != 0 || !pool.Have(child.Hash) {
+		test.Error("orphan transaction is not kept apart from the pool")
+	}
+	accepted, err := pool.ProcessTransaction(parent)
+	if err != nil {
+		test.Fatal(err)
+	}
+	expected := [][]byte{parent.Hash, child.Hash, grandChild.Hash}
+	if actual := txHashes(accepted); !equalHashes(actual, expected) {
+		test.Errorf("invalid accepted transactions:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+
+	orphan := newTestTx([]byte("unknown"), amount.COIN, fee)
+	if _, err := pool.ProcessTransaction(orphan); err != ErrOrphanTx {
+		test.Fatalf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrOrphanTx)
+	}
+	pool.expire(time.Now().Add(ORPHAN_EXPIRY + time.Minute))
+	if pool.Have(orphan.Hash) {
+		test.Error("expired orphan is not removed")
+	}
+	pool.expire(time.Now().Add(DEFAULT_EXPIRY + time.Minute))
+	if pool.Count() != 0 || pool.Size() != 0 {
+		test.Errorf("invalid pool size after expiry:\nactual:\n%d %d\nexpected:\n0 0", pool.Count(), pool.Size())
+	}
+}
+
+func TestPool_LimitSize(test *testing.T) {
+	fee := amount.COIN / 100
+	pool, prevTxs := newTestPool(4)
+	txs := []types.Transaction{
+		newTestTx(prevTxs[0], amount.COIN, 2*fee),
+		newTestTx(prevTxs[1], amount.COIN, 3*fee),
+		newTestTx(prevTxs[2], amount.COIN, 4*fee),
+		newTestTx(prevTxs[3], amount.COIN, fee),
+	}
+
+	// The pool fits two transactions only.
+	pool.config.MaxSize = txs[0].Size() + txs[1].Size()
+	for _, tx := range txs[:3] {
+		if _, err := pool.ProcessTransaction(tx); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if pool.Have(txs[0].Hash) || !pool.Have(txs[1].Hash) || !pool.Have(txs[2].Hash) {
+		test.Error("transaction paying the lowest fee rate is not evicted")
+	}
+	if _, err := pool.ProcessTransaction(txs[3]); err != ErrPoolFull {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrPoolFull)
+	}
+}
+
+func TestPool_ReplaceByFeeFull(test *testing.T) {
+	fee := amount.COIN / 100
+	pool, prevTxs := newTestPool(2)
+	original := replaceable(newTestTx(prevTxs[0], amount.COIN, 2*fee))
+	other := newTestTx(prevTxs[1], amount.COIN, 4*fee)
+	pool.config.MaxSize = original.Size() + other.Size()
+	for _, tx := range []types.Transaction{original, other} {
+		if _, err := pool.ProcessTransaction(tx); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// The replacement pays more than the original, but it is larger and pays
+	// the lowest fee rate in the pool, so it would be evicted right away.
+	replacement := newTestTx(prevTxs[0], amount.COIN, 3*fee)
+	replacement.VOut = append(replacement.VOut, tx_io.NewTXOutput(0, testAddress))
+	replacement.Hash = replacement.CalcHash()
+	if _, err := pool.ProcessTransaction(replacement); err != ErrPoolFull {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrPoolFull)
+	}
+	expected := [][]byte{other.Hash, original.Hash}
+	if actual := txHashes(pool.Descs()); !equalHashes(actual, expected) {
+		test.Errorf("invalid transactions after rejected replacement:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+}
+
+func TestPool_BlockConnected(test *testing.T) {
+	pool, prevTxs := newTestPool(2)
+	fee := amount.COIN / 100
+	parent := newTestTx(prevTxs[0], amount.COIN, fee)
+	child := newTestTx(parent.Hash, amount.COIN-fee, fee)
+	spend := newTestTx(prevTxs[1], amount.COIN, fee)
+	spendChild := newTestTx(spend.Hash, amount.COIN-fee, fee)
+	for _, tx := range []types.Transaction{parent, child, spend, spendChild} {
+		if _, err := pool.ProcessTransaction(tx); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// The block confirms the parent and double spends the output spent by the pool.
+	doubleSpend := newTestTx(prevTxs[1], amount.COIN, 2*fee)
+	block := types.Block{Transactions: []types.Transaction{core.NewCoinBaseTX(testAddress, amount.COIN, 1), parent, doubleSpend}}
+	pool.BlockConnected(block)
+	expected := [][]byte{child.Hash}
+	if actual := txHashes(pool.Descs()); !equalHashes(actual, expected) {
+		test.Errorf("invalid transactions after block:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+}
+
+func TestPool_ChainChanged(test *testing.T) {
+	pool, prevTxs := newTestPool(2)
+	chain := pool.config.Chain.(*testChain)
+	fee := amount.COIN / 100
+	parent := newTestTx(prevTxs[0], amount.COIN, fee)
+	spend := newTestTx(prevTxs[1], amount.COIN, fee)
+	a1 := types.Block{Transactions: []types.Transaction{core.NewCoinBaseTX(testAddress, amount.COIN, 1), parent, spend}}
+	chain.outputs[outpoint(parent.Hash, 0)] = parent.VOut[0]
+	chain.outputs[outpoint(spend.Hash, 0)] = spend.VOut[0]
+	delete(chain.outputs, outpoint(prevTxs[0], 0))
+	delete(chain.outputs, outpoint(prevTxs[1], 0))
+	child := newTestTx(parent.Hash, amount.COIN-fee, fee)
+	if _, err := pool.ProcessTransaction(child); err != nil {
+		test.Fatal(err)
+	}
+
+	// The new best chain double spends the output spent by the disconnected block.
+	doubleSpend := newTestTx(prevTxs[1], amount.COIN, 2*fee)
+	b1 := types.Block{Transactions: []types.Transaction{core.NewCoinBaseTX(testAddress, amount.COIN, 1), doubleSpend}}
+	delete(chain.outputs, outpoint(parent.Hash, 0))
+	delete(chain.outputs, outpoint(spend.Hash, 0))
+	chain.outputs[outpoint(prevTxs[0], 0)] = tx_io.NewTXOutput(amount.COIN, testAddress)
+	chain.outputs[outpoint(doubleSpend.Hash, 0)] = doubleSpend.VOut[0]
+	pool.ChainChanged([]types.Block{a1}, []types.Block{b1})
+	expected := [][]byte{parent.Hash, child.Hash}
+	if actual := txHashes(pool.Descs()); !equalHashes(actual, expected) {
+		test.Errorf("invalid transactions after reorganization:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+}
+
+func TestPool_ReplaceByFee(test *testing.T) {
+	pool, prevTxs := newTestPool(3)
+	fee := amount.COIN / 100
+	original := replaceable(newTestTx(prevTxs[0], amount.COIN, fee))
+
+	// The child inherits replaceability from its parent.
+	child := newTestTx(original.Hash, amount.COIN-fee, fee)
+	other := newTestTx(prevTxs[1], amount.COIN, fee)
+	for _, tx := range []types.Transaction{original, child, other} {
+		if _, err := pool.ProcessTransaction(tx); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if _, err := pool.ProcessTransaction(newTestTx(prevTxs[1], amount.COIN, 3*fee)); err != ErrConflict {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrConflict)
+	}
+
+	// Replacements spending the first output together with another one.
+	addsUnconfirmed := newTestTx(prevTxs[0], amount.COIN, 3*fee)
+	addsUnconfirmed.VIn = append(addsUnconfirmed.VIn, tx_io.TXInput{PreviousTx: other.Hash, VOut: 0})
+	addsUnconfirmed.Hash = addsUnconfirmed.CalcHash()
+	spendsConflicting := newTestTx(prevTxs[0], amount.COIN, 3*fee)
+	spendsConflicting.VIn = append(spendsConflicting.VIn, tx_io.TXInput{PreviousTx: original.Hash, VOut: 0})
+	spendsConflicting.Hash = spendsConflicting.CalcHash()
+	data := []struct {
+		tx  types.Transaction
+		err error
+	}{
+		{newTestTx(prevTxs[0], amount.COIN, fee), ErrInsufficientFee},
+		{newTestTx(prevTxs[0], amount.COIN, 3*fee/2), ErrInsufficientFee},
+		{addsUnconfirmed, ErrReplacementAddsUnconfirmed},
+		{spendsConflicting, ErrReplacementSpendsConflicting},
+	}
+	for i, item := range data {
+		if _, err := pool.ProcessTransaction(item.tx); err != item.err {
+			test.Errorf("mempool.TestPool_ReplaceByFee[%d]: invalid error:\nactual:\n%v\nexpected:\n%v", i, err, item.err)
+		}
+	}
+
+	// The replacement pays for both the original and its child.
+	replacement := newTestTx(prevTxs[0], amount.COIN, 3*fee)
+	if _, err := pool.ProcessTransaction(replacement); err != nil {
+		test.Fatal(err)
+	}
+	expected := [][]byte{replacement.Hash, other.Hash}
+	if actual := txHashes(pool.Descs()); !equalHashes(actual, expected) {
+		test.Errorf("invalid transactions after replacement:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+
+	// A replacement can not evict too many descendants.
+	parent := replaceable(newTestTx(prevTxs[2], amount.COIN, fee))
+	if _, err := pool.ProcessTransaction(parent); err != nil {
+		test.Fatal(err)
+	}
+	value := amount.COIN - fee
+	prevTx := parent.Hash
+	for i := 0; i < MAX_REPLACEMENT_EVICTIONS; i++ {
+		tx := newTestTx(prevTx, value, fee*9/10)
+		if _, err := pool.ProcessTransaction(tx); err != nil {
+			test.Fatal(err)
+		}
+		value -= fee * 9 / 10
+		prevTx = tx.Hash
+	}
+	if _, err := pool.ProcessTransaction(newTestTx(prevTxs[2], amount.COIN, amount.COIN)); err != ErrTooManyReplacements {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrTooManyReplacements)
+	}
+}
+
+func TestPool_Concurrency(test *testing.T) {
+	pool, prevTxs := newTestPool(50)
+	done := make(chan bool)
+	for _, prevTx := range prevTxs {
+		go func(prevTx []byte) {
+			tx := newTestTx(prevTx, amount.COIN, amount.COIN/100)
+			if _, err := pool.ProcessTransaction(tx); err != nil {
+				test.Error(err)
+			}
+			pool.Descs()
+			pool.BlockConnected(types.Block{Transactions: []types.Transaction{tx}})
+			done <- true
+		}(prevTx)
+	}
+	for range prevTxs {
+		<-done
+	}
+	if pool.Count() != 0 {
+		test.Errorf("invalid pool size:\nactual:\n%d\nexpected:\n0", pool.Count())
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package mining builds blocks from transactions of the memory pool.
+//
+// Transactions are selected in packages: a transaction together with its
+// ancestors which are not selected yet. Packages are ordered by their fee
+// rate, so a child paying high fee pulls its low fee parents into the block
+// (child pays for parent). Ancestors always go before their descendants.
+package mining
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"sort"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mempool"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+// DEFAULT_BLOCK_MAX_SIZE is the default limit of the size of mined blocks in bytes,
+// it is lowered to the consensus limit of the network.
+const DEFAULT_BLOCK_MAX_SIZE = 750000
+
+// BlockMaxSize returns the size limit of mined blocks on given network.
+func BlockMaxSize(chainParams *params.ChainParams) int {
+	if DEFAULT_BLOCK_MAX_SIZE > chainParams.MaxBlockSize {
+		return chainParams.MaxBlockSize
+	}
+	return DEFAULT_BLOCK_MAX_SIZE
+}
+
+// BlockTemplate holds transactions selected for a block in the order they
+// must be included after the coinbase, their total fee, size and number
+// of signature operations. Size and SigOps include the space reserved
+// for the coinbase.
+type BlockTemplate struct {
+	Transactions []types.Transaction
+	Fees         amount.Amount
+	Size         int
+	SigOps       int
+}
+
+// txEntry tracks a transaction and its ancestors which are not selected yet.
+type txEntry struct {
+	desc      *mempool.TxDesc
+	parents   []string
+	children  []string
+	ancestors map[string]bool
+
+	// fee, size and signature operations of the transaction's
+	// package, i.e. the transaction and ancestors above.
+	fee    amount.Amount
+	size   int
+	sigOps int
+
+	// version is increased whenever the package changes,
+	// so outdated items of the queue are skipped.
+	version int
+}
+
+func (e *txEntry) feeRate() float64 {
+	return float64(e.fee) / float64(e.size)
+}
+
+type queueItem struct {
+	txID    string
+	feeRate float64
+	version int
+}
+
+// packageQueue is a max-heap of packages ordered by fee rate.
+type packageQueue []queueItem
+
+func (q packageQueue) Len() int            { return len(q) }
+func (q packageQueue) Less(i, j int) bool  { return q[i].feeRate > q[j].feeRate }
+func (q packageQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *packageQueue) Push(x interface{}) { *q = append(*q, x.(queueItem)) }
+func (q *packageQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// NewBlockTemplate selects transactions of the memory pool, which are
+// described by descs, for a block of at most maxSize bytes and maxSigOps
+// signature operations. Packages of the highest fee rate are selected first,
+// packages which do not fit the block are skipped.
+func NewBlockTemplate(descs []mempool.TxDesc, maxSize, maxSigOps int) BlockTemplate {
+	entries := make(map[string]*txEntry)
+	for i := range descs {
+		entries[hex.EncodeToString(descs[i].Tx.Hash)] = &txEntry{desc: &descs[i]}
+	}
+	for txID, entry := range entries {
+		parents := make(map[string]bool)
+		for _, vin := range entry.desc.Tx.VIn {
+			parentID := hex.EncodeToString(vin.PreviousTx)
+			if parent, ok := entries[parentID]; ok && !parents[parentID] {
+				parents[parentID] = true
+				entry.parents = append(entry.parents, parentID)
+				parent.children = append(parent.children, txID)
+			}
+		}
+	}
+	var collectAncestors func(entry *txEntry, ancestors map[string]bool)
+	collectAncestors = func(entry *txEntry, ancestors map[string]bool) {
+		for _, parentID := range entry.parents {
+			if !ancestors[parentID] {
+				ancestors[parentID] = true
+				collectAncestors(entries[parentID], ancestors)
+			}
+		}
+	}
+	queue := &packageQueue{}
+	for txID, entry := range entries {
+		entry.ancestors = make(map[string]bool)
+		collectAncestors(entry, entry.ancestors)
+		entry.fee, entry.size, entry.sigOps = entry.desc.Fee, entry.desc.Size, entry.desc.SigOps
+		for ancestorID := range entry.ancestors {
+			entry.fee += entries[ancestorID].desc.Fee
+			entry.size += entries[ancestorID].desc.Size
+			entry.sigOps += entries[ancestorID].desc.SigOps
+		}
+		heap.Push(queue, queueItem{txID: txID, feeRate: entry.feeRate()})
+	}
+
+	template := BlockTemplate{Size: vars.COINBASE_RESERVED_SIZE, SigOps: vars.COINBASE_RESERVED_SIGOPS}
+	selected := make(map[string]bool)
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(queueItem)
+		entry := entries[item.txID]
+		if selected[item.txID] || item.version != entry.version {
+			continue
+		}
+		if template.Size+entry.size > maxSize || template.SigOps+entry.sigOps > maxSigOps {
+			continue
+		}
+
+		// Ancestors of a transaction have fewer ancestors than it has,
+		// so the package is sorted topologically.
+		pkg := []string{item.txID}
+		for ancestorID := range entry.ancestors {
+			pkg = append(pkg, ancestorID)
+		}
+		sort.Slice(pkg, func(i, j int) bool {
+			return len(entries[pkg[i]].ancestors) < len(entries[pkg[j]].ancestors)
+		})
+		for _, txID := range pkg {
+			selected[txID] = true
+		}
+		for _, txID := range pkg {
+			desc := entries[txID].desc
+			template.Transactions = append(template.Transactions, desc.Tx)
+			template.Fees += desc.Fee
+			template.Size += desc.Size
+			template.SigOps += desc.SigOps
+			updateDescendants(entries, txID, selected, queue)
+		}
+	}
+	return template
+}
+
+// updateDescendants removes a selected transaction
+// from packages of its descendants which are not selected.
+func updateDescendants(entries map[string]*txEntry, txID string, selected map[string]bool, queue *packageQueue) {
+	desc := entries[txID].desc
+	visited := make(map[string]bool)
+	var update func(entry *txEntry)
+	update = func(entry *txEntry) {
+		for _, childID := range entry.children {
+			if visited[childID] {
+				continue
+			}
+			visited[childID] = true
+			child := entries[childID]
+			if !selected[childID] {
+				delete(child.ancestors, txID)
+				child.fee -= desc.Fee
+				child.size -= desc.Size
+				child.sigOps -= desc.SigOps
+				child.version++
+				heap.Push(queue, queueItem{txID: childID, feeRate: child.feeRate(), version: child.version})
+			}
+			update(child)
+		}
+	}
+	update(entries[txID])
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mining
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mempool"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+var testAddress = string(wallet.NewWallet().GetAddress())
+
+// newTestDesc describes a transaction spending the first output
+// of the previous transaction, which pays given fee.
+func newTestDesc(prevTx []byte, fee amount.Amount) mempool.TxDesc {
+	tx := types.Transaction{
+		Version: vars.TX_VERSION,
+		VIn:     []tx_io.TXInput{{PreviousTx: prevTx, VOut: 0}},
+		VOut:    []tx_io.TXOutput{tx_io.NewTXOutput(amount.COIN, testAddress)},
+	}
+	tx.Hash = tx.CalcHash()
+	size := tx.Size()
+	return mempool.TxDesc{Tx: tx, Fee: fee, Size: size, FeePerByte: fee / amount.Amount(size), SigOps: core.CountSigOps(tx)}
+}
+
+func templateHashes(template BlockTemplate) [][]byte {
+	var hashes [][]byte
+	for _, tx := range template.Transactions {
+		hashes = append(hashes, tx.Hash)
+	}
+	return hashes
+}
+
+func equalHashes(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewBlockTemplate(test *testing.T) {
+	fee := amount.COIN / 100
+
+	// The child pays for its parent, so their package goes before the other
+	// transaction, which pays more than the parent but less than the package.
+	parent := newTestDesc([]byte{1}, fee)
+	child := newTestDesc(parent.Tx.Hash, 5*fee)
+	grandChild := newTestDesc(child.Tx.Hash, fee)
+	other := newTestDesc([]byte{2}, 2*fee)
+	descs := []mempool.TxDesc{grandChild, other, child, parent}
+	template := NewBlockTemplate(descs, DEFAULT_BLOCK_MAX_SIZE, params.RegTestParams.MaxBlockSigOps)
+	expected := [][]byte{parent.Tx.Hash, child.Tx.Hash, other.Tx.Hash, grandChild.Tx.Hash}
+	if actual := templateHashes(template); !equalHashes(actual, expected) {
+		test.Errorf("invalid transactions:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+	if template.Fees != 9*fee {
+		test.Errorf("invalid fees:\nactual:\n%s\nexpected:\n%s", template.Fees, 9*fee)
+	}
+	size := vars.COINBASE_RESERVED_SIZE + parent.Size + child.Size + other.Size + grandChild.Size
+	if template.Size != size {
+		test.Errorf("invalid size:\nactual:\n%d\nexpected:\n%d", template.Size, size)
+	}
+
+	// The package of the parent and the child spends a longer hash, so it does
+	// not fit the block, while the other transaction and the parent alone do.
+	maxSize := vars.COINBASE_RESERVED_SIZE + other.Size + parent.Size
+	template = NewBlockTemplate(descs, maxSize, params.RegTestParams.MaxBlockSigOps)
+	expected = [][]byte{other.Tx.Hash, parent.Tx.Hash}
+	if actual := templateHashes(template); !equalHashes(actual, expected) {
+		test.Errorf("invalid transactions of limited block:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+	if template.Size > maxSize {
+		test.Errorf("invalid size of limited block:\nactual:\n%d\nexpected:\n%d", template.Size, maxSize)
+	}
+
+	// Every transaction has a single signature operation, the package
+	// of the parent and the child exceeds the limit.
+	template = NewBlockTemplate(descs, DEFAULT_BLOCK_MAX_SIZE, vars.COINBASE_RESERVED_SIGOPS+1)
+	expected = [][]byte{other.Tx.Hash}
+	if actual := templateHashes(template); !equalHashes(actual, expected) {
+		test.Errorf("invalid transactions of block limited by signature operations:\nactual:\n%x\nexpected:\n%x", actual, expected)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+// orphanPool keeps blocks whose parent is not known yet,
+// grouped by hash of the missing parent.
+type orphanPool struct {
+	mutex  sync.Mutex
+	blocks map[string][]types.Block
+	count  int
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{blocks: make(map[string][]types.Block)}
+}
+
+// add puts given block to the pool. If the pool is full, an arbitrary
+// group of orphans is dropped, they can be requested again later.
+func (op *orphanPool) add(block types.Block) {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+	parent := hex.EncodeToString(block.PrevBlockHash)
+	for _, orphan := range op.blocks[parent] {
+		if hex.EncodeToString(orphan.Hash) == hex.EncodeToString(block.Hash) {
+			return
+		}
+	}
+	for key, orphans := range op.blocks {
+		if op.count < vars.MAX_ORPHAN_BLOCKS {
+			break
+		}
+		op.count -= len(orphans)
+		delete(op.blocks, key)
+	}
+	op.blocks[parent] = append(op.blocks[parent], block)
+	op.count++
+}
+
+// take removes and returns all orphans which are children of a block by given hash.
+func (op *orphanPool) take(parentHash []byte) []types.Block {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+	parent := hex.EncodeToString(parentHash)
+	children := op.blocks[parent]
+	op.count -= len(children)
+	delete(op.blocks, parent)
+	return children
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package params defines consensus parameters of the networks a node can run on.
+package params
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+)
+
+// RetargetAlgorithm selects how the difficulty of the next block is calculated.
+type RetargetAlgorithm int
+
+const (
+	// RETARGET_BITCOIN adjusts the difficulty once per RetargetInterval
+	// blocks, so the interval takes RetargetInterval * TargetSpacing seconds.
+	RETARGET_BITCOIN RetargetAlgorithm = iota
+
+	// RETARGET_DARK_GRAVITY_WAVE adjusts the difficulty every block using a
+	// moving average of targets and timestamps of DGWPastBlocks last blocks.
+	RETARGET_DARK_GRAVITY_WAVE
+
+	// RETARGET_NONE keeps the difficulty of the genesis block forever.
+	RETARGET_NONE
+)
+
+// PowAlgorithm selects the hash function of block headers used by proof of work.
+type PowAlgorithm int
+
+const (
+	// POW_X11 chains eleven hash functions, see crypto/x11.
+	POW_X11 PowAlgorithm = iota
+
+	// POW_DOUBLE_SHA256 applies SHA-256 twice like Bitcoin does.
+	POW_DOUBLE_SHA256
+
+	// POW_KECCAK takes the first half of the Keccak-512 hash.
+	POW_KECCAK
+)
+
+// Consensus selects how blocks are sealed and how their seals are verified.
+type Consensus int
+
+const (
+	// CONSENSUS_POW requires the hash of a block's header to satisfy
+	// the target set by its bits.
+	CONSENSUS_POW Consensus = iota
+
+	// CONSENSUS_POA requires a block to be signed by one of Signers,
+	// they take turns in round-robin order by block height.
+	CONSENSUS_POA
+)
+
+type ChainParams struct {
+	Name string
+
+	Consensus Consensus
+
+	// Signers holds uncompressed secp256k1 public keys of nodes which
+	// seal blocks of a proof of authority network, the block at height h
+	// is sealed by Signers[h % len(Signers)].
+	Signers [][]byte
+
+	// PowAlgorithm selects the hash function of proof of work, both mining
+	// and validation of blocks use it. Proof of authority networks use it
+	// to hash block headers.
+	PowAlgorithm PowAlgorithm
+
+	// PowLimit is the highest target, i.e. the lowest difficulty, allowed on the network.
+	// Blocks of proof of authority networks have bits of this target.
+	PowLimit *big.Int
+
+	// TargetSpacing is the desired time between blocks in seconds. Signers of
+	// a proof of authority network do not seal blocks more often than that.
+	TargetSpacing int64
+
+	RetargetAlgorithm RetargetAlgorithm
+
+	// RetargetInterval is the number of blocks between difficulty
+	// adjustments of the Bitcoin-style algorithm.
+	RetargetInterval int
+
+	// DGWPastBlocks is the number of blocks averaged by DarkGravityWave.
+	DGWPastBlocks int
+
+	// InitialSubsidy is the reward for mining a block before the first halving.
+	InitialSubsidy amount.Amount
+
+	// SubsidyHalvingInterval is the number of blocks after which the subsidy
+	// is halved, zero disables halving.
+	SubsidyHalvingInterval int
+
+	// MinSubsidy is the floor the subsidy never drops below. Zero caps the
+	// total supply, otherwise the tail emission never ends.
+	MinSubsidy amount.Amount
+
+	// CoinbaseMaturity is the number of blocks which must be built on top
+	// of a coinbase before its outputs can be spent.
+	CoinbaseMaturity int
+
+	// MaxBlockSize and MaxTxSize limit the number of bytes of serialized
+	// blocks and transactions, MaxBlockSigOps limits the number of signature
+	// checks of a block, see script.CountSigOps.
+	MaxBlockSize   int
+	MaxTxSize      int
+	MaxBlockSigOps int
+}
+
+func newPowLimit(zeroBits uint) *big.Int {
+	limit := big.NewInt(1)
+	limit.Lsh(limit, 256-zeroBits)
+	return limit.Sub(limit, big.NewInt(1))
+}
+
+var (
+	MainNetParams = ChainParams{
+		Name:              "main",
+		PowAlgorithm:      POW_X11,
+		PowLimit:          newPowLimit(16),
+		TargetSpacing:     150,
+		RetargetAlgorithm: RETARGET_DARK_GRAVITY_WAVE,
+		RetargetInterval:  2016,
+		DGWPastBlocks:     24,
+
+		InitialSubsidy:         50 * amount.COIN,
+		SubsidyHalvingInterval: 840000,
+		MinSubsidy:             0,
+
+		CoinbaseMaturity: 100,
+
+		MaxBlockSize:   2000000,
+		MaxTxSize:      1000000,
+		MaxBlockSigOps: 40000,
+	}
+
+	TestNetParams = ChainParams{
+		Name:              "test",
+		PowAlgorithm:      POW_X11,
+		PowLimit:          newPowLimit(12),
+		TargetSpacing:     150,
+		RetargetAlgorithm: RETARGET_BITCOIN,
+		RetargetInterval:  2016,
+		DGWPastBlocks:     24,
+
+		InitialSubsidy:         50 * amount.COIN,
+		SubsidyHalvingInterval: 840000,
+		MinSubsidy:             0,
+
+		CoinbaseMaturity: 100,
+
+		MaxBlockSize:   2000000,
+		MaxTxSize:      1000000,
+		MaxBlockSigOps: 40000,
+	}
+
+	// RegTestParams are used for local testing, blocks are found almost instantly.
+	// Double SHA-256 is used, since X11 is needlessly slow for tests, and block
+	// rewards can be spent after a few blocks.
+	RegTestParams = ChainParams{
+		Name:              "regtest",
+		PowAlgorithm:      POW_DOUBLE_SHA256,
+		PowLimit:          newPowLimit(1),
+		TargetSpacing:     150,
+		RetargetAlgorithm: RETARGET_NONE,
+		RetargetInterval:  2016,
+		DGWPastBlocks:     24,
+
+		InitialSubsidy:         50 * amount.COIN,
+		SubsidyHalvingInterval: 150,
+		MinSubsidy:             0,
+
+		CoinbaseMaturity: 10,
+
+		MaxBlockSize:   2000000,
+		MaxTxSize:      1000000,
+		MaxBlockSigOps: 40000,
+	}
+
+	// PoANetParams are used by private networks whose blocks are sealed
+	// by signers set in the node configuration instead of being mined.
+	// Signers are trusted not to revert blocks, so rewards mature sooner.
+	PoANetParams = ChainParams{
+		Name:              "poa",
+		Consensus:         CONSENSUS_POA,
+		PowAlgorithm:      POW_DOUBLE_SHA256,
+		PowLimit:          newPowLimit(1),
+		TargetSpacing:     15,
+		RetargetAlgorithm: RETARGET_NONE,
+		RetargetInterval:  2016,
+		DGWPastBlocks:     24,
+
+		InitialSubsidy:         50 * amount.COIN,
+		SubsidyHalvingInterval: 840000,
+		MinSubsidy:             0,
+
+		CoinbaseMaturity: 10,
+
+		MaxBlockSize:   2000000,
+		MaxTxSize:      1000000,
+		MaxBlockSigOps: 40000,
+	}
+)
+
+var ErrUnknownNetwork = errors.New("unknown network")
+
+// Get returns parameters of the network by given name, empty name means main network.
+func Get(name string) (*ChainParams, error) {
+	switch name {
+	case "", MainNetParams.Name:
+		return &MainNetParams, nil
+	case TestNetParams.Name:
+		return &TestNetParams, nil
+	case RegTestParams.Name:
+		return &RegTestParams, nil
+	case PoANetParams.Name:
+		return &PoANetParams, nil
+	}
+	return nil, errors.New(fmt.Sprintf("%s: %s", ErrUnknownNetwork.Error(), name))
+}
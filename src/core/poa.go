@@ -0,0 +1,165 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/secp256k1"
+)
+
+// PoAEngine seals blocks of proof of authority networks. Signers of the
+// network take turns in round-robin order, the block at height h must be
+// signed by Signers[h % len(Signers)] of chain parameters. The signature
+// covers the whole header except the seal, so a block can not be changed
+// without the key of its signer. The genesis block is not signed.
+type PoAEngine struct {
+	params    *params.ChainParams
+	hasher    PowHasher
+	signerKey []byte
+	publicKey []byte
+}
+
+// NewPoAEngine creates an engine which signs blocks with given private key.
+// The key must belong to one of the signers, an engine without a key only
+// verifies seals.
+func NewPoAEngine(chainParams *params.ChainParams, signerKey []byte) (*PoAEngine, error) {
+	if len(chainParams.Signers) == 0 {
+		return nil, ErrNoSigners
+	}
+	curve := secp256k1.S256()
+	for _, signer := range chainParams.Signers {
+		x, y := curve.Unmarshal(signer)
+		if x == nil || !curve.IsOnCurve(x, y) {
+			return nil, errors.New(fmt.Sprintf("invalid public key of signer %x", signer))
+		}
+	}
+	hasher, err := NewPowHasher(chainParams.PowAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	engine := &PoAEngine{params: chainParams, hasher: hasher}
+	if signerKey == nil {
+		return engine, nil
+	}
+	if len(signerKey) != 32 {
+		return nil, secp256k1.ErrInvalidKey
+	}
+	engine.signerKey = signerKey
+	engine.publicKey = curve.Marshal(curve.ScalarBaseMult(signerKey))
+	for _, signer := range chainParams.Signers {
+		if bytes.Equal(signer, engine.publicKey) {
+			return engine, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("%x is not a signer of the network", engine.publicKey))
+}
+
+// Signer returns the public key of the signer which seals the block at given height.
+func (e *PoAEngine) Signer(height int) []byte {
+	return e.params.Signers[height%len(e.params.Signers)]
+}
+
+// CalcNextBits returns bits of the parent, there is no difficulty to adjust.
+func (e *PoAEngine) CalcNextBits(parent types.BlockHeader, getHeader consensus.HeaderGetter) (uint32, error) {
+	return parent.Bits, nil
+}
+
+// Seal signs the block if the engine's signer is in turn at the block's height,
+// ErrNotInTurn is returned otherwise. The block is not sealed earlier than
+// TargetSpacing seconds after its parent, the timestamp is moved accordingly.
+// Waiting stops with the context's error when the context is done.
+func (e *PoAEngine) Seal(ctx context.Context, block types.Block, getHeader consensus.HeaderGetter) (types.Block, error) {
+	header := block.BlockHeader
+	header.Version = vars.BLOCK_VERSION
+	header.Nonce = 0
+	header.Seal = nil
+	if header.Timestamp == 0 {
+		header.Timestamp = time.Now().Unix()
+	}
+	block = types.Block{
+		BlockHeader:  header,
+		Transactions: append([]types.Transaction{}, block.Transactions...),
+	}
+	block.MerkleRoot = consensus.HashTransactions(block.Transactions)
+	if block.Height > 0 {
+		if e.signerKey == nil {
+			return types.Block{}, ErrNoSignerKey
+		}
+		if !bytes.Equal(e.publicKey, e.Signer(block.Height)) {
+			return types.Block{}, ErrNotInTurn
+		}
+		parent, err := getHeader(block.PrevBlockHash)
+		if err != nil {
+			return types.Block{}, err
+		}
+		earliest := parent.Timestamp + e.params.TargetSpacing
+		if block.Timestamp < earliest {
+			timer := time.NewTimer(time.Until(time.Unix(earliest, 0)))
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return types.Block{}, ctx.Err()
+			case <-timer.C:
+			}
+			block.Timestamp = earliest
+		}
+		block.Seal, err = secp256k1.Sign(e.sealHash(block.BlockHeader), e.signerKey)
+		if err != nil {
+			return types.Block{}, err
+		}
+	}
+	block.Hash = HashHeader(block.BlockHeader, e.hasher)
+	return block, nil
+}
+
+// VerifySeal checks that the block is signed by the signer in turn
+// at the block's height and that the block's hash is the hash of its header.
+func (e *PoAEngine) VerifySeal(block types.Block) error {
+	if block.Height == 0 {
+		if len(block.Seal) != 0 {
+			return ruleError(ErrBadSeal, "genesis block %x is sealed", block.Hash)
+		}
+	} else {
+		// Seal is in [R || S || V] format, the recovery id is not needed for verification.
+		if len(block.Seal) != 65 {
+			return ruleError(ErrBadSeal, "block %x has %d bytes seal", block.Hash, len(block.Seal))
+		}
+		signer := e.Signer(block.Height)
+		if !secp256k1.VerifySignature(signer, e.sealHash(block.BlockHeader), block.Seal[:64]) {
+			return ruleError(ErrBadSeal, "block %x is not signed by signer %x", block.Hash, signer)
+		}
+	}
+	if !bytes.Equal(HashHeader(block.BlockHeader, e.hasher), block.Hash) {
+		return ruleError(ErrBadBlockHash, "block %x has invalid hash", block.Hash)
+	}
+	return nil
+}
+
+// sealHash returns the hash of the header without the seal, which is signed by signers.
+func (e *PoAEngine) sealHash(header types.BlockHeader) []byte {
+	header.Seal = nil
+	hash := e.hasher.Sum256(header.Bytes())
+	return hash[:]
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+func newTestPoAParams(signers ...*wallet.Wallet) *params.ChainParams {
+	chainParams := params.PoANetParams
+	chainParams.TargetSpacing = 0
+	chainParams.Signers = nil
+	for _, signer := range signers {
+		chainParams.Signers = append(chainParams.Signers, signer.PublicKey)
+	}
+	return &chainParams
+}
+
+func TestNewPoAEngine(test *testing.T) {
+	if _, err := NewPoAEngine(newTestPoAParams(), nil); err != ErrNoSigners {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNoSigners)
+	}
+	chainParams := newTestPoAParams(wallet.NewWallet())
+	if _, err := NewPoAEngine(chainParams, wallet.NewWallet().PrivateKey); err == nil {
+		test.Error("key of a node which is not a signer is accepted")
+	}
+	chainParams.Signers = append(chainParams.Signers, []byte{4, 1, 2, 3})
+	if _, err := NewPoAEngine(chainParams, nil); err == nil {
+		test.Error("invalid public key of a signer is accepted")
+	}
+}
+
+func TestPoAEngine_Seal(test *testing.T) {
+	signers := []*wallet.Wallet{wallet.NewWallet(), wallet.NewWallet()}
+	chainParams := newTestPoAParams(signers...)
+	genesis, err := NewGenesisBlock(newTestCoinBase(), chainParams)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := CheckBlock(genesis, chainParams); err != nil {
+		test.Fatalf("invalid genesis block:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+	getHeader := func(hash []byte) (types.BlockHeader, error) {
+		return genesis.BlockHeader, nil
+	}
+
+	// The second signer is in turn at height 1.
+	first, err := NewPoAEngine(chainParams, signers[0].PrivateKey)
+	if err != nil {
+		test.Fatal(err)
+	}
+	second, err := NewPoAEngine(chainParams, signers[1].PrivateKey)
+	if err != nil {
+		test.Fatal(err)
+	}
+	header := types.BlockHeader{PrevBlockHash: genesis.Hash, Height: 1, Bits: genesis.Bits}
+	candidate := types.Block{BlockHeader: header, Transactions: []types.Transaction{newTestCoinBase()}}
+	if _, err := first.Seal(context.Background(), candidate, getHeader); err != ErrNotInTurn {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNotInTurn)
+	}
+	block, err := second.Seal(context.Background(), candidate, getHeader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := CheckBlock(block, chainParams); err != nil {
+		test.Errorf("invalid block:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+
+	// A block can not be changed without its signer's key, even if its hash is updated.
+	tampered := block
+	tampered.Timestamp++
+	tampered.Hash = HashHeader(tampered.BlockHeader, testHasher)
+	if err := first.VerifySeal(tampered); !IsRuleError(err, ErrBadSeal) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadSeal)
+	}
+
+	// Signature of the signer which is not in turn is rejected.
+	outOfTurn := block
+	outOfTurn.Height = 2
+	if err := first.VerifySeal(outOfTurn); !IsRuleError(err, ErrBadSeal) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadSeal)
+	}
+
+	badHash := block
+	badHash.Hash = genesis.Hash
+	if err := first.VerifySeal(badHash); !IsRuleError(err, ErrBadBlockHash) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadBlockHash)
+	}
+
+	// Sealing waits for the target spacing after the parent.
+	chainParams.TargetSpacing = 1000
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := second.Seal(ctx, candidate, getHeader); err != context.Canceled {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, context.Canceled)
+	}
+}
+
+func TestBlockChain_MineBlockPoA(test *testing.T) {
+	dir, err := ioutil.TempDir("", "blockchain")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := db_pkg.Open(filepath.Join(dir, "chain.db"), 0600, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+	signers := []*wallet.Wallet{wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()}
+	chainParams := newTestPoAParams(signers...)
+	genesis, err := NewGenesisBlock(NewCoinBaseTX(string(signers[0].GetAddress()), CalcBlockSubsidy(0, chainParams), 0), chainParams)
+	if err != nil {
+		test.Fatal(err)
+	}
+	err = db.PutArray(
+		[][]byte{genesis.Hash, utils.LAST_BLOCK_HASH},
+		[][]byte{genesis.Serialize(), genesis.Hash},
+		utils.BLOCKS_BUCKET, false,
+	)
+	if err != nil {
+		test.Fatal(err)
+	}
+	err = buildHeightIndex(db)
+	if err != nil {
+		test.Fatal(err)
+	}
+	bc := BlockChain{genesis.Hash, db, newOrphanPool(), chainParams, nil}
+	err = UTXOSet{BlockChain: bc}.Reindex()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// Signers take turns, so each of them seals one block of the round.
+	for height := 1; height <= len(signers); height++ {
+		signer := signers[height%len(signers)]
+		engine, err := NewEngine(chainParams, nil, signer.PrivateKey)
+		if err != nil {
+			test.Fatal(err)
+		}
+		block, err := bc.MineBlock(context.Background(), engine, string(signer.GetAddress()), nil)
+		if err != nil {
+			test.Fatalf("can not seal block at height %d: %v", height, err)
+		}
+		bc.tip = block.Hash
+		if block.Height != height {
+			test.Errorf("invalid height:\nactual:\n%d\nexpected:\n%d", block.Height, height)
+		}
+	}
+	if height, err := bc.GetBestHeight(); err != nil || height != len(signers) {
+		test.Errorf("invalid best height:\nactual:\n%d\nexpected:\n%d", height, len(signers))
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+// CheckTransactionStandard checks that the transaction has a known version
+// and uses standard scripts only. Such transactions are relayed by the node,
+// others are accepted only when they are included in blocks.
+func CheckTransactionStandard(tx types.Transaction) error {
+	if tx.IsCoinBase() {
+		return nil
+	}
+	if tx.Version < 1 || tx.Version > vars.TX_VERSION {
+		return ruleError(ErrBadTxVersion, "transaction %x has version %d", tx.Hash, tx.Version)
+	}
+	for i, vin := range tx.VIn {
+		if len(vin.ScriptSig) > script.MAX_STANDARD_SCRIPTSIG_SIZE {
+			return ruleError(ErrScriptSigSize, "input %d of transaction %x has %d bytes script", i, tx.Hash, len(vin.ScriptSig))
+		}
+		if !script.IsPushOnly(vin.ScriptSig) {
+			return ruleError(ErrScriptSigNotPushOnly, "input %d of transaction %x", i, tx.Hash)
+		}
+	}
+	nullDataOutputs := 0
+	for i, out := range tx.VOut {
+		if !script.IsStandard(out.ScriptPubKey) {
+			return ruleError(ErrNonStandardScript, "output %d of transaction %x", i, tx.Hash)
+		}
+		if script.GetScriptClass(out.ScriptPubKey) == script.NULL_DATA {
+			nullDataOutputs++
+		}
+	}
+	if nullDataOutputs > 1 {
+		return ruleError(ErrMultiOpReturn, "transaction %x has %d null data outputs", tx.Hash, nullDataOutputs)
+	}
+	return nil
+}
+
+// CheckTransactionFee checks that given fee paid by the transaction covers
+// its size at the minimum relay fee rate vars.MIN_FEE_PER_BYTE.
+func CheckTransactionFee(tx types.Transaction, fee amount.Amount) error {
+	if tx.IsCoinBase() {
+		return nil
+	}
+	minFee := amount.Amount(tx.Size()) * vars.MIN_FEE_PER_BYTE
+	if fee < minFee {
+		return ruleError(ErrMinRelayFee, "transaction %x pays %s, minimum is %s", tx.Hash, fee, minFee)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+)
+
+func TestCheckTransactionStandard(test *testing.T) {
+	w := wallet.NewWallet()
+	input := tx_io.TXInput{PreviousTx: []byte{1, 2, 3}, VOut: 0}
+	output := tx_io.NewTXOutput(1, string(w.GetAddress()))
+	nullData, err := script.NullDataScript([]byte("data"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	nullDataOutput := tx_io.TXOutput{ScriptPubKey: nullData}
+	data := []struct {
+		tx     types.Transaction
+		reason error
+	}{
+		{types.Transaction{Version: vars.TX_VERSION, VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{output, nullDataOutput}}, nil},
+		{types.Transaction{Version: vars.TX_VERSION + 1, VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{output}}, ErrBadTxVersion},
+		{types.Transaction{Version: 1, VIn: []tx_io.TXInput{{PreviousTx: []byte{1}, ScriptSig: []byte{script.OP_1, script.OP_DUP}}}, VOut: []tx_io.TXOutput{output}}, ErrScriptSigNotPushOnly},
+		{types.Transaction{Version: 1, VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{{Value: 1, ScriptPubKey: []byte{script.OP_1}}}}, ErrNonStandardScript},
+		{types.Transaction{Version: 1, VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{nullDataOutput, nullDataOutput}}, ErrMultiOpReturn},
+	}
+	for i, item := range data {
+		err := CheckTransactionStandard(item.tx)
+		if (item.reason == nil && err != nil) || (item.reason != nil && !IsRuleError(err, item.reason)) {
+			test.Errorf("core.TestCheckTransactionStandard[%d]: invalid error:\nactual:\n%v\nexpected:\n%v", i, err, item.reason)
+		}
+	}
+}
+
+func TestCheckTransactionFee(test *testing.T) {
+	tx := types.Transaction{
+		Version: vars.TX_VERSION,
+		VIn:     []tx_io.TXInput{{PreviousTx: []byte{1, 2, 3}, VOut: 0}},
+		VOut:    []tx_io.TXOutput{tx_io.NewTXOutput(1, string(wallet.NewWallet().GetAddress()))},
+	}
+	minFee := amount.Amount(tx.Size()) * vars.MIN_FEE_PER_BYTE
+	if err := CheckTransactionFee(tx, minFee); err != nil {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+	if err := CheckTransactionFee(tx, minFee-1); !IsRuleError(err, ErrMinRelayFee) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrMinRelayFee)
+	}
+	if fee := tx.CalculateFee(0); fee != minFee {
+		test.Errorf("invalid fee:\nactual:\n%s\nexpected:\n%s", fee, minFee)
+	}
+}
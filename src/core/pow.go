@@ -17,70 +17,230 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"fmt"
+	"math"
 	"math/big"
+	"runtime"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
-	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/x11"
-	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
 
+const (
+	// HASH_BATCH is the number of hashes a mining goroutine computes between
+	// checks of cancellation and updates of statistics.
+	HASH_BATCH = 256
+
+	// MAX_EXTRA_NONCE limits the extra nonce of coinbase transactions,
+	// which is increased when the nonce space of the header is exhausted.
+	MAX_EXTRA_NONCE = math.MaxUint32
+)
+
+var ErrNonceExhausted = errors.New("no nonce satisfies proof of work")
+
 type Worker struct {
-	block  types.Block
-	target *big.Int
+	block    types.Block
+	target   *big.Int
+	hasher   PowHasher
+	maxNonce int
 }
 
-func NewProofOfWork(block types.Block) Worker {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-vars.TARGET_BITS))
-	worker := Worker{block, target}
+// NewProofOfWork creates a worker which hashes the block's header
+// with given hasher, see NewPowHasher.
+func NewProofOfWork(block types.Block, hasher PowHasher) Worker {
+	target := CompactToBig(block.Bits)
+	worker := Worker{block: block, target: target, hasher: hasher, maxNonce: vars.MAX_NONCE}
 	return worker
 }
 
+// NewProofOfWorkWithTarget creates a worker which searches for a hash lower
+// than given target instead of the one set by block's bits, e.g. for shares
+// of a mining pool.
+func NewProofOfWorkWithTarget(block types.Block, target *big.Int, hasher PowHasher) Worker {
+	return Worker{block: block, target: target, hasher: hasher, maxNonce: vars.MAX_NONCE}
+}
+
 func (w *Worker) prepareData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			w.block.PrevBlockHash,
-			w.block.HashTransactions(),
-			utils.IntToHex(w.block.Timestamp),
-			utils.IntToHex(int64(vars.TARGET_BITS)),
-			utils.IntToHex(int64(nonce)),
-		},
-		[]byte{},
-	)
-	return data
+	header := w.block.BlockHeader
+	header.Nonce = nonce
+	return header.Bytes()
 }
 
-func (w *Worker) Run() (int, []byte, error) {
-	var hashInt big.Int
-	var hash [32]byte
-	nonce := 0
-	for nonce < vars.MAX_NONCE {
-		if atomic.LoadInt32(&vars.Syncing) == 1 {
-			return 0, []byte{}, errors.New("mining interrupt")
-		}
-		data := w.prepareData(nonce)
-		hash = x11.Sum256(data)
-		utils.PrintLog(fmt.Sprintf("Mining a new block: %x", hash))
-		hashInt.SetBytes(hash[:])
-		if hashInt.Cmp(w.target) == -1 {
-			break
-		} else {
-			nonce++
+// Run searches for a nonce which makes the hash of the block's header lower
+// than the target and returns the nonce with the hash. The nonce space is
+// split across given number of goroutines, runtime.NumCPU() goroutines are
+// used if it is not positive. Hashes are counted in stats, if it is set.
+// The search stops with the context's error when the context is done and
+// with ErrNonceExhausted when no nonce satisfies the target.
+func (w *Worker) Run(ctx context.Context, threads int, stats *MiningStats) (int, []byte, error) {
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	type solution struct {
+		nonce int
+		hash  []byte
+	}
+	found := make(chan solution, threads)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			var hashInt big.Int
+			hashes := uint64(0)
+			defer func() {
+				stats.add(hashes)
+			}()
+			for nonce := start; nonce < w.maxNonce; nonce += threads {
+				hash := w.hasher.Sum256(w.prepareData(nonce))
+				hashes++
+				hashInt.SetBytes(hash[:])
+				if hashInt.Cmp(w.target) == -1 {
+					found <- solution{nonce, hash[:]}
+					return
+				}
+				if hashes%HASH_BATCH == 0 {
+					stats.add(hashes)
+					hashes = 0
+					select {
+					case <-ctx.Done():
+						return
+					case <-done:
+						return
+					default:
+					}
+				}
+			}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+	result, ok := <-found
+	close(done)
+
+	// Wait for other goroutines to stop, so the worker is not used after Run returns.
+	for range found {
+	}
+	if !ok {
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
 		}
+		return 0, nil, ErrNonceExhausted
+	}
+	return result.nonce, result.hash, nil
+}
+
+// MiningStats counts hashes computed by workers to report the hash rate.
+// It is safe for concurrent use.
+type MiningStats struct {
+	hashes  uint64
+	started time.Time
+}
+
+func NewMiningStats() *MiningStats {
+	return &MiningStats{started: time.Now()}
+}
+
+func (s *MiningStats) add(hashes uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.hashes, hashes)
 	}
-	fmt.Print("\n")
-	return nonce, hash[:], nil
 }
 
+// Hashes returns the number of hashes computed since the stats were created.
+func (s *MiningStats) Hashes() uint64 {
+	return atomic.LoadUint64(&s.hashes)
+}
+
+// HashRate returns the average number of hashes per second since the stats were created.
+func (s *MiningStats) HashRate() float64 {
+	elapsed := time.Since(s.started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Hashes()) / elapsed
+}
+
+// Validate checks that the block's hash is the hash of its header
+// and that it satisfies the target set by header's bits.
 func (w *Worker) Validate() bool {
 	var hashInt big.Int
-	data := w.prepareData(w.block.Nonce)
-	hash := x11.Sum256(data)
-	hashInt.SetBytes(hash[:])
-	isValid := hashInt.Cmp(w.target) == -1
+	if w.target.Sign() <= 0 {
+		return false
+	}
+	hash := HashHeader(w.block.BlockHeader, w.hasher)
+	hashInt.SetBytes(hash)
+	isValid := hashInt.Cmp(w.target) == -1 && bytes.Compare(hash, w.block.Hash) == 0
 	return isValid
 }
+
+// HashHeader returns proof of work hash of given block header.
+func HashHeader(header types.BlockHeader, hasher PowHasher) []byte {
+	hash := hasher.Sum256(header.Bytes())
+	return hash[:]
+}
+
+// CompactToBig converts a target in compact representation used in block
+// headers to a big integer. The compact form is a 32-bit number where the
+// highest byte is the size of the target in bytes and the lower 23 bits are
+// the most significant bits of the target, the 24th bit is the sign.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+	var result *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		result = big.NewInt(int64(mantissa))
+	} else {
+		result = big.NewInt(int64(mantissa))
+		result.Lsh(result, 8*(exponent-3))
+	}
+	if isNegative {
+		result = result.Neg(result)
+	}
+	return result
+}
+
+// BigToCompact converts a target to the compact representation,
+// the precision of the target is reduced to the 23 most significant bits.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Abs(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// If the sign bit is set, divide the mantissa by 256 and increase the exponent.
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// CalcWork returns the amount of work represented by given target, that is
+// the expected number of hashes needed to find a block: 2^256 / (target + 1).
+func CalcWork(target *big.Int) *big.Int {
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	numerator := new(big.Int).Lsh(big.NewInt(1), 256)
+	return numerator.Div(numerator, denominator)
+}
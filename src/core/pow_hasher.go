@@ -0,0 +1,70 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/keccak512"
+	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/x11"
+)
+
+// PowHasher computes proof of work hashes of block headers.
+// Implementations are safe for concurrent use.
+type PowHasher interface {
+	Sum256(data []byte) [32]byte
+}
+
+// NewPowHasher returns the hasher of given proof of work algorithm.
+func NewPowHasher(algorithm params.PowAlgorithm) (PowHasher, error) {
+	switch algorithm {
+	case params.POW_X11:
+		return x11Hasher{}, nil
+	case params.POW_DOUBLE_SHA256:
+		return doubleSHA256Hasher{}, nil
+	case params.POW_KECCAK:
+		return keccakHasher{}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("unknown proof of work algorithm %d", algorithm))
+}
+
+type x11Hasher struct{}
+
+func (x11Hasher) Sum256(data []byte) [32]byte {
+	return x11.Sum256(data)
+}
+
+type doubleSHA256Hasher struct{}
+
+func (doubleSHA256Hasher) Sum256(data []byte) [32]byte {
+	hash := sha256.Sum256(data)
+	return sha256.Sum256(hash[:])
+}
+
+type keccakHasher struct{}
+
+func (keccakHasher) Sum256(data []byte) [32]byte {
+	digest := keccak512.New()
+	digest.Write(data)
+	var hash [64]byte
+	digest.Close(hash[:], 0, 0)
+	var result [32]byte
+	copy(result[:], hash[:])
+	return result
+}
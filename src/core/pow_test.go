@@ -15,8 +15,104 @@
 
 package core
 
-import "testing"
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
 
-func TestPoW(test *testing.T) {
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+)
 
+var CompactToBig_Data = []struct {
+	compact  uint32
+	expected string
+}{
+	{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+	{0x1b0404cb, "404cb000000000000000000000000000000000000000000000000"},
+	{0x1f00ffff, "ffff00000000000000000000000000000000000000000000000000000000"},
+	{0x03123456, "123456"},
+	{0x02123456, "1234"},
+	{0x00000000, "0"},
+}
+
+func TestCompactToBig(test *testing.T) {
+	for i, data := range CompactToBig_Data {
+		actual := CompactToBig(data.compact)
+		if actual.Text(16) != data.expected {
+			test.Errorf("core.TestCompactToBig[%d]:\nactual:\n%s\nexpected:\n%s", i, actual.Text(16), data.expected)
+		}
+	}
+}
+
+func TestBigToCompact(test *testing.T) {
+	for i, data := range CompactToBig_Data {
+		if data.compact == 0x02123456 {
+			continue
+		}
+		n, _ := new(big.Int).SetString(data.expected, 16)
+		actual := BigToCompact(n)
+		if actual != data.compact {
+			test.Errorf("core.TestBigToCompact[%d]:\nactual:\n%x\nexpected:\n%x", i, actual, data.compact)
+		}
+	}
+	target := new(big.Int).Lsh(big.NewInt(1), 240)
+	if actual := CompactToBig(BigToCompact(target)); actual.Cmp(target) != 0 {
+		test.Errorf("core.TestBigToCompact: target is not preserved:\nactual:\n%x\nexpected:\n%x", actual, target)
+	}
+}
+
+func TestWorker_Run(test *testing.T) {
+	header := types.BlockHeader{Timestamp: time.Now().Unix(), Bits: BigToCompact(params.RegTestParams.PowLimit)}
+	block := types.Block{BlockHeader: header, Transactions: []types.Transaction{newTestCoinBase()}}
+	block.MerkleRoot = consensus.HashTransactions(block.Transactions)
+	stats := NewMiningStats()
+	worker := NewProofOfWork(block, testHasher)
+	nonce, hash, err := worker.Run(context.Background(), 4, stats)
+	if err != nil {
+		test.Fatal(err)
+	}
+	block.Nonce, block.Hash = nonce, hash
+	if worker := NewProofOfWork(block, testHasher); !worker.Validate() {
+		test.Errorf("invalid proof of work of nonce %d", nonce)
+	}
+	if stats.Hashes() == 0 {
+		test.Error("hashes are not counted")
+	}
+
+	// No nonce satisfies the target of one, so mining ends when the context is done.
+	block.Bits = BigToCompact(big.NewInt(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	worker = NewProofOfWork(block, testHasher)
+	if _, _, err := worker.Run(ctx, 2, stats); err != context.DeadlineExceeded {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestNewPowHasher(test *testing.T) {
+	data := []struct {
+		algorithm params.PowAlgorithm
+		expected  string
+	}{
+		{params.POW_X11, "51b572209083576ea221c27e62b4e22063257571ccb6cc3dc3cd17eb67584eba"},
+		{params.POW_DOUBLE_SHA256, "5df6e0e2761359d30a8275058e299fcc0381534545f55cf43e41983f5d4c9456"},
+		{params.POW_KECCAK, "0eab42de4c3ceb9235fc91acffe746b29c29a8c366b7c60e4e67c466f36a4304"},
+	}
+	for i, item := range data {
+		hasher, err := NewPowHasher(item.algorithm)
+		if err != nil {
+			test.Fatal(err)
+		}
+		hash := hasher.Sum256([]byte{})
+		if actual := hex.EncodeToString(hash[:]); actual != item.expected {
+			test.Errorf("core.TestNewPowHasher[%d]: invalid hash:\nactual:\n%s\nexpected:\n%s", i, actual, item.expected)
+		}
+	}
+	if _, err := NewPowHasher(params.PowAlgorithm(-1)); err == nil {
+		test.Error("unknown algorithm is accepted")
+	}
 }
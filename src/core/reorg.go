@@ -0,0 +1,211 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// blockWork returns the amount of work spent to find a block with given header.
+func blockWork(header types.BlockHeader) *big.Int {
+	return CalcWork(CompactToBig(header.Bits))
+}
+
+// getBlockFromBucket retrieves and deserializes a block by given hash from the blocks bucket.
+func getBlockFromBucket(b *db_pkg.Bucket, hash []byte) (types.Block, error) {
+	blockData := b.Get(hash)
+	if blockData == nil {
+		return types.Block{}, ErrBlockNotFound
+	}
+	return DeserializeBlock(blockData)
+}
+
+// headerGetterFromTx returns a function which retrieves block headers inside given db transaction.
+func headerGetterFromTx(tx *db_pkg.Tx) headerGetter {
+	return func(hash []byte) (types.BlockHeader, error) {
+		if headers := tx.Bucket(utils.HEADERS_BUCKET); headers != nil {
+			if headerData := headers.Get(hash); headerData != nil {
+				return types.DeserializeBlockHeader(headerData)
+			}
+		}
+		blocks := tx.Bucket(utils.BLOCKS_BUCKET)
+		if blocks == nil {
+			return types.BlockHeader{}, errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+		}
+		block, err := getBlockFromBucket(blocks, hash)
+		return block.BlockHeader, err
+	}
+}
+
+// getChainWork returns total work of the chain which ends with a block by given hash.
+// Blocks written before chain work was tracked have no entry, so their work is
+// calculated from the nearest ancestor that has one and saved if db transaction is writable.
+func getChainWork(tx *db_pkg.Tx, hash []byte) (*big.Int, error) {
+	blocks := tx.Bucket(utils.BLOCKS_BUCKET)
+	if blocks == nil {
+		return nil, errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+	}
+	works := tx.Bucket(utils.CHAIN_WORK_BUCKET)
+
+	// Collect blocks which have no chain work saved, up to the nearest one that has.
+	var missing []types.Block
+	work := big.NewInt(0)
+	for len(hash) > 0 {
+		if works != nil {
+			if workData := works.Get(hash); workData != nil {
+				work.SetBytes(workData)
+				break
+			}
+		}
+		block, err := getBlockFromBucket(blocks, hash)
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, block)
+		hash = block.PrevBlockHash
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		work.Add(work, blockWork(missing[i].BlockHeader))
+		if tx.Writable() {
+			err := putChainWork(tx, missing[i].Hash, work)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return work, nil
+}
+
+func putBlockHeader(tx *db_pkg.Tx, block types.Block) error {
+	b, err := tx.CreateBucketIfNotExists(utils.HEADERS_BUCKET)
+	if err != nil {
+		return err
+	}
+	return b.Put(block.Hash, block.BlockHeader.Serialize())
+}
+
+func putChainWork(tx *db_pkg.Tx, hash []byte, work *big.Int) error {
+	b, err := tx.CreateBucketIfNotExists(utils.CHAIN_WORK_BUCKET)
+	if err != nil {
+		return err
+	}
+	return b.Put(hash, work.Bytes())
+}
+
+// reorganize makes the chain ending with newTip the best one. It finds the fork
+// point of the current best chain and the new one, disconnects blocks of the
+// current chain down to the fork point and connects blocks of the new chain.
+// Must be called inside a writable db transaction, so if any block fails
+// to connect, all changes are rolled back. Disconnected and connected blocks
+// are returned in the order from the fork point up to the tip.
+func (bc *BlockChain) reorganize(tx *db_pkg.Tx, newTip types.Block) ([]types.Block, []types.Block, error) {
+	b := tx.Bucket(utils.BLOCKS_BUCKET)
+	if b == nil {
+		return nil, nil, errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+	}
+	oldTip, err := getBlockFromBucket(b, b.Get(utils.LAST_BLOCK_HASH))
+	if err != nil {
+		return nil, nil, err
+	}
+	var detach, attach []types.Block
+	oldBlock, newBlock := oldTip, newTip
+	for oldBlock.Height > newBlock.Height {
+		detach = append(detach, oldBlock)
+		if oldBlock, err = getBlockFromBucket(b, oldBlock.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+	}
+	for newBlock.Height > oldBlock.Height {
+		attach = append(attach, newBlock)
+		if newBlock, err = getBlockFromBucket(b, newBlock.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+	}
+	for bytes.Compare(oldBlock.Hash, newBlock.Hash) != 0 {
+		if len(oldBlock.PrevBlockHash) == 0 || len(newBlock.PrevBlockHash) == 0 {
+			return nil, nil, errors.New(fmt.Sprintf("block %x has no common ancestor with the best chain", newTip.Hash))
+		}
+		detach = append(detach, oldBlock)
+		attach = append(attach, newBlock)
+		if oldBlock, err = getBlockFromBucket(b, oldBlock.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+		if newBlock, err = getBlockFromBucket(b, newBlock.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(detach) > 0 {
+		utils.PrintLog(fmt.Sprintf("Reorganizing: disconnecting %d and connecting %d blocks after %x\n", len(detach), len(attach), oldBlock.Hash))
+	}
+	for _, block := range detach {
+		err = bc.disconnectBlock(tx, block)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var connected []types.Block
+	for i := len(attach) - 1; i >= 0; i-- {
+		err = bc.connectBlock(tx, attach[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		connected = append(connected, attach[i])
+	}
+	err = b.Put(utils.LAST_BLOCK_HASH, newTip.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	var disconnected []types.Block
+	for i := len(detach) - 1; i >= 0; i-- {
+		disconnected = append(disconnected, detach[i])
+	}
+	return disconnected, connected, nil
+}
+
+// connectBlock appends given block to the best chain: applies it to the UTXO
+// set and indexes it. Must be called inside a writable db transaction.
+func (bc *BlockChain) connectBlock(tx *db_pkg.Tx, block types.Block) error {
+	err := UTXOSet{BlockChain: *bc}.connectBlock(tx, block)
+	if err != nil {
+		return err
+	}
+	err = putHeightIndex(tx, block.Height, block.Hash)
+	if err != nil {
+		return err
+	}
+	return putTxIndex(tx, block)
+}
+
+// disconnectBlock removes given block from the tip of the best chain reverting
+// changes made by connectBlock. Must be called inside a writable db transaction.
+func (bc *BlockChain) disconnectBlock(tx *db_pkg.Tx, block types.Block) error {
+	err := UTXOSet{BlockChain: *bc}.disconnectBlock(tx, block)
+	if err != nil {
+		return err
+	}
+	err = deleteHeightIndex(tx, block.Height)
+	if err != nil {
+		return err
+	}
+	return deleteTxIndex(tx, block)
+}
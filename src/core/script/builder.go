@@ -0,0 +1,82 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import "encoding/binary"
+
+// Builder constructs scripts, errors are deferred until Script is called,
+// so calls can be chained:
+//
+//	script, err := NewBuilder().AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).Script()
+type Builder struct {
+	script []byte
+	err    error
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp appends the opcode to the script.
+func (b *Builder) AddOp(opcode byte) *Builder {
+	b.script = append(b.script, opcode)
+	return b
+}
+
+// AddData appends the shortest push of given data to the script.
+func (b *Builder) AddData(data []byte) *Builder {
+	if len(data) > MAX_SCRIPT_ELEMENT_SIZE {
+		b.err = ErrElementTooBig
+		return b
+	}
+	switch {
+	case len(data) == 0:
+		b.script = append(b.script, OP_0)
+	case len(data) <= OP_DATA_75:
+		b.script = append(b.script, byte(len(data)))
+	case len(data) <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(len(data)))
+	default:
+		b.script = append(b.script, OP_PUSHDATA2, 0, 0)
+		binary.LittleEndian.PutUint16(b.script[len(b.script)-2:], uint16(len(data)))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt64 appends a push of the number, numbers from -1 to 16 use dedicated opcodes.
+func (b *Builder) AddInt64(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(byte(OP_1 - 1 + n))
+	}
+	return b.AddData(encodeNum(n))
+}
+
+// Script returns the built script or the first error occurred while building it.
+func (b *Builder) Script() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.script) > MAX_SCRIPT_SIZE {
+		return nil, ErrScriptTooBig
+	}
+	return b.script, nil
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+// Execution limits of scripts.
+const (
+	MAX_SCRIPT_SIZE          = 10000
+	MAX_SCRIPT_ELEMENT_SIZE  = 520
+	MAX_OPS_PER_SCRIPT       = 201
+	MAX_STACK_SIZE           = 1000
+	MAX_PUBKEYS_PER_MULTISIG = 20
+
+	// Numbers are limited to 4 bytes, lock times to 5 bytes,
+	// so lock times up to 2^39-1 can be expressed.
+	MAX_NUM_SIZE      = 4
+	MAX_LOCKTIME_SIZE = 5
+)
+
+// Standardness limits, scripts which exceed them are valid,
+// but are not relayed by the node.
+const (
+	MAX_STANDARD_SCRIPTSIG_SIZE = 1650
+	MAX_STANDARD_MULTISIG_KEYS  = 3
+	MAX_NULL_DATA_SIZE          = 80
+)
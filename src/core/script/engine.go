@@ -0,0 +1,390 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/ripemd160"
+)
+
+// Checker provides the engine with data of the transaction which spends
+// an output, so the script package does not depend on transaction types.
+type Checker interface {
+	// CheckSig returns nil if sig is a valid signature of the spending
+	// input made by the owner of pubKey.
+	CheckSig(sig, pubKey []byte) error
+
+	// CheckLockTime returns nil if the spending transaction is locked
+	// at least until given lock time.
+	CheckLockTime(lockTime int64) error
+}
+
+// Engine executes an unlocking script of an input followed by the locking
+// script of the output spent by the input. The unlocking script may contain
+// push operations only. The output is unlocked if execution succeeds and
+// leaves true on top of the stack.
+type Engine struct {
+	unlocking []parsedOp
+	locking   []parsedOp
+	checker   Checker
+	stack     [][]byte
+	condStack []bool
+	numOps    int
+}
+
+func NewEngine(scriptSig, scriptPubKey []byte, checker Checker) (*Engine, error) {
+	unlocking, err := parseScript(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range unlocking {
+		if !isPush(op.opcode) {
+			return nil, ErrSigPushOnly
+		}
+	}
+	locking, err := parseScript(scriptPubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{unlocking: unlocking, locking: locking, checker: checker}, nil
+}
+
+// Verify checks that scriptSig unlocks scriptPubKey.
+func Verify(scriptSig, scriptPubKey []byte, checker Checker) error {
+	engine, err := NewEngine(scriptSig, scriptPubKey, checker)
+	if err != nil {
+		return err
+	}
+	return engine.Execute()
+}
+
+// Execute runs both scripts and returns nil if the output is unlocked.
+func (e *Engine) Execute() error {
+	for _, ops := range [][]parsedOp{e.unlocking, e.locking} {
+		e.numOps = 0
+		for _, op := range ops {
+			err := e.step(op)
+			if err != nil {
+				return err
+			}
+		}
+		if len(e.condStack) != 0 {
+			return ErrUnbalancedConditional
+		}
+	}
+	if len(e.stack) == 0 || !asBool(e.stack[len(e.stack)-1]) {
+		return ErrEvalFalse
+	}
+	return nil
+}
+
+// executing reports whether all enclosing conditional branches are taken.
+func (e *Engine) executing() bool {
+	for _, v := range e.condStack {
+		if !v {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) push(data []byte) {
+	e.stack = append(e.stack, data)
+}
+
+func (e *Engine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, ErrInvalidStackOperation
+	}
+	data := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return data, nil
+}
+
+func (e *Engine) popInt() (int64, error) {
+	data, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNum(data, MAX_NUM_SIZE)
+}
+
+func (e *Engine) popBool() (bool, error) {
+	data, err := e.pop()
+	if err != nil {
+		return false, err
+	}
+	return asBool(data), nil
+}
+
+func (e *Engine) step(op parsedOp) error {
+	if len(op.data) > MAX_SCRIPT_ELEMENT_SIZE {
+		return ErrElementTooBig
+	}
+	if !isPush(op.opcode) {
+		e.numOps++
+		if e.numOps > MAX_OPS_PER_SCRIPT {
+			return ErrTooManyOps
+		}
+	}
+	executing := e.executing()
+	if !executing && (op.opcode < OP_IF || op.opcode > OP_ENDIF) {
+		return nil
+	}
+	err := e.execute(op, executing)
+	if err != nil {
+		return err
+	}
+	if len(e.stack) > MAX_STACK_SIZE {
+		return ErrStackOverflow
+	}
+	return nil
+}
+
+func (e *Engine) execute(op parsedOp, executing bool) error {
+	switch {
+	case op.opcode == OP_0:
+		e.push(nil)
+		return nil
+	case op.opcode <= OP_PUSHDATA4:
+		e.push(op.data)
+		return nil
+	case op.opcode == OP_1NEGATE:
+		e.push(encodeNum(-1))
+		return nil
+	case op.opcode >= OP_1 && op.opcode <= OP_16:
+		e.push(encodeNum(int64(asSmallInt(op.opcode))))
+		return nil
+	}
+	switch op.opcode {
+	case OP_NOP:
+	case OP_IF, OP_NOTIF:
+		v := false
+		if executing {
+			cond, err := e.popBool()
+			if err != nil {
+				return err
+			}
+			v = cond == (op.opcode == OP_IF)
+		}
+		e.condStack = append(e.condStack, v)
+	case OP_ELSE:
+		if len(e.condStack) == 0 {
+			return ErrUnbalancedConditional
+		}
+		e.condStack[len(e.condStack)-1] = !e.condStack[len(e.condStack)-1]
+	case OP_ENDIF:
+		if len(e.condStack) == 0 {
+			return ErrUnbalancedConditional
+		}
+		e.condStack = e.condStack[:len(e.condStack)-1]
+	case OP_VERIFY:
+		v, err := e.popBool()
+		if err != nil {
+			return err
+		}
+		if !v {
+			return ErrVerify
+		}
+	case OP_RETURN:
+		return ErrEarlyReturn
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+	case OP_DUP:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(data)
+		e.push(data)
+	case OP_SWAP:
+		if len(e.stack) < 2 {
+			return ErrInvalidStackOperation
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+	case OP_SIZE:
+		if len(e.stack) == 0 {
+			return ErrInvalidStackOperation
+		}
+		e.push(encodeNum(int64(len(e.stack[len(e.stack)-1]))))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if op.opcode == OP_EQUALVERIFY {
+			if !equal {
+				return ErrEqualVerify
+			}
+			return nil
+		}
+		e.push(fromBool(equal))
+	case OP_SHA256:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		e.push(hash[:])
+	case OP_HASH160:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(hash160(data))
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		return e.checkSig(op.opcode == OP_CHECKSIGVERIFY)
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		return e.checkMultiSig(op.opcode == OP_CHECKMULTISIGVERIFY)
+	case OP_CHECKLOCKTIMEVERIFY:
+		return e.checkLockTime()
+	default:
+		return ErrBadOpcode
+	}
+	return nil
+}
+
+func hash160(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	hasher := ripemd160.New()
+	hasher.Write(hash[:])
+	return hasher.Sum(nil)
+}
+
+// checkSig executes OP_CHECKSIG and OP_CHECKSIGVERIFY.
+func (e *Engine) checkSig(verify bool) error {
+	pubKey, err := e.pop()
+	if err != nil {
+		return err
+	}
+	sig, err := e.pop()
+	if err != nil {
+		return err
+	}
+	ok := false
+	if len(sig) > 0 {
+		err = e.checker.CheckSig(sig, pubKey)
+		if err != nil {
+			return err
+		}
+		ok = true
+	}
+	if verify {
+		if !ok {
+			return ErrCheckSigVerify
+		}
+		return nil
+	}
+	e.push(fromBool(ok))
+	return nil
+}
+
+// checkMultiSig executes OP_CHECKMULTISIG and OP_CHECKMULTISIGVERIFY.
+// The stack is expected as <sig 1> ... <sig m> <m> <pubkey 1> ... <pubkey n> <n>,
+// signatures must be in the same order as public keys. Unlike Bitcoin, no
+// extra element is consumed.
+func (e *Engine) checkMultiSig(verify bool) error {
+	numPubKeys, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if numPubKeys < 0 || numPubKeys > MAX_PUBKEYS_PER_MULTISIG {
+		return ErrPubKeyCount
+	}
+	e.numOps += int(numPubKeys)
+	if e.numOps > MAX_OPS_PER_SCRIPT {
+		return ErrTooManyOps
+	}
+	pubKeys := make([][]byte, numPubKeys)
+	for i := len(pubKeys) - 1; i >= 0; i-- {
+		pubKeys[i], err = e.pop()
+		if err != nil {
+			return err
+		}
+	}
+	numSigs, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if numSigs < 0 || numSigs > numPubKeys {
+		return ErrSigCount
+	}
+	sigs := make([][]byte, numSigs)
+	for i := len(sigs) - 1; i >= 0; i-- {
+		sigs[i], err = e.pop()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Every signature is matched against remaining public keys in order.
+	ok := true
+	var checkErr error
+	for sigIdx, keyIdx := 0, 0; sigIdx < len(sigs); keyIdx++ {
+		if len(sigs)-sigIdx > len(pubKeys)-keyIdx || len(sigs[sigIdx]) == 0 {
+			ok = false
+			break
+		}
+		err := e.checker.CheckSig(sigs[sigIdx], pubKeys[keyIdx])
+		if err == nil {
+			sigIdx++
+		} else if checkErr == nil {
+			checkErr = err
+		}
+	}
+	if !ok {
+		for _, sig := range sigs {
+			if len(sig) > 0 {
+				if checkErr != nil {
+					return checkErr
+				}
+				return ErrNullFail
+			}
+		}
+	}
+	if verify {
+		if !ok {
+			return ErrCheckMultiSigVerify
+		}
+		return nil
+	}
+	e.push(fromBool(ok))
+	return nil
+}
+
+// checkLockTime executes OP_CHECKLOCKTIMEVERIFY, the lock time is left on the stack.
+func (e *Engine) checkLockTime() error {
+	if len(e.stack) == 0 {
+		return ErrInvalidStackOperation
+	}
+	lockTime, err := decodeNum(e.stack[len(e.stack)-1], MAX_LOCKTIME_SIZE)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return ErrNegativeLockTime
+	}
+	return e.checker.CheckLockTime(lockTime)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+var errTestBadSig = errors.New("bad signature")
+
+// testChecker accepts signatures made of "sig" followed by the public key.
+type testChecker struct {
+	lockTime int64
+}
+
+func (c testChecker) CheckSig(sig, pubKey []byte) error {
+	if !bytes.Equal(sig, testSig(pubKey)) {
+		return errTestBadSig
+	}
+	return nil
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) error {
+	if lockTime > c.lockTime {
+		return ErrUnsatisfiedLockTime
+	}
+	return nil
+}
+
+func testSig(pubKey []byte) []byte {
+	return append([]byte("sig"), pubKey...)
+}
+
+func testPubKey(b byte) []byte {
+	return append([]byte{0x04}, bytes.Repeat([]byte{b}, 64)...)
+}
+
+func mustScript(test *testing.T, builder *Builder) []byte {
+	s, err := builder.Script()
+	if err != nil {
+		test.Fatal(err)
+	}
+	return s
+}
+
+func TestVerify(test *testing.T) {
+	keys := [][]byte{testPubKey(1), testPubKey(2), testPubKey(3)}
+	preimage := []byte("secret")
+	hash := sha256.Sum256(preimage)
+	p2pkh, _ := PayToPubKeyHashScript(hash160(keys[0]))
+	multiSig, _ := MultiSigScript(2, keys)
+	hashLock, _ := HashLockScript(hash[:], hash160(keys[0]))
+	timeLock, _ := TimeLockScript(100, hash160(keys[0]))
+	tooManyOps := bytes.Repeat([]byte{OP_NOP}, MAX_OPS_PER_SCRIPT+1)
+	data := []struct {
+		name         string
+		scriptSig    []byte
+		scriptPubKey []byte
+		lockTime     int64
+		expected     error
+	}{
+		{"p2pkh", mustScript(test, NewBuilder().AddData(testSig(keys[0])).AddData(keys[0])), p2pkh, 0, nil},
+		{"p2pkh, other key", mustScript(test, NewBuilder().AddData(testSig(keys[1])).AddData(keys[1])), p2pkh, 0, ErrEqualVerify},
+		{"p2pkh, bad signature", mustScript(test, NewBuilder().AddData(testSig(keys[1])).AddData(keys[0])), p2pkh, 0, errTestBadSig},
+		{"p2pkh, empty signature", mustScript(test, NewBuilder().AddData(nil).AddData(keys[0])), p2pkh, 0, ErrEvalFalse},
+		{"multisig", mustScript(test, NewBuilder().AddData(testSig(keys[0])).AddData(testSig(keys[2]))), multiSig, 0, nil},
+		{"multisig, wrong order", mustScript(test, NewBuilder().AddData(testSig(keys[2])).AddData(testSig(keys[0]))), multiSig, 0, errTestBadSig},
+		{"multisig, empty signatures", mustScript(test, NewBuilder().AddData(nil).AddData(nil)), multiSig, 0, ErrEvalFalse},
+		{"multisig, missing signature", mustScript(test, NewBuilder().AddData(testSig(keys[0]))), multiSig, 0, ErrInvalidStackOperation},
+		{"hash lock", mustScript(test, NewBuilder().AddData(testSig(keys[0])).AddData(keys[0]).AddData(preimage)), hashLock, 0, nil},
+		{"hash lock, wrong preimage", mustScript(test, NewBuilder().AddData(testSig(keys[0])).AddData(keys[0]).AddData([]byte("guess"))), hashLock, 0, ErrEqualVerify},
+		{"time lock", mustScript(test, NewBuilder().AddData(testSig(keys[0])).AddData(keys[0])), timeLock, 100, nil},
+		{"time lock, too early", mustScript(test, NewBuilder().AddData(testSig(keys[0])).AddData(keys[0])), timeLock, 99, ErrUnsatisfiedLockTime},
+		{"if", mustScript(test, NewBuilder().AddInt64(1)), mustScript(test, NewBuilder().AddOp(OP_IF).AddInt64(1).AddOp(OP_ELSE).AddInt64(0).AddOp(OP_ENDIF)), 0, nil},
+		{"else", mustScript(test, NewBuilder().AddInt64(0)), mustScript(test, NewBuilder().AddOp(OP_IF).AddInt64(1).AddOp(OP_ELSE).AddInt64(0).AddOp(OP_ENDIF)), 0, ErrEvalFalse},
+		{"unbalanced conditional", mustScript(test, NewBuilder().AddInt64(1)), []byte{OP_IF}, 0, ErrUnbalancedConditional},
+		{"non-push unlocking script", []byte{OP_1, OP_DUP}, []byte{OP_EQUAL}, 0, ErrSigPushOnly},
+		{"early return", nil, []byte{OP_1, OP_RETURN}, 0, ErrEarlyReturn},
+		{"too many operations", nil, append(tooManyOps, OP_1), 0, ErrTooManyOps},
+		{"unknown opcode", nil, []byte{OP_1, 0xff}, 0, ErrBadOpcode},
+		{"malformed push", nil, []byte{OP_PUSHDATA1, 5, 1}, 0, ErrMalformedPush},
+		{"stack underflow", nil, []byte{OP_DUP}, 0, ErrInvalidStackOperation},
+	}
+	for _, item := range data {
+		err := Verify(item.scriptSig, item.scriptPubKey, testChecker{item.lockTime})
+		if err != item.expected {
+			test.Errorf("%s: invalid error:\nactual:\n%v\nexpected:\n%v", item.name, err, item.expected)
+		}
+	}
+}
+
+func TestNum(test *testing.T) {
+	data := []struct {
+		num     int64
+		encoded []byte
+	}{
+		{0, nil},
+		{1, []byte{0x01}},
+		{-1, []byte{0x81}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{-128, []byte{0x80, 0x80}},
+		{500000000, []byte{0x00, 0x65, 0xcd, 0x1d}},
+	}
+	for _, item := range data {
+		encoded := encodeNum(item.num)
+		if !bytes.Equal(encoded, item.encoded) {
+			test.Errorf("invalid encoding of %d:\nactual:\n%x\nexpected:\n%x", item.num, encoded, item.encoded)
+		}
+		num, err := decodeNum(encoded, MAX_NUM_SIZE)
+		if err != nil || num != item.num {
+			test.Errorf("invalid decoded number:\nactual:\n%d %v\nexpected:\n%d <nil>", num, err, item.num)
+		}
+	}
+	if _, err := decodeNum([]byte{1, 2, 3, 4, 5}, MAX_NUM_SIZE); err != ErrNumberTooBig {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNumberTooBig)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import "errors"
+
+var (
+	// Script parsing errors.
+	ErrScriptTooBig  = errors.New("script is too big")
+	ErrElementTooBig = errors.New("push exceeds the maximum element size")
+	ErrMalformedPush = errors.New("script has malformed push")
+	ErrBadOpcode     = errors.New("script has unknown opcode")
+	ErrSigPushOnly   = errors.New("unlocking script contains non-push operations")
+
+	// Script execution errors.
+	ErrTooManyOps            = errors.New("operation limit exceeded")
+	ErrStackOverflow         = errors.New("stack size limit exceeded")
+	ErrInvalidStackOperation = errors.New("operation is not valid with the current stack size")
+	ErrUnbalancedConditional = errors.New("script has unbalanced conditional")
+	ErrNumberTooBig          = errors.New("script number overflow")
+	ErrEarlyReturn           = errors.New("OP_RETURN was encountered")
+	ErrVerify                = errors.New("script failed an OP_VERIFY operation")
+	ErrEqualVerify           = errors.New("script failed an OP_EQUALVERIFY operation")
+	ErrCheckSigVerify        = errors.New("script failed an OP_CHECKSIGVERIFY operation")
+	ErrCheckMultiSigVerify   = errors.New("script failed an OP_CHECKMULTISIGVERIFY operation")
+	ErrPubKeyCount           = errors.New("public key count is out of range")
+	ErrSigCount              = errors.New("signature count is out of range")
+	ErrNegativeLockTime      = errors.New("negative lock time")
+	ErrUnsatisfiedLockTime   = errors.New("lock time requirement is not satisfied")
+	ErrEvalFalse             = errors.New("script evaluated without error but finished with a false/empty top stack element")
+
+	// ErrNullFail is returned when a failed signature check is given
+	// a non-empty signature. Only empty signatures may fail.
+	ErrNullFail = errors.New("signature must be empty if the check failed")
+)
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import "encoding/binary"
+
+// parsedOp is an opcode of a script with the data pushed by it.
+type parsedOp struct {
+	opcode byte
+	data   []byte
+}
+
+// parseScript splits the script into opcodes. Unknown opcodes and pushes
+// which exceed the script are rejected, so a parsed script is always executable.
+func parseScript(script []byte) ([]parsedOp, error) {
+	if len(script) > MAX_SCRIPT_SIZE {
+		return nil, ErrScriptTooBig
+	}
+	var ops []parsedOp
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+		if !isKnownOpcode(opcode) {
+			return nil, ErrBadOpcode
+		}
+		var dataLen int
+		switch {
+		case opcode >= OP_DATA_1 && opcode <= OP_DATA_75:
+			dataLen = int(opcode)
+		case opcode == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			dataLen = int(script[i])
+			i++
+		case opcode == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			dataLen = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case opcode == OP_PUSHDATA4:
+			if i+4 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			dataLen = int(binary.LittleEndian.Uint32(script[i:]))
+			i += 4
+		}
+		if dataLen < 0 || dataLen > len(script)-i {
+			return nil, ErrMalformedPush
+		}
+		op := parsedOp{opcode: opcode}
+		if opcode >= OP_DATA_1 && opcode <= OP_PUSHDATA4 {
+			op.data = script[i : i+dataLen]
+			i += dataLen
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// isPush reports whether the opcode only pushes data to the stack.
+func isPush(opcode byte) bool {
+	return opcode <= OP_16 && opcode != 0x50
+}
+
+// CountSigOps returns the number of signature checks the script may perform.
+// OP_CHECKMULTISIG is counted as MAX_PUBKEYS_PER_MULTISIG checks. Invalid
+// scripts never reach signature checks, so they are counted as zero.
+func CountSigOps(script []byte) int {
+	ops, err := parseScript(script)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, op := range ops {
+		switch op.opcode {
+		case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+			count++
+		case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+			count += MAX_PUBKEYS_PER_MULTISIG
+		}
+	}
+	return count
+}
+
+// IsPushOnly reports whether the script is valid and consists of push operations only.
+func IsPushOnly(script []byte) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if !isPush(op.opcode) {
+			return false
+		}
+	}
+	return true
+}
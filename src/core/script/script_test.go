@@ -0,0 +1,43 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCountSigOps(test *testing.T) {
+	p2pkh, _ := PayToPubKeyHashScript(bytes.Repeat([]byte{1}, 20))
+	multiSig, _ := MultiSigScript(1, [][]byte{testPubKey(1)})
+	verify, _ := NewBuilder().AddOp(OP_CHECKSIGVERIFY).AddOp(OP_CHECKSIG).Script()
+	data := []struct {
+		name   string
+		script []byte
+		sigOps int
+	}{
+		{"p2pkh", p2pkh, 1},
+		{"multisig", multiSig, MAX_PUBKEYS_PER_MULTISIG},
+		{"checksigverify", verify, 2},
+		{"push only", []byte{OP_1, OP_16}, 0},
+		{"malformed push", []byte{OP_CHECKSIG, OP_PUSHDATA1}, 0},
+	}
+	for _, item := range data {
+		if sigOps := CountSigOps(item.script); sigOps != item.sigOps {
+			test.Errorf("%s: invalid number of signature operations:\nactual:\n%d\nexpected:\n%d", item.name, sigOps, item.sigOps)
+		}
+	}
+}
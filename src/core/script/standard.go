@@ -0,0 +1,221 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+// ScriptClass identifies a standard locking script template.
+type ScriptClass byte
+
+const (
+	// NON_STANDARD scripts are valid, but are not relayed.
+	NON_STANDARD ScriptClass = iota
+
+	// PUB_KEY_HASH: OP_DUP OP_HASH160 <pubkey hash> OP_EQUALVERIFY OP_CHECKSIG
+	PUB_KEY_HASH
+
+	// MULTI_SIG: <m> <pubkey 1> ... <pubkey n> <n> OP_CHECKMULTISIG
+	MULTI_SIG
+
+	// HASH_LOCK: OP_SHA256 <hash> OP_EQUALVERIFY followed by PUB_KEY_HASH,
+	// the output is spent by the owner of the key who knows the preimage.
+	HASH_LOCK
+
+	// TIME_LOCK: <lock time> OP_CHECKLOCKTIMEVERIFY OP_DROP followed by
+	// PUB_KEY_HASH, the output can not be spent before the lock time.
+	TIME_LOCK
+
+	// NULL_DATA: OP_RETURN <data>, the output is provably unspendable.
+	NULL_DATA
+)
+
+var scriptClassNames = map[ScriptClass]string{
+	NON_STANDARD: "nonstandard",
+	PUB_KEY_HASH: "pubkeyhash",
+	MULTI_SIG:    "multisig",
+	HASH_LOCK:    "hashlock",
+	TIME_LOCK:    "timelock",
+	NULL_DATA:    "nulldata",
+}
+
+func (c ScriptClass) String() string {
+	return scriptClassNames[c]
+}
+
+// PayToPubKeyHashScript returns a script which locks an output to the owner of the key.
+func PayToPubKeyHashScript(pubKeyHash []byte) ([]byte, error) {
+	return payToPubKeyHash(NewBuilder(), pubKeyHash).Script()
+}
+
+// MultiSigScript returns a script which requires signatures of given
+// number of the public keys, e.g. 2-of-3 for escrow.
+func MultiSigScript(required int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MAX_PUBKEYS_PER_MULTISIG {
+		return nil, ErrPubKeyCount
+	}
+	if required < 1 || required > len(pubKeys) {
+		return nil, ErrSigCount
+	}
+	builder := NewBuilder().AddInt64(int64(required))
+	for _, pubKey := range pubKeys {
+		builder.AddData(pubKey)
+	}
+	return builder.AddInt64(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG).Script()
+}
+
+// HashLockScript returns a script which requires the SHA-256 preimage
+// of the hash and a signature of the owner of the key.
+func HashLockScript(hash, pubKeyHash []byte) ([]byte, error) {
+	builder := NewBuilder().AddOp(OP_SHA256).AddData(hash).AddOp(OP_EQUALVERIFY)
+	return payToPubKeyHash(builder, pubKeyHash).Script()
+}
+
+// TimeLockScript returns a script which locks an output to the owner of
+// the key until given block height or unix time, see vars.LOCKTIME_THRESHOLD.
+func TimeLockScript(lockTime int64, pubKeyHash []byte) ([]byte, error) {
+	if lockTime < 0 {
+		return nil, ErrNegativeLockTime
+	}
+	builder := NewBuilder().AddInt64(lockTime).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP)
+	return payToPubKeyHash(builder, pubKeyHash).Script()
+}
+
+// NullDataScript returns a script of an unspendable output which carries data.
+func NullDataScript(data []byte) ([]byte, error) {
+	return NewBuilder().AddOp(OP_RETURN).AddData(data).Script()
+}
+
+func payToPubKeyHash(builder *Builder, pubKeyHash []byte) *Builder {
+	return builder.AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG)
+}
+
+func isPubKeyHash(ops []parsedOp) bool {
+	return len(ops) == 5 &&
+		ops[0].opcode == OP_DUP &&
+		ops[1].opcode == OP_HASH160 &&
+		len(ops[2].data) == 20 && ops[2].opcode == 20 &&
+		ops[3].opcode == OP_EQUALVERIFY &&
+		ops[4].opcode == OP_CHECKSIG
+}
+
+func isMultiSig(ops []parsedOp) bool {
+	if len(ops) < 4 || ops[len(ops)-1].opcode != OP_CHECKMULTISIG {
+		return false
+	}
+	if !isSmallInt(ops[0].opcode) || !isSmallInt(ops[len(ops)-2].opcode) {
+		return false
+	}
+	required := asSmallInt(ops[0].opcode)
+	numPubKeys := asSmallInt(ops[len(ops)-2].opcode)
+	if required < 1 || numPubKeys != len(ops)-3 || required > numPubKeys {
+		return false
+	}
+	for _, op := range ops[1 : len(ops)-2] {
+		if !isPubKey(op.data) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPubKey reports whether the data looks like a compressed or uncompressed public key.
+func isPubKey(data []byte) bool {
+	switch len(data) {
+	case 33:
+		return data[0] == 0x02 || data[0] == 0x03
+	case 65:
+		return data[0] == 0x04
+	}
+	return false
+}
+
+func isHashLock(ops []parsedOp) bool {
+	return len(ops) == 8 &&
+		ops[0].opcode == OP_SHA256 &&
+		len(ops[1].data) == 32 && ops[1].opcode == 32 &&
+		ops[2].opcode == OP_EQUALVERIFY &&
+		isPubKeyHash(ops[3:])
+}
+
+func isTimeLock(ops []parsedOp) bool {
+	if len(ops) != 8 || ops[1].opcode != OP_CHECKLOCKTIMEVERIFY || ops[2].opcode != OP_DROP {
+		return false
+	}
+	if !isPush(ops[0].opcode) || ops[0].opcode == OP_1NEGATE {
+		return false
+	}
+	lockTime, err := decodeNum(ops[0].data, MAX_LOCKTIME_SIZE)
+	if isSmallInt(ops[0].opcode) {
+		lockTime, err = int64(asSmallInt(ops[0].opcode)), nil
+	}
+	return err == nil && lockTime >= 0 && isPubKeyHash(ops[3:])
+}
+
+func isNullData(ops []parsedOp) bool {
+	return len(ops) == 2 &&
+		ops[0].opcode == OP_RETURN &&
+		isPush(ops[1].opcode) &&
+		len(ops[1].data) <= MAX_NULL_DATA_SIZE
+}
+
+// GetScriptClass returns the template matched by the locking script.
+func GetScriptClass(script []byte) ScriptClass {
+	ops, err := parseScript(script)
+	if err != nil {
+		return NON_STANDARD
+	}
+	switch {
+	case isPubKeyHash(ops):
+		return PUB_KEY_HASH
+	case isMultiSig(ops):
+		return MULTI_SIG
+	case isHashLock(ops):
+		return HASH_LOCK
+	case isTimeLock(ops):
+		return TIME_LOCK
+	case isNullData(ops):
+		return NULL_DATA
+	}
+	return NON_STANDARD
+}
+
+// IsStandard reports whether the locking script matches a standard
+// template and does not exceed standardness limits.
+func IsStandard(script []byte) bool {
+	switch GetScriptClass(script) {
+	case NON_STANDARD:
+		return false
+	case MULTI_SIG:
+		ops, _ := parseScript(script)
+		return len(ops)-3 <= MAX_STANDARD_MULTISIG_KEYS
+	}
+	return true
+}
+
+// ExtractPubKeyHash returns hash of the public key which must sign
+// inputs spending outputs locked by PUB_KEY_HASH, HASH_LOCK and TIME_LOCK
+// scripts, nil is returned for other scripts.
+func ExtractPubKeyHash(script []byte) []byte {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil
+	}
+	switch {
+	case isPubKeyHash(ops):
+		return ops[2].data
+	case isHashLock(ops), isTimeLock(ops):
+		return ops[5].data
+	}
+	return nil
+}
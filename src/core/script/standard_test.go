@@ -0,0 +1,61 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetScriptClass(test *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{1}, 20)
+	keys := [][]byte{testPubKey(1), testPubKey(2), testPubKey(3), testPubKey(4)}
+	p2pkh, _ := PayToPubKeyHashScript(pubKeyHash)
+	multiSig, _ := MultiSigScript(2, keys[:3])
+	bigMultiSig, _ := MultiSigScript(2, keys)
+	hashLock, _ := HashLockScript(bytes.Repeat([]byte{2}, 32), pubKeyHash)
+	timeLock, _ := TimeLockScript(500000001, pubKeyHash)
+	nullData, _ := NullDataScript([]byte("data"))
+	bigNullData, _ := NullDataScript(bytes.Repeat([]byte{3}, MAX_NULL_DATA_SIZE+1))
+	shortHash, _ := PayToPubKeyHashScript(pubKeyHash[:19])
+	data := []struct {
+		name     string
+		script   []byte
+		class    ScriptClass
+		standard bool
+	}{
+		{"p2pkh", p2pkh, PUB_KEY_HASH, true},
+		{"multisig", multiSig, MULTI_SIG, true},
+		{"multisig with 4 keys", bigMultiSig, MULTI_SIG, false},
+		{"hash lock", hashLock, HASH_LOCK, true},
+		{"time lock", timeLock, TIME_LOCK, true},
+		{"null data", nullData, NULL_DATA, true},
+		{"big null data", bigNullData, NON_STANDARD, false},
+		{"short pubkey hash", shortHash, NON_STANDARD, false},
+		{"empty", nil, NON_STANDARD, false},
+	}
+	for _, item := range data {
+		if class := GetScriptClass(item.script); class != item.class {
+			test.Errorf("%s: invalid class:\nactual:\n%s\nexpected:\n%s", item.name, class, item.class)
+		}
+		if standard := IsStandard(item.script); standard != item.standard {
+			test.Errorf("%s: invalid standardness:\nactual:\n%t\nexpected:\n%t", item.name, standard, item.standard)
+		}
+	}
+	if hash := ExtractPubKeyHash(timeLock); !bytes.Equal(hash, pubKeyHash) {
+		test.Errorf("invalid pubkey hash:\nactual:\n%x\nexpected:\n%x", hash, pubKeyHash)
+	}
+}
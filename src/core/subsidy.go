@@ -0,0 +1,66 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+)
+
+// CalcBlockSubsidy returns the reward for mining a block at given height:
+// the initial subsidy halved every SubsidyHalvingInterval blocks, but not
+// less than MinSubsidy.
+func CalcBlockSubsidy(height int, chainParams *params.ChainParams) amount.Amount {
+	subsidy := chainParams.InitialSubsidy
+	if chainParams.SubsidyHalvingInterval > 0 {
+		halvings := uint(height / chainParams.SubsidyHalvingInterval)
+		if halvings >= 63 {
+			subsidy = 0
+		} else {
+			subsidy >>= halvings
+		}
+	}
+	if subsidy < chainParams.MinSubsidy {
+		subsidy = chainParams.MinSubsidy
+	}
+	return subsidy
+}
+
+// CalcTotalSupply returns the number of coins issued by subsidies of all
+// blocks up to given height including the genesis block.
+func CalcTotalSupply(height int, chainParams *params.ChainParams) amount.Amount {
+	if height < 0 {
+		return 0
+	}
+	interval := chainParams.SubsidyHalvingInterval
+	if interval <= 0 {
+		return amount.Amount(height+1) * CalcBlockSubsidy(0, chainParams)
+	}
+	supply := amount.Amount(0)
+	for start := 0; start <= height; start += interval {
+		subsidy := CalcBlockSubsidy(start, chainParams)
+		if subsidy == chainParams.MinSubsidy {
+			// The subsidy does not change anymore.
+			return supply + amount.Amount(height-start+1)*subsidy
+		}
+		blocks := interval
+		if height-start+1 < blocks {
+			blocks = height - start + 1
+		}
+		supply += amount.Amount(blocks) * subsidy
+	}
+	return supply
+}
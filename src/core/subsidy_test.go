@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+)
+
+var testSubsidyParams = params.ChainParams{
+	InitialSubsidy:         50 * amount.COIN,
+	SubsidyHalvingInterval: 10,
+}
+
+func TestCalcBlockSubsidy(test *testing.T) {
+	floorParams := testSubsidyParams
+	floorParams.MinSubsidy = 10 * amount.COIN
+	data := []struct {
+		height      int
+		chainParams *params.ChainParams
+		expected    amount.Amount
+	}{
+		{0, &testSubsidyParams, 50 * amount.COIN},
+		{9, &testSubsidyParams, 50 * amount.COIN},
+		{10, &testSubsidyParams, 25 * amount.COIN},
+		{25, &testSubsidyParams, 12500000},
+		{250, &testSubsidyParams, 1},
+		{260, &testSubsidyParams, 0},
+		{10000, &testSubsidyParams, 0},
+		{10, &floorParams, 25 * amount.COIN},
+		{20, &floorParams, 12500000},
+		{30, &floorParams, 10 * amount.COIN},
+		{10000, &floorParams, 10 * amount.COIN},
+	}
+	for _, item := range data {
+		if actual := CalcBlockSubsidy(item.height, item.chainParams); actual != item.expected {
+			test.Errorf("invalid subsidy at height %d:\nactual:\n%s\nexpected:\n%s", item.height, actual, item.expected)
+		}
+	}
+}
+
+func TestCalcTotalSupply(test *testing.T) {
+	floorParams := testSubsidyParams
+	floorParams.MinSubsidy = 10 * amount.COIN
+	for _, chainParams := range []*params.ChainParams{&testSubsidyParams, &floorParams} {
+		expected := amount.Amount(0)
+		for height := 0; height <= 1000; height++ {
+			expected += CalcBlockSubsidy(height, chainParams)
+			if actual := CalcTotalSupply(height, chainParams); actual != expected {
+				test.Fatalf("invalid total supply at height %d:\nactual:\n%s\nexpected:\n%s", height, actual, expected)
+			}
+		}
+	}
+
+	// Issuance is capped when there is no tail emission.
+	if actual := CalcTotalSupply(1<<30, &params.MainNetParams); actual > amount.MAX_AMOUNT {
+		test.Errorf("total supply exceeds the limit:\nactual:\n%s\nexpected:\n%s", actual, amount.MAX_AMOUNT)
+	}
+}
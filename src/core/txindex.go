@@ -0,0 +1,159 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// Transaction index maps ids of the best chain's transactions to the hash
+// of a block containing the transaction and its position in the block.
+// The index is optional: it is maintained only if its bucket exists,
+// which is created by BlockChain.ReindexTransactions.
+
+func txLocation(blockHash []byte, position int) []byte {
+	location := make([]byte, len(blockHash)+4)
+	copy(location, blockHash)
+	binary.BigEndian.PutUint32(location[len(blockHash):], uint32(position))
+	return location
+}
+
+func parseTxLocation(location []byte) ([]byte, int, error) {
+	if len(location) < 4 {
+		return nil, 0, errors.New(fmt.Sprintf("invalid transaction location '%x'", location))
+	}
+	split := len(location) - 4
+	return location[:split], int(binary.BigEndian.Uint32(location[split:])), nil
+}
+
+func indexTransactions(b *db_pkg.Bucket, block types.Block) error {
+	for i, transaction := range block.Transactions {
+		err := b.Put(transaction.Hash, txLocation(block.Hash, i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putTxIndex(tx *db_pkg.Tx, block types.Block) error {
+	b := tx.Bucket(utils.TX_INDEX_BUCKET)
+	if b == nil {
+		return nil
+	}
+	return indexTransactions(b, block)
+}
+
+func deleteTxIndex(tx *db_pkg.Tx, block types.Block) error {
+	b := tx.Bucket(utils.TX_INDEX_BUCKET)
+	if b == nil {
+		return nil
+	}
+	for _, transaction := range block.Transactions {
+		err := b.Delete(transaction.Hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasTxIndex reports whether the transaction index is enabled.
+func (bc *BlockChain) HasTxIndex() bool {
+	enabled := false
+	bc.db.View(func(tx *db_pkg.Tx) error {
+		enabled = tx.Bucket(utils.TX_INDEX_BUCKET) != nil
+		return nil
+	})
+	return enabled
+}
+
+// ReindexTransactions rebuilds the transaction index from the best chain's
+// blocks, enabling the index if it does not exist. Returns the number of
+// indexed transactions.
+func (bc *BlockChain) ReindexTransactions() (int, error) {
+	vars.DBMutex.Lock()
+	defer vars.DBMutex.Unlock()
+	count := 0
+	err := bc.db.Update(func(tx *db_pkg.Tx) error {
+		err := tx.DeleteBucket(utils.TX_INDEX_BUCKET)
+		if err != nil && err != db_pkg.ErrBucketNotFound {
+			return err
+		}
+		index, err := tx.CreateBucket(utils.TX_INDEX_BUCKET)
+		if err != nil {
+			return err
+		}
+		blocks := tx.Bucket(utils.BLOCKS_BUCKET)
+		if blocks == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+		}
+		hash := blocks.Get(utils.LAST_BLOCK_HASH)
+		for len(hash) > 0 {
+			block, err := getBlockFromBucket(blocks, hash)
+			if err != nil {
+				return err
+			}
+			err = indexTransactions(index, block)
+			if err != nil {
+				return err
+			}
+			count += len(block.Transactions)
+			hash = block.PrevBlockHash
+		}
+		return nil
+	})
+	return count, err
+}
+
+// findIndexedTransaction looks for a transaction using the transaction index.
+// Reports false if the index is disabled.
+func (bc *BlockChain) findIndexedTransaction(ID []byte) (types.Transaction, bool, error) {
+	var transaction types.Transaction
+	enabled := false
+	err := bc.db.View(func(tx *db_pkg.Tx) error {
+		index := tx.Bucket(utils.TX_INDEX_BUCKET)
+		if index == nil {
+			return nil
+		}
+		enabled = true
+		location := index.Get(ID)
+		if location == nil {
+			return ErrTxNotFound
+		}
+		blockHash, position, err := parseTxLocation(location)
+		if err != nil {
+			return err
+		}
+		block, err := getBlockFromBucket(tx.Bucket(utils.BLOCKS_BUCKET), blockHash)
+		if err != nil {
+			return err
+		}
+		if position >= len(block.Transactions) {
+			return errors.New(fmt.Sprintf("transaction position %d is out of block %x", position, blockHash))
+		}
+		transaction = block.Transactions[position]
+		return nil
+	})
+	return transaction, enabled, err
+}
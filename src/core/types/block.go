@@ -19,25 +19,14 @@ import (
 	"bytes"
 	"encoding/gob"
 	"log"
-
-	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
 )
 
+// Block consists of a header and transactions committed to by header's merkle root,
+// see consensus.HashTransactions. Hash is the hash of the header.
 type Block struct {
-	Timestamp     int64
-	Transactions  []Transaction
-	PrevBlockHash []byte
-	Hash          []byte
-	Nonce         int
-	Height        int
-}
-
-func (b Block) HashTransactions() []byte {
-	var transactions [][]byte
-	for _, tx := range b.Transactions {
-		transactions = append(transactions, tx.Serialize())
-	}
-	return consensus.ComputeMerkleRoot(transactions)
+	BlockHeader
+	Transactions []Transaction
+	Hash         []byte
 }
 
 func (b Block) Serialize() []byte {
@@ -49,3 +38,8 @@ func (b Block) Serialize() []byte {
 	}
 	return result.Bytes()
 }
+
+// Size returns the number of bytes of the serialized block.
+func (b Block) Size() int {
+	return len(b.Serialize())
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "errors"
+
+var (
+	ErrTxVInEmpty       = errors.New("bad-txns-vin-empty")
+	ErrTxVOutEmpty      = errors.New("bad-txns-vout-empty")
+	ErrInvalidSignature = errors.New("bad-txns-invalid-signature")
+
+	// ErrPubKeyMismatch is returned when an input is signed with a key
+	// which does not own the output spent by the input.
+	ErrPubKeyMismatch = errors.New("key does not match the spent output")
+
+	// ErrUnsupportedScript is returned when an input spending an output
+	// locked by a script other than PUB_KEY_HASH or TIME_LOCK is signed with a single key.
+	ErrUnsupportedScript = errors.New("output script can not be unlocked with a single key")
+
+	ErrInvalidSigHashType = errors.New("bad-txns-sighash-type")
+	ErrSigHashInputIndex  = errors.New("input index is out of range")
+
+	// ErrSigHashSingle is returned when an input signed with SIGHASH_SINGLE
+	// has no output with the same index.
+	ErrSigHashSingle = errors.New("bad-txns-sighash-single")
+
+	// ErrMissingPrevTx is returned when a transaction spending an output
+	// is signed or verified without the transaction which created the output.
+	ErrMissingPrevTx = errors.New("previous transaction is not found")
+)
@@ -0,0 +1,80 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"log"
+)
+
+// BlockHeader contains block's metadata which is covered by the block's hash.
+// The header commits to block's transactions via the merkle root, so it
+// can be hashed, stored and verified without the transactions.
+type BlockHeader struct {
+	Version       int32
+	PrevBlockHash []byte
+	MerkleRoot    []byte
+	Timestamp     int64
+	Bits          uint32
+	Height        int
+	Nonce         int
+
+	// Seal is the signature of the header by a signer of a proof of authority
+	// network, it is empty on proof of work networks.
+	Seal []byte
+}
+
+// Bytes returns canonical binary encoding of the header which is used for hashing.
+// An empty seal adds no bytes, so hashes of proof of work headers do not depend on it.
+func (h BlockHeader) Bytes() []byte {
+	var buff bytes.Buffer
+	fields := []interface{}{
+		h.Version,
+		h.PrevBlockHash,
+		h.MerkleRoot,
+		h.Timestamp,
+		h.Bits,
+		int64(h.Height),
+		int64(h.Nonce),
+		h.Seal,
+	}
+	for _, field := range fields {
+		err := binary.Write(&buff, binary.BigEndian, field)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	return buff.Bytes()
+}
+
+func (h BlockHeader) Serialize() []byte {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result)
+	err := encoder.Encode(h)
+	if err != nil {
+		log.Panic(err)
+	}
+	return result.Bytes()
+}
+
+func DeserializeBlockHeader(data []byte) (BlockHeader, error) {
+	var header BlockHeader
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&header)
+	return header, err
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"crypto/sha256"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// SigHashType defines which parts of a transaction are covered by
+// the signature of an input. It is appended to the signature as the last byte.
+type SigHashType byte
+
+const (
+	// SIGHASH_ALL signs all inputs and outputs.
+	SIGHASH_ALL SigHashType = 0x01
+
+	// SIGHASH_NONE signs all inputs and none of the outputs.
+	SIGHASH_NONE SigHashType = 0x02
+
+	// SIGHASH_SINGLE signs all inputs and the only output with
+	// the same index as the signed input.
+	SIGHASH_SINGLE SigHashType = 0x03
+
+	// SIGHASH_ANYONECANPAY may be combined with the types above,
+	// in such case only the signed input is covered by the signature.
+	SIGHASH_ANYONECANPAY SigHashType = 0x80
+
+	sigHashMask = 0x1f
+)
+
+// IsValid reports whether the type is one of the defined sighash types,
+// optionally combined with SIGHASH_ANYONECANPAY.
+func (t SigHashType) IsValid() bool {
+	base := t &^ SIGHASH_ANYONECANPAY
+	return base >= SIGHASH_ALL && base <= SIGHASH_SINGLE
+}
+
+// CalcSignatureHash returns the hash which is signed by the input at
+// index inIdx, prevOut is the output spent by the input.
+//
+// The hash of the transaction is not covered as it changes when inputs
+// or outputs are added to a partially signed transaction. The fee is
+// covered, it is a part of the transaction hash and must not be changed
+// by anyone but the signers.
+func (tx *Transaction) CalcSignatureHash(inIdx int, prevOut tx_io.TXOutput, hashType SigHashType) ([]byte, error) {
+	if inIdx < 0 || inIdx >= len(tx.VIn) {
+		return nil, ErrSigHashInputIndex
+	}
+	if !hashType.IsValid() {
+		return nil, ErrInvalidSigHashType
+	}
+	txCopy := tx.TrimmedCopy()
+	txCopy.Hash = nil
+
+	// The signed input commits to the locking script of the spent output.
+	txCopy.VIn[inIdx].ScriptSig = prevOut.ScriptPubKey
+	// Sequences of other inputs are not signed if outputs are not signed
+	// completely, so other signers can update them.
+	switch hashType & sigHashMask {
+	case SIGHASH_NONE:
+		txCopy.VOut = nil
+		clearOtherSequences(txCopy.VIn, inIdx)
+	case SIGHASH_SINGLE:
+		if inIdx >= len(txCopy.VOut) {
+			return nil, ErrSigHashSingle
+		}
+		txCopy.VOut = txCopy.VOut[:inIdx+1]
+		for i := 0; i < inIdx; i++ {
+			txCopy.VOut[i] = tx_io.TXOutput{Value: -1}
+		}
+		clearOtherSequences(txCopy.VIn, inIdx)
+	}
+	if hashType&SIGHASH_ANYONECANPAY != 0 {
+		txCopy.VIn = txCopy.VIn[inIdx : inIdx+1]
+	}
+	data := txCopy.Serialize()
+	data = append(data, utils.IntToHex(int64(prevOut.Value))...)
+	data = append(data, byte(hashType))
+	hash := sha256.Sum256(data)
+	hash = sha256.Sum256(hash[:])
+	return hash[:], nil
+}
+
+func clearOtherSequences(inputs []tx_io.TXInput, inIdx int) {
+	for i := range inputs {
+		if i != inIdx {
+			inputs[i].Sequence = 0
+		}
+	}
+}
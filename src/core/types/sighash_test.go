@@ -0,0 +1,129 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+)
+
+// newTestSpend returns a transaction spending both outputs of a previous
+// transaction paid to w, and the map with the previous transaction.
+func newTestSpend(w *wallet.Wallet) (Transaction, map[string]Transaction) {
+	address := string(w.GetAddress())
+	prevTx := Transaction{
+		VOut: []tx_io.TXOutput{tx_io.NewTXOutput(10*amount.COIN, address), tx_io.NewTXOutput(5*amount.COIN, address)},
+	}
+	prevTx.Hash = prevTx.CalcHash()
+	to := string(wallet.NewWallet().GetAddress())
+	tx := Transaction{
+		VIn: []tx_io.TXInput{
+			{PreviousTx: prevTx.Hash, VOut: 0},
+			{PreviousTx: prevTx.Hash, VOut: 1},
+		},
+		VOut: []tx_io.TXOutput{tx_io.NewTXOutput(8*amount.COIN, to), tx_io.NewTXOutput(6*amount.COIN, to)},
+	}
+	tx.Hash = tx.CalcHash()
+	return tx, map[string]Transaction{hex.EncodeToString(prevTx.Hash): prevTx}
+}
+
+func TestTransaction_SignInput(test *testing.T) {
+	w := wallet.NewWallet()
+	extraInput := tx_io.TXInput{PreviousTx: []byte("extra"), VOut: 0}
+	data := []struct {
+		name     string
+		hashType SigHashType
+		modify   func(tx *Transaction)
+		expected error
+	}{
+		{"all", SIGHASH_ALL, func(tx *Transaction) {}, nil},
+		{"all, output changed", SIGHASH_ALL, func(tx *Transaction) { tx.VOut[1].Value-- }, ErrInvalidSignature},
+		{"all, fee changed", SIGHASH_ALL, func(tx *Transaction) { tx.Fee++ }, ErrInvalidSignature},
+		{"all, input added", SIGHASH_ALL, func(tx *Transaction) { tx.VIn = append(tx.VIn, extraInput) }, ErrInvalidSignature},
+		{"none, outputs changed", SIGHASH_NONE, func(tx *Transaction) { tx.VOut = tx.VOut[:1] }, nil},
+		{"single, other output changed", SIGHASH_SINGLE, func(tx *Transaction) { tx.VOut[1].Value-- }, nil},
+		{"single, own output changed", SIGHASH_SINGLE, func(tx *Transaction) { tx.VOut[0].Value-- }, ErrInvalidSignature},
+		{"anyonecanpay, input added", SIGHASH_ALL | SIGHASH_ANYONECANPAY, func(tx *Transaction) { tx.VIn = append(tx.VIn, extraInput) }, nil},
+		{"anyonecanpay, output changed", SIGHASH_ALL | SIGHASH_ANYONECANPAY, func(tx *Transaction) { tx.VOut[0].Value-- }, ErrInvalidSignature},
+		{"invalid type", SigHashType(0x04), func(tx *Transaction) {}, ErrInvalidSigHashType},
+	}
+	for _, item := range data {
+		tx, prevTXs := newTestSpend(w)
+		prevTx := prevTXs[hex.EncodeToString(tx.VIn[0].PreviousTx)]
+		prevTXs[hex.EncodeToString(extraInput.PreviousTx)] = Transaction{Hash: extraInput.PreviousTx, VOut: prevTx.VOut}
+		// The second input does not restrict modifications checked by the cases.
+		err := tx.SignInput(1, w.PrivateKey, prevTXs, SIGHASH_NONE|SIGHASH_ANYONECANPAY)
+		if err != nil {
+			test.Fatal(err)
+		}
+		err = tx.SignInput(0, w.PrivateKey, prevTXs, item.hashType)
+		if err == nil {
+			item.modify(&tx)
+
+			// An added input is signed by its owner after the modification.
+			for inIdx := 2; inIdx < len(tx.VIn) && err == nil; inIdx++ {
+				err = tx.SignInput(inIdx, w.PrivateKey, prevTXs, SIGHASH_ALL)
+			}
+			if err != nil {
+				test.Fatal(err)
+			}
+			err = tx.Verify(prevTXs)
+		}
+		if err != item.expected {
+			test.Errorf("%s: invalid error:\nactual:\n%v\nexpected:\n%v", item.name, err, item.expected)
+		}
+	}
+}
+
+func TestTransaction_SignInputSingle(test *testing.T) {
+	w := wallet.NewWallet()
+	tx, prevTXs := newTestSpend(w)
+	tx.VOut = tx.VOut[:1]
+	if err := tx.SignInput(1, w.PrivateKey, prevTXs, SIGHASH_SINGLE); err != ErrSigHashSingle {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrSigHashSingle)
+	}
+}
+
+func TestTransaction_VerifyOwnership(test *testing.T) {
+	owner, thief := wallet.NewWallet(), wallet.NewWallet()
+	tx, prevTXs := newTestSpend(owner)
+
+	// The thief cannot sign with a key which does not belong to the input.
+	if err := tx.SignInput(0, thief.PrivateKey, prevTXs, SIGHASH_ALL); err != ErrPubKeyMismatch {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrPubKeyMismatch)
+	}
+
+	// A valid signature made with the thief's own key must not unlock the owner's outputs.
+	for inIdx, vin := range tx.VIn {
+		prevOut := prevTXs[hex.EncodeToString(vin.PreviousTx)].VOut[vin.VOut]
+		signature, err := tx.CreateSignature(inIdx, thief.PrivateKey, prevOut, SIGHASH_ALL)
+		if err != nil {
+			test.Fatal(err)
+		}
+		tx.VIn[inIdx].ScriptSig, err = script.NewBuilder().AddData(signature).AddData(thief.PublicKey).Script()
+		if err != nil {
+			test.Fatal(err)
+		}
+	}
+	if err := tx.Verify(prevTXs); err != script.ErrEqualVerify {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, script.ErrEqualVerify)
+	}
+}
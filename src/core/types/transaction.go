@@ -17,22 +17,31 @@ package types
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
 	"log"
 
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/secp256k1"
 )
 
 type Transaction struct {
+	Version   int
 	Hash      []byte
 	VIn       []tx_io.TXInput
 	VOut      []tx_io.TXOutput
 	Timestamp int64
-	Fee       float64
+	Fee       amount.Amount
+
+	// LockTime is the block height or unix time, see vars.LOCKTIME_THRESHOLD,
+	// before which the transaction can not be included in a block.
+	LockTime int64
 }
 
 func (tx Transaction) IsCoinBase() bool {
@@ -49,111 +58,228 @@ func (tx Transaction) Serialize() []byte {
 	return encoded.Bytes()
 }
 
+func DeserializeTransaction(data []byte) (Transaction, error) {
+	var tx Transaction
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&tx)
+	return tx, err
+}
+
+// IsFinal reports whether the transaction can be included in a block
+// at given height with given median time of previous blocks. Lock time
+// is ignored if all inputs have final sequences.
+func (tx Transaction) IsFinal(height int, blockTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	if tx.LockTime < vars.LOCKTIME_THRESHOLD && tx.LockTime < int64(height) {
+		return true
+	}
+	if tx.LockTime >= vars.LOCKTIME_THRESHOLD && tx.LockTime < blockTime {
+		return true
+	}
+	for _, vin := range tx.VIn {
+		if vin.Sequence != vars.SEQUENCE_FINAL {
+			return false
+		}
+	}
+	return true
+}
+
+// CalcHash returns hash of the transaction. Unlocking scripts of inputs
+// are not covered by the hash, so it does not change when inputs are signed.
 func (tx *Transaction) CalcHash() []byte {
 	var hash [32]byte
 	txCopy := *tx
 	txCopy.Hash = []byte{}
+	txCopy.VIn = make([]tx_io.TXInput, len(tx.VIn))
+	for i, vin := range tx.VIn {
+		if !tx.IsCoinBase() {
+			vin.ScriptSig = nil
+		}
+		txCopy.VIn[i] = vin
+	}
 	hash = sha256.Sum256(txCopy.Serialize())
 	return hash[:]
 }
 
-func (tx *Transaction) Sign(privateKey []byte, prevTXs map[string]Transaction) Transaction {
+// Sign signs all inputs of the transaction with SIGHASH_ALL, see SignInput.
+func (tx *Transaction) Sign(privateKey []byte, prevTXs map[string]Transaction) (Transaction, error) {
 	if tx.IsCoinBase() {
-		return *tx
+		return *tx, nil
 	}
-	for _, vin := range tx.VIn {
-		if prevTXs[hex.EncodeToString(vin.PreviousTx)].Hash == nil {
-			log.Panic("ERROR: Previous transaction is not correct")
+	for inIdx := range tx.VIn {
+		err := tx.SignInput(inIdx, privateKey, prevTXs, SIGHASH_ALL)
+		if err != nil {
+			return Transaction{}, err
 		}
 	}
+	return *tx, nil
+}
+
+// SignInput signs the input at index inIdx over the signature hash of
+// given type. The spent output must be locked to the owner of the private
+// key by PUB_KEY_HASH or TIME_LOCK script, other scripts are unlocked by
+// pushing signatures created by CreateSignature.
+func (tx *Transaction) SignInput(inIdx int, privateKey []byte, prevTXs map[string]Transaction, hashType SigHashType) error {
+	if inIdx < 0 || inIdx >= len(tx.VIn) {
+		return ErrSigHashInputIndex
+	}
+	if !tx.hasPrevTXs(prevTXs) {
+		return ErrMissingPrevTx
+	}
+	vin := tx.VIn[inIdx]
+	prevOut := prevTXs[hex.EncodeToString(vin.PreviousTx)].VOut[vin.VOut]
+	class := script.GetScriptClass(prevOut.ScriptPubKey)
+	if class != script.PUB_KEY_HASH && class != script.TIME_LOCK {
+		return ErrUnsupportedScript
+	}
+	publicKey, err := publicKeyOf(privateKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(wallet.HashPubKey(publicKey), script.ExtractPubKeyHash(prevOut.ScriptPubKey)) {
+		return ErrPubKeyMismatch
+	}
+	signature, err := tx.CreateSignature(inIdx, privateKey, prevOut, hashType)
+	if err != nil {
+		return err
+	}
+	scriptSig, err := script.NewBuilder().AddData(signature).AddData(publicKey).Script()
+	if err != nil {
+		return err
+	}
+	tx.VIn[inIdx].ScriptSig = scriptSig
+	return nil
+}
 
-	//	fmt.Printf("\n\nPUB KEY (sign): %x\n", append(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()...))
+// CreateSignature returns the signature of the input at index inIdx,
+// which spends prevOut, in [R || S || V || hash type] format.
+func (tx *Transaction) CreateSignature(inIdx int, privateKey []byte, prevOut tx_io.TXOutput, hashType SigHashType) ([]byte, error) {
+	sigHash, err := tx.CalcSignatureHash(inIdx, prevOut, hashType)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := secp256k1.Sign(sigHash, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return append(signature, byte(hashType)), nil
+}
 
-	txCopy := tx.TrimmedCopy()
+// publicKeyOf returns the public key of the private key in uncompressed form.
+func publicKeyOf(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != 32 {
+		return nil, secp256k1.ErrInvalidKey
+	}
+	curve := secp256k1.S256()
+	x, y := curve.ScalarBaseMult(privateKey)
+	return elliptic.Marshal(curve, x, y), nil
+}
 
-	for inID, vIn := range tx.VIn {
-		prevTx := prevTXs[hex.EncodeToString(vIn.PreviousTx)]
-		txCopy.VIn[inID].Signature = nil
-		txCopy.VIn[inID].PubKey = prevTx.VOut[vIn.VOut].PubKeyHash
-		//	dataToSign := fmt.Sprintf("%x\n", txCopy)
-		signature, err := secp256k1.Sign(tx.Hash, privateKey)
-		if err != nil {
-			log.Panic(err)
+// hasPrevTXs checks that outputs spent by the transaction are in prevTXs.
+func (tx *Transaction) hasPrevTXs(prevTXs map[string]Transaction) bool {
+	for _, vin := range tx.VIn {
+		prevTx := prevTXs[hex.EncodeToString(vin.PreviousTx)]
+		if prevTx.Hash == nil || vin.VOut < 0 || vin.VOut >= len(prevTx.VOut) {
+			return false
 		}
-		tx.VIn[inID].Signature = signature
-		//	txCopy.VIn[inID].PubKey = nil
 	}
-	return *tx
+	return true
 }
 
 func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []tx_io.TXInput
 	var outputs []tx_io.TXOutput
 	for _, vin := range tx.VIn {
-		inputs = append(inputs, tx_io.TXInput{PreviousTx: vin.PreviousTx, VOut: vin.VOut, PubKey: nil, Signature: nil})
+		inputs = append(inputs, tx_io.TXInput{PreviousTx: vin.PreviousTx, VOut: vin.VOut, ScriptSig: nil, Sequence: vin.Sequence})
 	}
 	for _, vOut := range tx.VOut {
-		outputs = append(outputs, tx_io.TXOutput{Value: vOut.Value, PubKeyHash: vOut.PubKeyHash})
+		outputs = append(outputs, tx_io.TXOutput{Value: vOut.Value, ScriptPubKey: vOut.ScriptPubKey})
 	}
-	txCopy := Transaction{Hash: tx.Hash, VIn: inputs, VOut: outputs, Timestamp: tx.Timestamp, Fee: tx.Fee}
+	txCopy := Transaction{Version: tx.Version, Hash: tx.Hash, VIn: inputs, VOut: outputs, Timestamp: tx.Timestamp, Fee: tx.Fee, LockTime: tx.LockTime}
 	return txCopy
 }
 
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
+// Verify checks that unlocking scripts of all inputs unlock outputs spent
+// by them, prevTXs must contain transactions which created the outputs.
+func (tx *Transaction) Verify(prevTXs map[string]Transaction) error {
 	if tx.IsCoinBase() {
-		return true
+		return nil
 	}
 	if len(tx.VIn) == 0 {
-		log.Panic("ERROR: bad-txns-vin-empty")
+		return ErrTxVInEmpty
 	}
 	if len(tx.VOut) == 0 {
-		log.Panic("ERROR: bad-txns-vout-empty")
+		return ErrTxVOutEmpty
 	}
-	for _, vin := range tx.VIn {
-		if prevTXs[hex.EncodeToString(vin.PreviousTx)].Hash == nil {
-			log.Panic("ERROR: Previous transaction is not correct")
+	if !tx.hasPrevTXs(prevTXs) {
+		return ErrMissingPrevTx
+	}
+	for inIdx, vin := range tx.VIn {
+		prevOut := prevTXs[hex.EncodeToString(vin.PreviousTx)].VOut[vin.VOut]
+		checker := txChecker{tx: tx, inIdx: inIdx, prevOut: prevOut}
+		err := script.Verify(vin.ScriptSig, prevOut.ScriptPubKey, checker)
+		if err != nil {
+			return err
 		}
 	}
-	txCopy := tx.TrimmedCopy()
+	return nil
+}
 
-	//	fmt.Printf("LOG: tx hash: %x == tx copy hash: %x ? %t",
-	//		tx.CalcHash(), txCopy.CalcHash(),
-	//		fmt.Sprintf("%x", tx.CalcHash()) == fmt.Sprintf("%x", txCopy.CalcHash()),
-	//	)
-	for inID, vin := range tx.VIn {
-		prevTx := prevTXs[hex.EncodeToString(vin.PreviousTx)]
-		//	txCopy.VIn[inID].Signature = nil
-		txCopy.VIn[inID].PubKey = prevTx.VOut[vin.VOut].PubKeyHash
-		/*
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
-		*/
-		//	x, y := big.Int{}, big.Int{}
-		//	x.SetBytes(vin.PubKey[:(len(vin.PubKey) / 2)])
-		//	y.SetBytes(vin.PubKey[(len(vin.PubKey) / 2):])
-
-		//	pubKey := ecdsa.PublicKey{X: &x, Y: &y, Curve: secp256k1.S256()}
-
-		//	fmt.Printf("\nVIN PUB KEY (verify): %x\n\n", vin.PubKey)
-		//	fmt.Printf("\nPUB KEY (verify): %x\n\n\n", pubKey)
-
-		if !secp256k1.VerifySignature(vin.PubKey, tx.Hash, vin.Signature) {
-			return false
-		}
-		//	txCopy.VIn[inID].PubKey = nil
+// txChecker checks signatures and lock times for the script engine
+// while the input at index inIdx is verified.
+type txChecker struct {
+	tx      *Transaction
+	inIdx   int
+	prevOut tx_io.TXOutput
+}
+
+func (c txChecker) CheckSig(sig, pubKey []byte) error {
+	// Signature is in [R || S || V || hash type] format, the recovery id is not needed for verification.
+	if len(sig) != 66 {
+		return ErrInvalidSignature
 	}
-	return true
+	sigHash, err := c.tx.CalcSignatureHash(c.inIdx, c.prevOut, SigHashType(sig[65]))
+	if err != nil {
+		return err
+	}
+	if !secp256k1.VerifySignature(pubKey, sigHash, sig[:64]) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// CheckLockTime requires the lock time of the transaction to be of the
+// same kind, height or time, and not less than given lock time. The lock
+// time must not be disabled by a final sequence of the input.
+func (c txChecker) CheckLockTime(lockTime int64) error {
+	if c.tx.VIn[c.inIdx].Sequence == vars.SEQUENCE_FINAL {
+		return script.ErrUnsatisfiedLockTime
+	}
+	if (lockTime < vars.LOCKTIME_THRESHOLD) != (c.tx.LockTime < vars.LOCKTIME_THRESHOLD) {
+		return script.ErrUnsatisfiedLockTime
+	}
+	if lockTime > c.tx.LockTime {
+		return script.ErrUnsatisfiedLockTime
+	}
+	return nil
+}
+
+// Size returns the number of bytes of the serialized transaction.
+func (tx Transaction) Size() int {
+	return len(tx.Serialize())
 }
 
-func (tx *Transaction) CalculateFee(feePerByte float64) float64 {
+// CalculateFee returns the fee the transaction pays at given fee rate, which
+// is raised to the minimum relay fee rate. Inputs must be signed before,
+// otherwise the size of unlocking scripts is not taken into account.
+func (tx *Transaction) CalculateFee(feePerByte amount.Amount) amount.Amount {
 	if tx.IsCoinBase() {
-		return 0.0
+		return 0
 	}
 	if feePerByte < vars.MIN_FEE_PER_BYTE {
 		feePerByte = vars.MIN_FEE_PER_BYTE
 	}
-	return float64(len(tx.VIn)*148+len(tx.VOut)*34+10) * vars.MIN_FEE_PER_BYTE
+	return amount.Amount(tx.Size()) * feePerByte
 }
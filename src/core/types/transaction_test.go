@@ -15,8 +15,83 @@
 
 package types
 
-import "testing"
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+)
 
 func TestTransaction(test *testing.T) {
 
 }
+
+// newTestScriptSpend returns a transaction spending an output locked by
+// given script, and the map with the previous transaction.
+func newTestScriptSpend(scriptPubKey []byte, lockTime int64) (Transaction, map[string]Transaction) {
+	prevTx := Transaction{VOut: []tx_io.TXOutput{{Value: amount.COIN, ScriptPubKey: scriptPubKey}}}
+	prevTx.Hash = prevTx.CalcHash()
+	tx := Transaction{
+		VIn:      []tx_io.TXInput{{PreviousTx: prevTx.Hash, VOut: 0}},
+		VOut:     []tx_io.TXOutput{tx_io.NewTXOutput(amount.COIN, string(wallet.NewWallet().GetAddress()))},
+		LockTime: lockTime,
+	}
+	tx.Hash = tx.CalcHash()
+	return tx, map[string]Transaction{hex.EncodeToString(prevTx.Hash): prevTx}
+}
+
+func TestTransaction_VerifyMultiSig(test *testing.T) {
+	wallets := []*wallet.Wallet{wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()}
+	scriptPubKey, err := script.MultiSigScript(2, [][]byte{wallets[0].PublicKey, wallets[1].PublicKey, wallets[2].PublicKey})
+	if err != nil {
+		test.Fatal(err)
+	}
+	tx, prevTXs := newTestScriptSpend(scriptPubKey, 0)
+	if err := tx.SignInput(0, wallets[0].PrivateKey, prevTXs, SIGHASH_ALL); err != ErrUnsupportedScript {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrUnsupportedScript)
+	}
+	prevOut := prevTXs[hex.EncodeToString(tx.VIn[0].PreviousTx)].VOut[0]
+	builder := script.NewBuilder()
+	for _, w := range []*wallet.Wallet{wallets[0], wallets[2]} {
+		signature, err := tx.CreateSignature(0, w.PrivateKey, prevOut, SIGHASH_ALL)
+		if err != nil {
+			test.Fatal(err)
+		}
+		builder.AddData(signature)
+	}
+	tx.VIn[0].ScriptSig, err = builder.Script()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := tx.Verify(prevTXs); err != nil {
+		test.Errorf("invalid verification result:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+}
+
+func TestTransaction_VerifyTimeLock(test *testing.T) {
+	w := wallet.NewWallet()
+	scriptPubKey, err := script.TimeLockScript(100, wallet.HashPubKey(w.PublicKey))
+	if err != nil {
+		test.Fatal(err)
+	}
+	for _, lockTime := range []int64{99, 100} {
+		tx, prevTXs := newTestScriptSpend(scriptPubKey, lockTime)
+		if err := tx.SignInput(0, w.PrivateKey, prevTXs, SIGHASH_ALL); err != nil {
+			test.Fatal(err)
+		}
+		expected := error(nil)
+		if lockTime < 100 {
+			expected = script.ErrUnsatisfiedLockTime
+		}
+		if err := tx.Verify(prevTXs); err != expected {
+			test.Errorf("invalid error for lock time %d:\nactual:\n%v\nexpected:\n%v", lockTime, err, expected)
+		}
+	}
+	tx, _ := newTestScriptSpend(scriptPubKey, 100)
+	if tx.IsFinal(100, 0) || !tx.IsFinal(101, 0) {
+		test.Error("transaction locked until height 100 must be final since height 101")
+	}
+}
@@ -15,20 +15,12 @@
 
 package tx_io
 
-import (
-	"bytes"
-
-	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
-)
-
+// TXInput spends an output of a previous transaction, ScriptSig
+// unlocks the locking script of the output. Sequence holds relative
+// lock time of the input, see vars.SEQUENCE_LOCKTIME_DISABLE_FLAG.
 type TXInput struct {
 	PreviousTx []byte
 	VOut       int
-	Signature  []byte
-	PubKey    []byte
+	ScriptSig  []byte
+	Sequence   uint32
 }
-
-func (in TXInput) UsesKey(pubKeyHash []byte) bool {
-	return bytes.Compare(wallet.HashPubKey(in.PubKey), pubKeyHash) == 0
-}
-
@@ -17,26 +17,39 @@ package tx_io
 
 import (
 	"bytes"
+	"log"
 
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
 	"github.com/YuriyLisovskiy/blockchain-go/src/encoding/base58"
 )
 
+// TXOutput holds the value which can be spent by an input
+// which unlocks ScriptPubKey.
 type TXOutput struct {
-	Value      float64
-	PubKeyHash []byte
+	Value        amount.Amount
+	ScriptPubKey []byte
 }
 
+// Lock locks the output to the owner of the address with a pay-to-pubkey-hash script.
 func (out *TXOutput) Lock(address []byte) {
 	pubKeyHash := base58.Decode(address)
 	pubKeyHash = pubKeyHash[1: len(pubKeyHash)-4]
-	out.PubKeyHash = pubKeyHash
+	scriptPubKey, err := script.PayToPubKeyHashScript(pubKeyHash)
+	if err != nil {
+		log.Panic(err)
+	}
+	out.ScriptPubKey = scriptPubKey
 }
 
+// IsLockedWithKey reports whether the output is locked with a
+// pay-to-pubkey-hash script to given key.
 func (out TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
+	return script.GetScriptClass(out.ScriptPubKey) == script.PUB_KEY_HASH &&
+		bytes.Compare(script.ExtractPubKeyHash(out.ScriptPubKey), pubKeyHash) == 0
 }
 
-func NewTXOutput(value float64, address string) TXOutput {
+func NewTXOutput(value amount.Amount, address string) TXOutput {
 	txo := TXOutput{value, nil}
 	txo.Lock([]byte(address))
 	return txo
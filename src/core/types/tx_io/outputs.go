@@ -21,8 +21,14 @@ import (
 	"log"
 )
 
+// TXOutputs holds unspent outputs of a single transaction keyed by their
+// index in the transaction, so spending one output does not shift the others.
+// Height is the height of the block which includes the transaction and
+// IsCoinBase tells whether the transaction is a coinbase.
 type TXOutputs struct {
-	Outputs []TXOutput
+	Outputs    map[int]TXOutput
+	Height     int
+	IsCoinBase bool
 }
 
 func (outs TXOutputs) Serialize() []byte {
@@ -35,12 +41,12 @@ func (outs TXOutputs) Serialize() []byte {
 	return buff.Bytes()
 }
 
-func DeserializeOutputs(data []byte) TXOutputs {
+func DeserializeOutputs(data []byte) (TXOutputs, error) {
 	var outputs TXOutputs
 	dec := gob.NewDecoder(bytes.NewReader(data))
 	err := dec.Decode(&outputs)
-	if err != nil {
-		log.Panic(err)
+	if outputs.Outputs == nil {
+		outputs.Outputs = make(map[int]TXOutput)
 	}
-	return outputs
+	return outputs, err
 }
@@ -0,0 +1,56 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tx_io
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+)
+
+// SpentOutput is an output removed from the UTXO set by an input of a block.
+// Height is the height of the block which created the output and IsCoinBase
+// tells whether it was created by a coinbase.
+type SpentOutput struct {
+	PreviousTx []byte
+	VOut       int
+	Output     TXOutput
+	Height     int
+	IsCoinBase bool
+}
+
+// BlockUndo holds outputs spent by a block in the order they were spent,
+// which is enough to restore the UTXO set when the block is disconnected.
+type BlockUndo struct {
+	SpentOutputs []SpentOutput
+}
+
+func (undo BlockUndo) Serialize() []byte {
+	var buff bytes.Buffer
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(undo)
+	if err != nil {
+		log.Panic(err)
+	}
+	return buff.Bytes()
+}
+
+func DeserializeBlockUndo(data []byte) (BlockUndo, error) {
+	var undo BlockUndo
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&undo)
+	return undo, err
+}
@@ -16,36 +16,51 @@
 package core
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
 
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
 
 type UTXOSet struct {
 	BlockChain BlockChain
 }
 
-func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount float64) (float64, map[string][]int) {
+// FindSpendableOutputs selects outputs locked with given public key hash
+// until they cover given value. Outputs of coinbase transactions which
+// are not mature in the next block are skipped.
+func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, value amount.Amount) (amount.Amount, map[string][]int, error) {
 	unspentOutputs := make(map[string][]int)
-	accumulated := float64(0)
+	accumulated := amount.Amount(0)
 	db := u.BlockChain.db
 	err := db.View(func(tx *db_pkg.Tx) error {
 		b := tx.Bucket(vars.UTXO_BUCKET)
 		if b == nil {
 			return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UTXO_BUCKET))
 		}
+		height, _, err := nextBlockContext(tx)
+		if err != nil {
+			return err
+		}
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			txID := hex.EncodeToString(k)
-			outs := tx_io.DeserializeOutputs(v)
+			outs, err := tx_io.DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			if outs.IsCoinBase && height-outs.Height < u.BlockChain.params.CoinbaseMaturity {
+				continue
+			}
 			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubkeyHash) && accumulated < amount {
+				if out.IsLockedWithKey(pubkeyHash) && accumulated < value {
 					accumulated += out.Value
 					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
 				}
@@ -53,13 +68,10 @@ func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount float64) (float6
 		}
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
-	return accumulated, unspentOutputs
+	return accumulated, unspentOutputs, err
 }
 
-func (u UTXOSet) FindUTXO(pubKeyHash []byte) []tx_io.TXOutput {
+func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]tx_io.TXOutput, error) {
 	db := u.BlockChain.db
 	var UTXOs []tx_io.TXOutput
 	err := db.View(func(tx *db_pkg.Tx) error {
@@ -69,7 +81,10 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []tx_io.TXOutput {
 		}
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			outs := tx_io.DeserializeOutputs(v)
+			outs, err := tx_io.DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
 			for _, out := range outs.Outputs {
 				if out.IsLockedWithKey(pubKeyHash) {
 					UTXOs = append(UTXOs, out)
@@ -78,13 +93,10 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []tx_io.TXOutput {
 		}
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
-	return UTXOs
+	return UTXOs, err
 }
 
-func (u UTXOSet) CountTransactions() int {
+func (u UTXOSet) CountTransactions() (int, error) {
 	db := u.BlockChain.db
 	counter := 0
 	err := db.View(func(tx *db_pkg.Tx) error {
@@ -98,93 +110,235 @@ func (u UTXOSet) CountTransactions() int {
 		}
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
-	return counter
+	return counter, err
 }
 
-func (u UTXOSet) Reindex() {
+// Reindex rebuilds the UTXO set from the best chain's blocks.
+func (u UTXOSet) Reindex() error {
+	UTXO, err := u.BlockChain.FindUTXO()
+	if err != nil {
+		return err
+	}
 	db := u.BlockChain.db
-	err := db.Batch(func(tx *db_pkg.Tx) error {
+	vars.DBMutex.Lock()
+	defer vars.DBMutex.Unlock()
+	return db.Update(func(tx *db_pkg.Tx) error {
 		err := tx.DeleteBucket(vars.UTXO_BUCKET)
 		if err != nil && err != db_pkg.ErrBucketNotFound {
-			log.Panic(err)
+			return err
 		}
-		_, err = tx.CreateBucket(vars.UTXO_BUCKET)
+		b, err := tx.CreateBucket(vars.UTXO_BUCKET)
 		if err != nil {
-			log.Panic(err)
-		}
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
-	}
-	UTXO := u.BlockChain.FindUTXO()
-	err = db.Batch(func(tx *db_pkg.Tx) error {
-		b := tx.Bucket(vars.UTXO_BUCKET)
-		if b == nil {
-			return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UTXO_BUCKET))
+			return err
 		}
 		for txID, outs := range UTXO {
 			key, err := hex.DecodeString(txID)
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 			err = b.Put(key, outs.Serialize())
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 		}
 		return nil
 	})
 }
 
-func (u UTXOSet) Update(block types.Block) {
+// Update applies transactions of given block to the UTXO set.
+func (u UTXOSet) Update(block types.Block) error {
 	db := u.BlockChain.db
 	vars.DBMutex.Lock()
-	err := db.Batch(func(tx *db_pkg.Tx) error {
-		b := tx.Bucket([]byte(vars.UTXO_BUCKET))
-		if b == nil {
-			return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UTXO_BUCKET))
+	defer vars.DBMutex.Unlock()
+	return db.Update(func(tx *db_pkg.Tx) error {
+		return u.connectBlock(tx, block)
+	})
+}
+
+// connectBlock removes outputs spent by given block from the UTXO set and
+// adds outputs created by it. Inputs of every transaction are validated against
+// the UTXO set before they are spent. It must be called inside a writable db transaction.
+func (u UTXOSet) connectBlock(tx *db_pkg.Tx, block types.Block) error {
+	b, err := tx.CreateBucketIfNotExists(vars.UTXO_BUCKET)
+	if err != nil {
+		return err
+	}
+	getOutput := func(txHash []byte, index int) (utxoEntry, bool, error) {
+		return getUnspentOutput(b, txHash, index)
+	}
+
+	// Relative lock times are checked against median time of the block's parent.
+	var medianTime int64
+	if len(block.PrevBlockHash) > 0 {
+		getHeader := headerGetterFromTx(tx)
+		parent, err := getHeader(block.PrevBlockHash)
+		if err != nil {
+			return err
 		}
-		for _, tx := range block.Transactions {
-			if tx.IsCoinBase() == false {
-				for _, vin := range tx.VIn {
-					updatedOuts := tx_io.TXOutputs{}
-					outsBytes := b.Get(vin.PreviousTx)
-					outs := tx_io.DeserializeOutputs(outsBytes)
-					for outIdx, out := range outs.Outputs {
-						if outIdx != vin.VOut {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
-					if len(updatedOuts.Outputs) == 0 {
-						err := b.Delete(vin.PreviousTx)
-						if err != nil {
-							log.Panic(err)
-						}
-					} else {
-						err := b.Put(vin.PreviousTx, updatedOuts.Serialize())
-						if err != nil {
-							log.Panic(err)
-						}
-					}
+		medianTime, err = CalcPastMedianTime(parent, getHeader)
+		if err != nil {
+			return err
+		}
+	}
+	getMedianTime := medianTimeGetterFromTx(tx)
+	fees := amount.Amount(0)
+	undo := tx_io.BlockUndo{}
+	for _, transaction := range block.Transactions {
+		fee, err := checkTransactionInputs(transaction, getOutput)
+		if err != nil {
+			return err
+		}
+		err = checkCoinBaseMaturity(transaction, block.Height, u.BlockChain.params.CoinbaseMaturity, getOutput)
+		if err != nil {
+			return err
+		}
+		err = checkSequenceLock(transaction, block.Height, medianTime, getOutput, getMedianTime)
+		if err != nil {
+			return err
+		}
+		fees += fee
+		if transaction.IsCoinBase() == false {
+			for _, vin := range transaction.VIn {
+				outs, err := tx_io.DeserializeOutputs(b.Get(vin.PreviousTx))
+				if err != nil {
+					return err
+				}
+				undo.SpentOutputs = append(undo.SpentOutputs, tx_io.SpentOutput{
+					PreviousTx: vin.PreviousTx,
+					VOut:       vin.VOut,
+					Output:     outs.Outputs[vin.VOut],
+					Height:     outs.Height,
+					IsCoinBase: outs.IsCoinBase,
+				})
+				delete(outs.Outputs, vin.VOut)
+				if len(outs.Outputs) == 0 {
+					err = b.Delete(vin.PreviousTx)
+				} else {
+					err = b.Put(vin.PreviousTx, outs.Serialize())
+				}
+				if err != nil {
+					return err
 				}
-			}
-			newOutputs := tx_io.TXOutputs{}
-			for _, out := range tx.VOut {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
-			}
-			err := b.Put(tx.Hash, newOutputs.Serialize())
-			if err != nil {
-				log.Panic(err)
 			}
 		}
-		return nil
+		if b.Get(transaction.Hash) != nil {
+			return ruleError(ErrDuplicateTx, "transaction %x overwrites unspent outputs", transaction.Hash)
+		}
+		newOutputs := tx_io.TXOutputs{
+			Outputs:    make(map[int]tx_io.TXOutput),
+			Height:     block.Height,
+			IsCoinBase: transaction.IsCoinBase(),
+		}
+		for outIdx, out := range transaction.VOut {
+			newOutputs.Outputs[outIdx] = out
+		}
+		err = b.Put(transaction.Hash, newOutputs.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+	err = checkCoinBaseValue(block, fees, u.BlockChain.params)
+	if err != nil {
+		return err
+	}
+	undoBucket, err := tx.CreateBucketIfNotExists(vars.UNDO_BUCKET)
+	if err != nil {
+		return err
+	}
+	return undoBucket.Put(block.Hash, undo.Serialize())
+}
+
+// Disconnect removes the last block from the best chain, so its parent becomes
+// the tip. Changes made to the UTXO set by the block are reverted using undo
+// data stored when the block was connected and the block is removed from
+// indices. Blocks other than the tip are rejected with ErrNotBestTip.
+func (u UTXOSet) Disconnect(block types.Block) error {
+	bc := u.BlockChain
+	vars.DBMutex.Lock()
+	err := bc.db.Update(func(tx *db_pkg.Tx) error {
+		b := tx.Bucket(utils.BLOCKS_BUCKET)
+		if b == nil {
+			return errors.New(fmt.Sprintf("bucket '%x' does not exist", utils.BLOCKS_BUCKET))
+		}
+		if !bytes.Equal(b.Get(utils.LAST_BLOCK_HASH), block.Hash) || len(block.PrevBlockHash) == 0 {
+			return ErrNotBestTip
+		}
+		err := bc.disconnectBlock(tx, block)
+		if err != nil {
+			return err
+		}
+		return b.Put(utils.LAST_BLOCK_HASH, block.PrevBlockHash)
 	})
 	vars.DBMutex.Unlock()
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	if bc.listener != nil {
+		bc.listener([]types.Block{block}, nil)
+	}
+	return nil
+}
+
+// disconnectBlock removes outputs created by given block from the UTXO set and
+// restores outputs spent by it from the block's undo data. It must be called
+// inside a writable db transaction while the block is still the tip of the
+// chain in the UTXO set.
+func (u UTXOSet) disconnectBlock(tx *db_pkg.Tx, block types.Block) error {
+	b, err := tx.CreateBucketIfNotExists(vars.UTXO_BUCKET)
+	if err != nil {
+		return err
+	}
+	undoBucket := tx.Bucket(vars.UNDO_BUCKET)
+	if undoBucket == nil {
+		return errors.New(fmt.Sprintf("bucket '%x' does not exist", vars.UNDO_BUCKET))
+	}
+	undoData := undoBucket.Get(block.Hash)
+	if undoData == nil {
+		return errors.New(fmt.Sprintf("undo data of block %x is not found", block.Hash))
+	}
+	undo, err := tx_io.DeserializeBlockUndo(undoData)
+	if err != nil {
+		return err
+	}
+	spent := undo.SpentOutputs
+
+	// Outputs are restored in reverse order, so an output created and spent
+	// inside the block is restored before its transaction is removed.
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		transaction := block.Transactions[i]
+		err = b.Delete(transaction.Hash)
+		if err != nil {
+			return err
+		}
+		if transaction.IsCoinBase() {
+			continue
+		}
+		for j := len(transaction.VIn) - 1; j >= 0; j-- {
+			vin := transaction.VIn[j]
+			if len(spent) == 0 {
+				return errors.New(fmt.Sprintf("undo data of block %x is inconsistent", block.Hash))
+			}
+			out := spent[len(spent)-1]
+			spent = spent[:len(spent)-1]
+			if bytes.Compare(out.PreviousTx, vin.PreviousTx) != 0 || out.VOut != vin.VOut {
+				return errors.New(fmt.Sprintf("undo data of block %x is inconsistent", block.Hash))
+			}
+			outs := tx_io.TXOutputs{Outputs: make(map[int]tx_io.TXOutput), Height: out.Height, IsCoinBase: out.IsCoinBase}
+			if outsBytes := b.Get(vin.PreviousTx); outsBytes != nil {
+				outs, err = tx_io.DeserializeOutputs(outsBytes)
+				if err != nil {
+					return err
+				}
+			}
+			outs.Outputs[vin.VOut] = out.Output
+			err = b.Put(vin.PreviousTx, outs.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(spent) != 0 {
+		return errors.New(fmt.Sprintf("undo data of block %x is inconsistent", block.Hash))
 	}
+	return undoBucket.Delete(block.Hash)
 }
@@ -0,0 +1,144 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+)
+
+func readUTXOSet(test *testing.T, bc BlockChain) map[string]tx_io.TXOutputs {
+	utxo := make(map[string]tx_io.TXOutputs)
+	err := bc.db.View(func(tx *db_pkg.Tx) error {
+		return tx.Bucket(vars.UTXO_BUCKET).ForEach(func(k, v []byte) error {
+			outs, err := tx_io.DeserializeOutputs(v)
+			utxo[hex.EncodeToString(k)] = outs
+			return err
+		})
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+	return utxo
+}
+
+func TestUTXOSet_Disconnect(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+	genesisBlock, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		test.Fatal(err)
+	}
+	expected := readUTXOSet(test, bc)
+
+	// The second transaction spends an output created inside the same block.
+	spend := types.Transaction{
+		VIn: []tx_io.TXInput{{PreviousTx: genesisBlock.Transactions[0].Hash, VOut: 0}},
+		VOut: []tx_io.TXOutput{
+			tx_io.NewTXOutput(params.RegTestParams.InitialSubsidy/2, string(w.GetAddress())),
+			tx_io.NewTXOutput(params.RegTestParams.InitialSubsidy/2, string(w.GetAddress())),
+		},
+		Timestamp: time.Now().Unix(),
+	}
+	spend = newTestSignedTx(test, bc, spend, w.PrivateKey)
+	child := types.Transaction{
+		VIn:       []tx_io.TXInput{{PreviousTx: spend.Hash, VOut: 1}},
+		VOut:      []tx_io.TXOutput{tx_io.NewTXOutput(params.RegTestParams.InitialSubsidy/2, string(w.GetAddress()))},
+		Timestamp: time.Now().Unix(),
+	}
+	child.Hash = child.CalcHash()
+	child, err = child.Sign(w.PrivateKey, map[string]types.Transaction{hex.EncodeToString(spend.Hash): spend})
+	if err != nil {
+		test.Fatal(err)
+	}
+	block := newTestBlock(test, []types.Transaction{newTestCoinBase(), spend, child}, bc.tip, 1)
+	if err := bc.AddBlock(block); err != nil {
+		test.Fatal(err)
+	}
+	if utxo := readUTXOSet(test, bc); reflect.DeepEqual(utxo, expected) {
+		test.Fatal("block is not applied to the UTXO set")
+	}
+
+	utxoSet := UTXOSet{BlockChain: bc}
+	if err := utxoSet.Disconnect(genesisBlock); err != ErrNotBestTip {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNotBestTip)
+	}
+	if err := utxoSet.Disconnect(block); err != nil {
+		test.Fatal(err)
+	}
+	if actual := readUTXOSet(test, bc); !reflect.DeepEqual(actual, expected) {
+		test.Errorf("invalid UTXO set:\nactual:\n%v\nexpected:\n%v", actual, expected)
+	}
+	if tip, err := bc.GetBestHash(); err != nil || !bytes.Equal(tip, genesisBlock.Hash) {
+		test.Errorf("invalid tip:\nactual:\n%x\nexpected:\n%x", tip, genesisBlock.Hash)
+	}
+	if _, err := bc.GetBlockByHeight(1); err != ErrBlockNotFound {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBlockNotFound)
+	}
+	if err := utxoSet.Disconnect(block); err != ErrNotBestTip {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNotBestTip)
+	}
+}
+
+func TestUTXOSet_CoinBaseMaturity(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+	bc.params.CoinbaseMaturity = 2
+	genesisBlock, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		test.Fatal(err)
+	}
+	spend := newTestSpend(test, bc, w, genesisBlock.Transactions[0].Hash, params.RegTestParams.InitialSubsidy)
+
+	// The genesis reward is buried under a single block in the next block.
+	pubKeyHash := wallet.HashPubKey(w.PublicKey)
+	utxoSet := UTXOSet{BlockChain: bc}
+	if acc, _, err := utxoSet.FindSpendableOutputs(pubKeyHash, 1); err != nil || acc != 0 {
+		test.Errorf("invalid spendable amount:\nactual:\n%s %v\nexpected:\n0 <nil>", acc, err)
+	}
+	if err := bc.CheckTransactionLocks(spend); !IsRuleError(err, ErrImmatureSpend) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrImmatureSpend)
+	}
+	immature := newTestBlock(test, []types.Transaction{newTestCoinBase(), spend}, bc.tip, 1)
+	if err := bc.AddBlock(immature); !IsRuleError(err, ErrImmatureSpend) {
+		test.Fatalf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrImmatureSpend)
+	}
+
+	b1 := newTestBlock(test, []types.Transaction{newTestCoinBase()}, bc.tip, 1)
+	if err := bc.AddBlock(b1); err != nil {
+		test.Fatal(err)
+	}
+	if acc, _, err := utxoSet.FindSpendableOutputs(pubKeyHash, 1); err != nil || acc != params.RegTestParams.InitialSubsidy {
+		test.Errorf("invalid spendable amount:\nactual:\n%s %v\nexpected:\n%s <nil>", acc, err, params.RegTestParams.InitialSubsidy)
+	}
+	if err := bc.CheckTransactionLocks(spend); err != nil {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n<nil>", err)
+	}
+	b2 := newTestBlock(test, []types.Transaction{newTestCoinBase(), spend}, b1.Hash, 2)
+	if err := bc.AddBlock(b2); err != nil {
+		test.Fatal(err)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	db_pkg "github.com/YuriyLisovskiy/blockchain-go/src/db"
+)
+
+// Block validation is performed in three stages:
+//   - CheckBlock performs context-free checks and is done before anything is stored;
+//   - checkBlockContext checks the block against its parent before it is stored;
+//   - checkTransactionInputs checks spent outputs and signatures, checkCoinBaseMaturity
+//     checks depth of spent coinbase outputs and checkCoinBaseValue checks the coinbase
+//     amount while the block is connected to the best chain.
+// A block which fails any of the stages is not written to the database.
+
+// CheckBlock performs checks of given block which do not depend on the chain state:
+// the seal of the consensus engine, size limits, merkle root, presence of a single
+// coinbase and structure of transactions.
+func CheckBlock(block types.Block, chainParams *params.ChainParams) error {
+	engine, err := NewEngine(chainParams, nil, nil)
+	if err != nil {
+		return err
+	}
+	err = engine.VerifySeal(block)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp > time.Now().Unix()+vars.MAX_FUTURE_BLOCK_TIME {
+		return ruleError(ErrTimeTooNew, "timestamp of block %x is too far in the future", block.Hash)
+	}
+	if len(block.Transactions) == 0 {
+		return ruleError(ErrBlockEmpty, "block %x has no transactions", block.Hash)
+	}
+	if size := block.Size(); size > chainParams.MaxBlockSize {
+		return ruleError(ErrBlockTooBig, "block %x has %d bytes, maximum is %d", block.Hash, size, chainParams.MaxBlockSize)
+	}
+	if bytes.Compare(block.MerkleRoot, consensus.HashTransactions(block.Transactions)) != 0 {
+		return ruleError(ErrBadMerkleRoot, "merkle root of block %x does not match its transactions", block.Hash)
+	}
+	if !block.Transactions[0].IsCoinBase() {
+		return ruleError(ErrBadCoinBase, "first transaction of block %x is not a coinbase", block.Hash)
+	}
+	txHashes := make(map[string]bool)
+	spentOutputs := make(map[string]bool)
+	sigOps := 0
+	for i, tx := range block.Transactions {
+		if i > 0 && tx.IsCoinBase() {
+			return ruleError(ErrBadCoinBase, "block %x has more than one coinbase", block.Hash)
+		}
+		err := CheckTransaction(tx, chainParams)
+		if err != nil {
+			return err
+		}
+		sigOps += CountSigOps(tx)
+		if sigOps > chainParams.MaxBlockSigOps {
+			return ruleError(ErrTooManySigOps, "block %x has more than %d signature operations", block.Hash, chainParams.MaxBlockSigOps)
+		}
+		txID := hex.EncodeToString(tx.Hash)
+		if txHashes[txID] {
+			return ruleError(ErrDuplicateTx, "transaction %x is included twice", tx.Hash)
+		}
+		txHashes[txID] = true
+		if tx.IsCoinBase() {
+			continue
+		}
+		for _, vin := range tx.VIn {
+			outpoint := fmt.Sprintf("%x:%d", vin.PreviousTx, vin.VOut)
+			if spentOutputs[outpoint] {
+				return ruleError(ErrDuplicateInput, "output %s is spent twice in block %x", outpoint, block.Hash)
+			}
+			spentOutputs[outpoint] = true
+		}
+	}
+	return nil
+}
+
+// CheckTransaction performs checks of given transaction which do not depend on the chain state.
+func CheckTransaction(tx types.Transaction, chainParams *params.ChainParams) error {
+	if bytes.Compare(tx.Hash, tx.CalcHash()) != 0 {
+		return ruleError(ErrBadTxHash, "transaction %x has invalid hash", tx.Hash)
+	}
+	if size := tx.Size(); size > chainParams.MaxTxSize {
+		return ruleError(ErrTxTooBig, "transaction %x has %d bytes, maximum is %d", tx.Hash, size, chainParams.MaxTxSize)
+	}
+	if sigOps := CountSigOps(tx); sigOps > chainParams.MaxBlockSigOps {
+		return ruleError(ErrTooManySigOps, "transaction %x has %d signature operations", tx.Hash, sigOps)
+	}
+	if len(tx.VIn) == 0 {
+		return ruleError(ErrTxVInEmpty, "transaction %x has no inputs", tx.Hash)
+	}
+	if len(tx.VOut) == 0 {
+		return ruleError(ErrTxVOutEmpty, "transaction %x has no outputs", tx.Hash)
+	}
+	outputSum := amount.Amount(0)
+	for _, out := range tx.VOut {
+		if out.Value < 0 {
+			return ruleError(ErrNegativeOutput, "transaction %x has negative output", tx.Hash)
+		}
+		if out.Value > amount.MAX_AMOUNT {
+			return ruleError(ErrOutputTooLarge, "transaction %x has output of %s", tx.Hash, out.Value)
+		}
+		outputSum += out.Value
+		if !outputSum.InRange() {
+			return ruleError(ErrOutTotalTooLarge, "transaction %x creates more than %s", tx.Hash, amount.MAX_AMOUNT)
+		}
+	}
+	if tx.IsCoinBase() {
+		return nil
+	}
+	outpoints := make(map[string]bool)
+	for _, vin := range tx.VIn {
+		if len(vin.PreviousTx) == 0 || vin.VOut < 0 {
+			return ruleError(ErrMissingInput, "transaction %x has null input", tx.Hash)
+		}
+		outpoint := fmt.Sprintf("%x:%d", vin.PreviousTx, vin.VOut)
+		if outpoints[outpoint] {
+			return ruleError(ErrDuplicateInput, "output %s is spent twice in transaction %x", outpoint, tx.Hash)
+		}
+		outpoints[outpoint] = true
+	}
+	return nil
+}
+
+// CountSigOps returns the number of signature checks of the transaction's
+// scripts. Scripts of spent outputs are counted by transactions creating them.
+func CountSigOps(tx types.Transaction) int {
+	count := 0
+	for _, vin := range tx.VIn {
+		count += script.CountSigOps(vin.ScriptSig)
+	}
+	for _, out := range tx.VOut {
+		count += script.CountSigOps(out.ScriptPubKey)
+	}
+	return count
+}
+
+// checkBlockContext checks given block against its ancestors: the parent
+// must be already stored, height must follow parent's height, timestamp must be
+// greater than median time of the last blocks, bits must match the difficulty
+// calculated by the retarget algorithm and lock times of all transactions must
+// be passed by the height and the median time.
+func (bc *BlockChain) checkBlockContext(tx *db_pkg.Tx, block types.Block) error {
+	getHeader := headerGetterFromTx(tx)
+	parent, err := getHeader(block.PrevBlockHash)
+	if err != nil {
+		return ErrOrphanBlock
+	}
+	if block.Height != parent.Height+1 {
+		return ruleError(ErrBadHeight, "block %x has height %d, expected %d", block.Hash, block.Height, parent.Height+1)
+	}
+	medianTime, err := CalcPastMedianTime(parent, getHeader)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp <= medianTime {
+		return ruleError(ErrTimeTooOld, "timestamp of block %x is not after median time %d", block.Hash, medianTime)
+	}
+	for _, blockTx := range block.Transactions {
+		if !blockTx.IsFinal(block.Height, medianTime) {
+			return ruleError(ErrNonFinalTx, "transaction %x is locked until %d", blockTx.Hash, blockTx.LockTime)
+		}
+	}
+	engine, err := NewEngine(bc.params, nil, nil)
+	if err != nil {
+		return err
+	}
+	bits, err := engine.CalcNextBits(parent, getHeader)
+	if err != nil {
+		return err
+	}
+	if block.Bits != bits {
+		return ruleError(ErrBadDiffBits, "block %x has bits %08x, expected %08x", block.Hash, block.Bits, bits)
+	}
+	return nil
+}
+
+// utxoEntry is an unspent output with the height of the block which created it.
+type utxoEntry struct {
+	Output     tx_io.TXOutput
+	Height     int
+	IsCoinBase bool
+}
+
+// outputGetter returns an unspent output by hash of the transaction and index.
+// Reports false if the output is spent or does not exist.
+type outputGetter func(txHash []byte, index int) (utxoEntry, bool, error)
+
+// getUnspentOutput looks for an unspent output in the UTXO bucket.
+func getUnspentOutput(b *db_pkg.Bucket, txHash []byte, index int) (utxoEntry, bool, error) {
+	outsBytes := b.Get(txHash)
+	if outsBytes == nil {
+		return utxoEntry{}, false, nil
+	}
+	outs, err := tx_io.DeserializeOutputs(outsBytes)
+	if err != nil {
+		return utxoEntry{}, false, err
+	}
+	out, ok := outs.Outputs[index]
+	return utxoEntry{Output: out, Height: outs.Height, IsCoinBase: outs.IsCoinBase}, ok, nil
+}
+
+// checkTransactionInputs checks that all inputs of given transaction spend
+// available outputs with valid signatures and that the transaction does
+// not create more coins than it spends. Returns the fee paid by the transaction.
+func checkTransactionInputs(tx types.Transaction, getOutput outputGetter) (amount.Amount, error) {
+	if tx.IsCoinBase() {
+		return 0, nil
+	}
+	inputSum := amount.Amount(0)
+	prevTXs := make(map[string]types.Transaction)
+	for _, vin := range tx.VIn {
+		entry, ok, err := getOutput(vin.PreviousTx, vin.VOut)
+		if err != nil {
+			return 0, err
+		}
+		out := entry.Output
+		if !ok {
+			return 0, ruleError(ErrMissingInput, "output %x:%d spent by transaction %x is spent or does not exist", vin.PreviousTx, vin.VOut, tx.Hash)
+		}
+		inputSum += out.Value
+		if !out.Value.InRange() || !inputSum.InRange() {
+			return 0, ruleError(ErrInputsOutOfRange, "inputs of transaction %x are out of range", tx.Hash)
+		}
+
+		// Transaction.Verify looks spent outputs up in previous transactions.
+		prevTx := prevTXs[hex.EncodeToString(vin.PreviousTx)]
+		prevTx.Hash = vin.PreviousTx
+		for len(prevTx.VOut) <= vin.VOut {
+			prevTx.VOut = append(prevTx.VOut, tx_io.TXOutput{})
+		}
+		prevTx.VOut[vin.VOut] = out
+		prevTXs[hex.EncodeToString(vin.PreviousTx)] = prevTx
+	}
+	if err := tx.Verify(prevTXs); err != nil {
+		return 0, ruleError(err, "transaction %x failed verification", tx.Hash)
+	}
+	outputSum := amount.Amount(0)
+	for _, out := range tx.VOut {
+		outputSum += out.Value
+	}
+	if inputSum < outputSum {
+		return 0, ruleError(ErrInputsBelowOut, "transaction %x spends %s but creates %s", tx.Hash, inputSum, outputSum)
+	}
+	return inputSum - outputSum, nil
+}
+
+// checkCoinBaseMaturity checks that coinbase outputs spent by the transaction
+// are buried under at least maturity blocks when it is included in a block
+// at given height. Outputs which are not found are checked by other rules.
+func checkCoinBaseMaturity(tx types.Transaction, height, maturity int, getOutput outputGetter) error {
+	if tx.IsCoinBase() {
+		return nil
+	}
+	for _, vin := range tx.VIn {
+		entry, ok, err := getOutput(vin.PreviousTx, vin.VOut)
+		if err != nil {
+			return err
+		}
+		if ok && entry.IsCoinBase && height-entry.Height < maturity {
+			return ruleError(ErrImmatureSpend, "transaction %x spends coinbase output %x:%d at depth %d", tx.Hash, vin.PreviousTx, vin.VOut, height-entry.Height)
+		}
+	}
+	return nil
+}
+
+// checkCoinBaseValue checks that the coinbase of given block does not
+// claim more than the block subsidy plus fees of the block's transactions.
+func checkCoinBaseValue(block types.Block, fees amount.Amount, chainParams *params.ChainParams) error {
+	value := amount.Amount(0)
+	for _, out := range block.Transactions[0].VOut {
+		value += out.Value
+	}
+	limit := CalcBlockSubsidy(block.Height, chainParams) + fees
+	if value > limit {
+		return ruleError(ErrBadCoinBaseValue, "coinbase of block %x pays %s, limit is %s", block.Hash, value, limit)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+)
+
+func newTestSpend(test *testing.T, bc BlockChain, w *wallet.Wallet, prevTx []byte, value amount.Amount) types.Transaction {
+	tx := types.Transaction{
+		VIn:       []tx_io.TXInput{{PreviousTx: prevTx, VOut: 0}},
+		VOut:      []tx_io.TXOutput{tx_io.NewTXOutput(value, string(wallet.NewWallet().GetAddress()))},
+		Timestamp: time.Now().UnixNano(),
+	}
+	return newTestSignedTx(test, bc, tx, w.PrivateKey)
+}
+
+func TestCheckBlock(test *testing.T) {
+	block := types.Block{
+		BlockHeader: types.BlockHeader{
+			Timestamp:     time.Now().Unix(),
+			PrevBlockHash: []byte{},
+			Bits:          0x1f00ffff,
+		},
+		Transactions: []types.Transaction{newTestCoinBase()},
+		Hash:         []byte("not a proof of work"),
+	}
+	if err := CheckBlock(block, &params.RegTestParams); !IsRuleError(err, ErrBadProofOfWork) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadProofOfWork)
+	}
+
+	block = newTestBlock(test, []types.Transaction{newTestCoinBase()}, []byte{}, 0)
+	block.Transactions = append(block.Transactions, newTestCoinBase())
+	if err := CheckBlock(block, &params.RegTestParams); !IsRuleError(err, ErrBadMerkleRoot) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadMerkleRoot)
+	}
+
+	// Limits are lowered, so a small block exceeds them.
+	block = newTestBlock(test, []types.Transaction{newTestCoinBase()}, []byte{}, 0)
+	chainParams := params.RegTestParams
+	chainParams.MaxBlockSize = block.Size() - 1
+	if err := CheckBlock(block, &chainParams); !IsRuleError(err, ErrBlockTooBig) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBlockTooBig)
+	}
+	chainParams = params.RegTestParams
+	chainParams.MaxBlockSigOps = 0
+	if err := CheckBlock(block, &chainParams); !IsRuleError(err, ErrTooManySigOps) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrTooManySigOps)
+	}
+}
+
+func TestCheckTransaction(test *testing.T) {
+	w := wallet.NewWallet()
+	input := tx_io.TXInput{PreviousTx: []byte{1, 2, 3}, VOut: 0}
+	output := tx_io.NewTXOutput(1, string(w.GetAddress()))
+	data := []struct {
+		tx     types.Transaction
+		reason error
+	}{
+		{types.Transaction{VOut: []tx_io.TXOutput{output}}, ErrTxVInEmpty},
+		{types.Transaction{VIn: []tx_io.TXInput{input}}, ErrTxVOutEmpty},
+		{types.Transaction{VIn: []tx_io.TXInput{input, input}, VOut: []tx_io.TXOutput{output}}, ErrDuplicateInput},
+		{types.Transaction{VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{{Value: -1}}}, ErrNegativeOutput},
+		{types.Transaction{VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{{Value: amount.MAX_AMOUNT + 1}}}, ErrOutputTooLarge},
+		{types.Transaction{VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{{Value: amount.MAX_AMOUNT}, {Value: 1}}}, ErrOutTotalTooLarge},
+	}
+	for i, item := range data {
+		item.tx.Hash = item.tx.CalcHash()
+		if err := CheckTransaction(item.tx, &params.RegTestParams); !IsRuleError(err, item.reason) {
+			test.Errorf("core.TestCheckTransaction[%d]: invalid error:\nactual:\n%v\nexpected:\n%v", i, err, item.reason)
+		}
+	}
+	tx := types.Transaction{VIn: []tx_io.TXInput{input}, VOut: []tx_io.TXOutput{output}, Hash: []byte{1}}
+	if err := CheckTransaction(tx, &params.RegTestParams); !IsRuleError(err, ErrBadTxHash) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadTxHash)
+	}
+	tx.Hash = tx.CalcHash()
+	chainParams := params.RegTestParams
+	chainParams.MaxTxSize = tx.Size() - 1
+	if err := CheckTransaction(tx, &chainParams); !IsRuleError(err, ErrTxTooBig) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrTxTooBig)
+	}
+}
+
+func TestBlockChain_AddBlockValidation(test *testing.T) {
+	bc, w, closeChain := newTestChain(test)
+	defer closeChain()
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		test.Fatal(err)
+	}
+	genesisTx := genesis.Transactions[0].Hash
+
+	b1 := newTestBlock(test, []types.Transaction{newTestCoinBase(), newTestSpend(test, bc, w, genesisTx, 10)}, genesis.Hash, 1)
+	if err := bc.AddBlock(b1); err != nil {
+		test.Fatal(err)
+	}
+
+	doubleSpend := newTestBlock(test, []types.Transaction{newTestCoinBase(), newTestSpend(test, bc, w, genesisTx, 5)}, b1.Hash, 2)
+	if err := bc.AddBlock(doubleSpend); !IsRuleError(err, ErrMissingInput) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrMissingInput)
+	}
+
+	badHeight := newTestBlock(test, []types.Transaction{newTestCoinBase()}, b1.Hash, 5)
+	if err := bc.AddBlock(badHeight); !IsRuleError(err, ErrBadHeight) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadHeight)
+	}
+
+	header := types.BlockHeader{PrevBlockHash: b1.Hash, Height: 2, Bits: 0x2000ffff, Timestamp: b1.Timestamp + 1}
+	badBits, err := NewBlock(header, []types.Transaction{newTestCoinBase()}, testHasher)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := bc.AddBlock(badBits); !IsRuleError(err, ErrBadDiffBits) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadDiffBits)
+	}
+
+	// The block has no fees, so the coinbase can not claim more than the subsidy.
+	coinBase := NewCoinBaseTX(string(w.GetAddress()), CalcBlockSubsidy(2, &params.RegTestParams)+1, 2)
+	badCoinBase := newTestBlock(test, []types.Transaction{coinBase}, b1.Hash, 2)
+	if err := bc.AddBlock(badCoinBase); !IsRuleError(err, ErrBadCoinBaseValue) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrBadCoinBaseValue)
+	}
+
+	lockedCoinBase := newTestCoinBase()
+	lockedCoinBase.LockTime = 5
+	lockedCoinBase.VIn[0].Sequence = 0
+	lockedCoinBase.Hash = lockedCoinBase.CalcHash()
+	nonFinal := newTestBlock(test, []types.Transaction{lockedCoinBase}, b1.Hash, 2)
+	if err := bc.AddBlock(nonFinal); !IsRuleError(err, ErrNonFinalTx) {
+		test.Errorf("invalid error:\nactual:\n%v\nexpected:\n%v", err, ErrNonFinalTx)
+	}
+	if height, err := bc.GetBestHeight(); err != nil || height != 1 {
+		test.Errorf("invalid best height:\nactual:\n%d\nexpected:\n1", height)
+	}
+}
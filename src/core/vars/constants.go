@@ -15,12 +15,57 @@
 
 package vars
 
-import "math"
+import (
+	"math"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/amount"
+)
 
 const (
-	TARGET_BITS       = 16
-	MINING_REWARD     = 50.0
-	MIN_CURRENCY_UNIT = 0.000001
-	MIN_FEE_PER_BYTE  = 20 * MIN_CURRENCY_UNIT
+	// CHAIN_DB_VERSION is the version of encoding of blocks and unspent outputs
+	// in the chain database, databases of other versions can not be read.
+	CHAIN_DB_VERSION = 1
+
+	BLOCK_VERSION     = 1
+	MIN_CURRENCY_UNIT = amount.UNIT
 	MAX_NONCE         = math.MaxInt32
+	MAX_ORPHAN_BLOCKS = 100
+
+	// Space of a block left for its header and coinbase when transactions
+	// are selected, so the block stays within consensus limits.
+	COINBASE_RESERVED_SIZE   = 1000
+	COINBASE_RESERVED_SIGOPS = 100
+
+	// MIN_FEE_PER_BYTE is the minimum relay fee rate, transactions which pay
+	// less per byte of their serialized size are not accepted to the memory pool.
+	MIN_FEE_PER_BYTE = 20 * MIN_CURRENCY_UNIT
+
+	// Block timestamp must be greater than median time of MEDIAN_TIME_SPAN last
+	// blocks and not more than MAX_FUTURE_BLOCK_TIME seconds ahead of node's time.
+	MEDIAN_TIME_SPAN      = 11
+	MAX_FUTURE_BLOCK_TIME = 2 * 60 * 60
+
+	// Lock times below LOCKTIME_THRESHOLD are block heights, others are unix timestamps.
+	LOCKTIME_THRESHOLD = 500000000
+
+	// Relative lock times of inputs are enforced for transactions
+	// of TX_VERSION and higher, see TXInput.Sequence.
+	TX_VERSION = 2
+
+	// If all inputs have SEQUENCE_FINAL, lock time of the transaction is ignored.
+	SEQUENCE_FINAL = 0xffffffff
+
+	// A transaction of the memory pool may be replaced by a transaction paying
+	// higher fee if any of its inputs has sequence not greater than
+	// MAX_BIP125_RBF_SEQUENCE, see BIP125.
+	MAX_BIP125_RBF_SEQUENCE = 0xfffffffd
+
+	// Relative lock time of an input is disabled if SEQUENCE_LOCKTIME_DISABLE_FLAG
+	// is set. Otherwise the lower 16 bits of the sequence hold a number of blocks,
+	// or a number of 512 seconds intervals if SEQUENCE_LOCKTIME_TYPE_FLAG is set,
+	// which must pass since the spent output was created.
+	SEQUENCE_LOCKTIME_DISABLE_FLAG = 1 << 31
+	SEQUENCE_LOCKTIME_TYPE_FLAG    = 1 << 22
+	SEQUENCE_LOCKTIME_MASK         = 0x0000ffff
+	SEQUENCE_LOCKTIME_GRANULARITY  = 9
 )
@@ -21,6 +21,8 @@
 package x11
 
 import (
+	"sync"
+
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/blake512"
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/bmw512"
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/cubehash512"
@@ -32,109 +34,71 @@ import (
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/shavite512"
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/simd512"
 	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/skein512"
+	"github.com/YuriyLisovskiy/blockchain-go/src/crypto/sha3/utils"
 )
 
-var (
+// hasher holds the eleven digests and buffers of intermediate hashes.
+// Digests keep state while hashing, so a hasher must not be used by
+// several goroutines at once.
+type hasher struct {
 	tha [64]byte
 	thb [64]byte
 
-	blakeHash = blake512.New()
-	bmwHash = bmw512.New()
-	groestlHash = groestl512.New()
-	skeinHash = skein512.New()
-	jhHash = jh512.New()
-	keccakHash = keccak512.New()
-	luffaHash = luffa512.New()
-	cubehashHash = cubehash512.New()
-	shaviteHash = shavite512.New()
-	simdHash = simd512.New()
-	echoHash = echo512.New()
-)
-
-// Hash computes the hash from the src bytes and returns 32-byte hash.
-func Sum256(src []byte) [32]byte {
-	ta := tha[:]
-	tb := thb[:]
-
-	blakeHash.Write(src)
-	blakeHash.Close(tb, 0, 0)
-
-	bmwHash.Write(tb)
-	bmwHash.Close(ta, 0, 0)
-
-	groestlHash.Write(ta)
-	groestlHash.Close(tb, 0, 0)
-
-	skeinHash.Write(tb)
-	skeinHash.Close(ta, 0, 0)
-
-	jhHash.Write(ta)
-	jhHash.Close(tb, 0, 0)
-
-	keccakHash.Write(tb)
-	keccakHash.Close(ta, 0, 0)
-
-	luffaHash.Write(ta)
-	luffaHash.Close(tb, 0, 0)
-
-	cubehashHash.Write(tb)
-	cubehashHash.Close(ta, 0, 0)
-
-	shaviteHash.Write(ta)
-	shaviteHash.Close(tb, 0, 0)
+	digests [11]utils.Digest
+}
 
-	simdHash.Write(tb)
-	simdHash.Close(ta, 0, 0)
+func newHasher() interface{} {
+	return &hasher{
+		digests: [11]utils.Digest{
+			blake512.New(),
+			bmw512.New(),
+			groestl512.New(),
+			skein512.New(),
+			jh512.New(),
+			keccak512.New(),
+			luffa512.New(),
+			cubehash512.New(),
+			shavite512.New(),
+			simd512.New(),
+			echo512.New(),
+		},
+	}
+}
 
-	echoHash.Write(ta)
-	echoHash.Close(tb, 0, 0)
+// hashers lets goroutines hash concurrently without creating digests for each hash.
+var hashers = sync.Pool{New: newHasher}
+
+// sum chains the digests over src, the 64-byte result is left in thb.
+func (h *hasher) sum(src []byte) {
+	ta := h.tha[:]
+	tb := h.thb[:]
+	h.digests[0].Write(src)
+	h.digests[0].Close(tb, 0, 0)
+	for i := 1; i < len(h.digests); i++ {
+		h.digests[i].Write(tb)
+		h.digests[i].Close(ta, 0, 0)
+		ta, tb = tb, ta
+	}
+}
 
+// Hash computes the hash from the src bytes and returns 32-byte hash.
+// It is safe for concurrent use.
+func Sum256(src []byte) [32]byte {
+	h := hashers.Get().(*hasher)
+	defer hashers.Put(h)
+	h.sum(src)
 	var res [32]byte
-	copy(res[:], tb)
-
+	copy(res[:], h.thb[:])
 	return res
 }
 
 // Hash computes the hash from the src bytes and returns 64-byte hash.
+// It is safe for concurrent use.
 func Sum512(src []byte) [64]byte {
-	ta := tha[:]
-	tb := thb[:]
-
-	blakeHash.Write(src)
-	blakeHash.Close(tb, 0, 0)
-
-	bmwHash.Write(tb)
-	bmwHash.Close(ta, 0, 0)
-
-	groestlHash.Write(ta)
-	groestlHash.Close(tb, 0, 0)
-
-	skeinHash.Write(tb)
-	skeinHash.Close(ta, 0, 0)
-
-	jhHash.Write(ta)
-	jhHash.Close(tb, 0, 0)
-
-	keccakHash.Write(tb)
-	keccakHash.Close(ta, 0, 0)
-
-	luffaHash.Write(ta)
-	luffaHash.Close(tb, 0, 0)
-
-	cubehashHash.Write(tb)
-	cubehashHash.Close(ta, 0, 0)
-
-	shaviteHash.Write(ta)
-	shaviteHash.Close(tb, 0, 0)
-
-	simdHash.Write(tb)
-	simdHash.Close(ta, 0, 0)
-
-	echoHash.Write(ta)
-	echoHash.Close(tb, 0, 0)
-
+	h := hashers.Get().(*hasher)
+	defer hashers.Put(h)
+	h.sum(src)
 	var res [64]byte
-	copy(res[:], tb)
-
+	copy(res[:], h.thb[:])
 	return res
 }
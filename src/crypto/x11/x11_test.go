@@ -36,6 +36,7 @@ package x11
 import (
 	"bytes"
 	"encoding/hex"
+	"sync"
 	"testing"
 )
 
@@ -56,6 +57,25 @@ func TestSum512(t *testing.T) {
 	}
 }
 
+func TestSum512_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				data := Sum512_Data[i%len(Sum512_Data)]
+				out := Sum512(data.in)
+				if hex.EncodeToString(out[:]) != string(data.out) {
+					t.Errorf("%s: invalid hash", data.id)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 var Sum512_Data = []struct {
 	id  string
 	in  []byte
@@ -34,4 +34,8 @@ const (
 	PROTOCOL       = "tcp"
 	NODE_VERSION   = 1
 	COMMAND_LENGTH = 12
+
+	// MESSAGE_OVERHEAD is the space of a message in addition to the largest
+	// block, enough for the command, addresses and inventories.
+	MESSAGE_OVERHEAD = 1024 * 1024
 )
@@ -18,26 +18,25 @@ package protocol
 import (
 	"bytes"
 	"encoding/gob"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sync/atomic"
 
 	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mempool"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/static"
 	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
 
-func (*Protocol) HandleAddr(request []byte) {
+func (*Protocol) HandleAddr(request []byte) error {
 	var buff bytes.Buffer
 	payload := addr{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	for _, newNode := range payload.AddrList {
 		if newNode != static.SelfNodeAddress {
@@ -45,43 +44,60 @@ func (*Protocol) HandleAddr(request []byte) {
 		}
 	}
 	utils.PrintLog(fmt.Sprintf("Peers %d\n", len(static.KnownNodes)))
+	return nil
 }
 
-func (p *Protocol) HandleBlock(request []byte) {
+func (p *Protocol) HandleBlock(request []byte) error {
 	var buff bytes.Buffer
 	payload := block{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	blockData := payload.Block
-	block := core.DeserializeBlock(blockData)
+	block, err := core.DeserializeBlock(blockData)
+	if err != nil {
+		return err
+	}
 	utils.PrintLog("Received a new block!\n")
-	p.Config.Chain.AddBlock(block)
-	utils.PrintLog(fmt.Sprintf("Added block %x\n", block.Hash))
+	err = p.Config.Chain.AddBlock(block)
+	if err == core.ErrOrphanBlock {
+		utils.PrintLog(fmt.Sprintf("Received orphan block %x\n", block.Hash))
+
+		// Parents will be received anyway while syncing, otherwise request the missing one.
+		if len(static.BlocksInTransit) == 0 {
+			p.SendGetData(static.SelfNodeAddress, payload.AddrFrom, C_BLOCK, block.PrevBlockHash)
+		}
+	} else if err != nil {
+		utils.PrintLog(fmt.Sprintf("Block %x is rejected: %s\n", block.Hash, err.Error()))
+	} else {
+		utils.PrintLog(fmt.Sprintf("Added block %x\n", block.Hash))
+	}
 	if len(static.BlocksInTransit) > 0 {
 		blockHash := static.BlocksInTransit[0]
 		p.SendGetData(static.SelfNodeAddress, payload.AddrFrom, C_BLOCK, blockHash)
 		static.BlocksInTransit = static.BlocksInTransit[1:]
 	} else {
-		UTXOSet := core.UTXOSet{BlockChain: *p.Config.Chain}
-		UTXOSet.Reindex()
 		atomic.StoreInt32(&vars.Syncing, 0)
 	}
+	return nil
 }
 
-func (p *Protocol) HandleInv(request []byte) {
+func (p *Protocol) HandleInv(request []byte) error {
 	var buff bytes.Buffer
 	payload := inv{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	utils.PrintLog(fmt.Sprintf("Recevied inventory with %d %s\n", len(payload.Items), payload.Type))
+	if len(payload.Items) == 0 {
+		return nil
+	}
 	switch payload.Type {
 	case C_BLOCK:
 		static.BlocksInTransit = payload.Items
@@ -96,70 +112,93 @@ func (p *Protocol) HandleInv(request []byte) {
 		p.SendGetData(static.SelfNodeAddress, payload.AddrFrom, C_BLOCK, blockHash)
 	case C_TX:
 		txID := payload.Items[0]
-		if static.MemPool[hex.EncodeToString(txID)].Hash == nil {
+		if !p.Config.MemPool.Have(txID) {
 			p.SendGetData(static.SelfNodeAddress, payload.AddrFrom, C_TX, txID)
 		}
 	default:
 	}
+	return nil
 }
 
-func (p *Protocol) HandleGetBlocks(request []byte) {
+func (p *Protocol) HandleGetBlocks(request []byte) error {
 	var buff bytes.Buffer
 	payload := getblocks{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	blocks, err := p.Config.Chain.GetBlockHashes(payload.BestHeight)
+	if err != nil {
+		return err
 	}
-	blocks := p.Config.Chain.GetBlockHashes(payload.BestHeight)
 	p.SendInv(static.SelfNodeAddress, payload.AddrFrom, C_BLOCK, blocks)
+	return nil
 }
 
-func (p *Protocol) HandleGetData(request []byte) {
+func (p *Protocol) HandleGetData(request []byte) error {
 	var buff bytes.Buffer
 	payload := getdata{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	switch payload.Type {
 	case C_BLOCK:
 		block, err := p.Config.Chain.GetBlock([]byte(payload.ID))
 		if err != nil {
-			return
+			return err
 		}
 		p.SendBlock(static.SelfNodeAddress, payload.AddrFrom, block)
 	case C_TX:
-		txID := hex.EncodeToString(payload.ID)
-		tx := static.MemPool[txID]
-		p.SendTx(static.SelfNodeAddress, payload.AddrFrom, tx)
-		// delete(mempool, txID)
+		tx, ok := p.Config.MemPool.Get(payload.ID)
+		if ok {
+			p.SendTx(static.SelfNodeAddress, payload.AddrFrom, tx)
+		}
 	default:
 	}
+	return nil
 }
 
-func (p *Protocol) HandleTx(request []byte) {
+func (p *Protocol) HandleTx(request []byte) error {
 	var buff bytes.Buffer
 	payload := tx{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	txData := payload.Transaction
-	tx := core.DeserializeTransaction(txData)
-	static.MemPool[hex.EncodeToString(tx.Hash)] = tx
+	tx, err := core.DeserializeTransaction(txData)
+	if err != nil {
+		return err
+	}
+	accepted, err := p.Config.MemPool.ProcessTransaction(tx)
+	if err == mempool.ErrOrphanTx {
+		utils.PrintLog(fmt.Sprintf("Received orphan transaction %x\n", tx.Hash))
 
-	if !p.Config.Chain.VerifyTransaction(tx) {
-		utils.PrintLog(fmt.Sprintf("Invalid transaction %x\n", tx.Hash))
+		// Request missing parents from the node which sent the transaction.
+		for _, vin := range tx.VIn {
+			if !p.Config.MemPool.Have(vin.PreviousTx) {
+				p.SendGetData(static.SelfNodeAddress, payload.AddFrom, C_TX, vin.PreviousTx)
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		utils.PrintLog(fmt.Sprintf("Rejected transaction %x: %s\n", tx.Hash, err.Error()))
 		data, err := json.MarshalIndent(tx, "", "  ")
 		if err == nil {
 			fmt.Println(string(data))
 		}
+		return nil
+	}
+	for _, desc := range accepted {
+		utils.PrintLog(fmt.Sprintf("Accepted transaction %x\n", desc.Tx.Hash))
 	}
 
 	/*
@@ -202,18 +241,22 @@ func (p *Protocol) HandleTx(request []byte) {
 			}
 		}
 	*/
+	return nil
 }
 
-func (p *Protocol) HandleVersion(request []byte) {
+func (p *Protocol) HandleVersion(request []byte) error {
 	var buff bytes.Buffer
 	payload := version{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	myBestHeight, err := p.Config.Chain.GetBestHeight()
+	if err != nil {
+		return err
 	}
-	myBestHeight := p.Config.Chain.GetBestHeight()
 	foreignerBestHeight := payload.BestHeight
 	if myBestHeight < foreignerBestHeight {
 		atomic.StoreInt32(&vars.Syncing, 1)
@@ -233,6 +276,7 @@ func (p *Protocol) HandleVersion(request []byte) {
 			p.SendAddr(address)
 		}
 	}
+	return nil
 }
 
 func (p *Protocol) HandlePing(request []byte) bool {
@@ -242,34 +286,36 @@ func (p *Protocol) HandlePing(request []byte) bool {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		utils.PrintLog(fmt.Sprintf("Invalid ping: %s\n", err.Error()))
+		return false
 	}
 	return p.SendPong(static.SelfNodeAddress, payload.AddrFrom)
 }
 
-func (*Protocol) HandlePong(request []byte) {
+func (*Protocol) HandlePong(request []byte) error {
 	var buff bytes.Buffer
 	payload := pong{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	if payload.AddrFrom != static.SelfNodeAddress {
 		static.KnownNodes[payload.AddrFrom] = true
 	}
 	utils.PrintLog(fmt.Sprintf("Peers %d\n", len(static.KnownNodes)))
+	return nil
 }
 
-func (*Protocol) HandleMessage(request []byte) {
+func (*Protocol) HandleMessage(request []byte) error {
 	var buff bytes.Buffer
 	payload := msg{}
 	buff.Write(request[COMMAND_LENGTH:])
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	switch payload.Type {
 	case C_SYNCED:
@@ -277,6 +323,7 @@ func (*Protocol) HandleMessage(request []byte) {
 	default:
 		utils.PrintLog("Unknown msg type!\n")
 	}
+	return nil
 }
 
 func (*Protocol) HandleError(request []byte) {
@@ -19,10 +19,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"net"
 
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
 
 func (p *Protocol) sendData(addr string, request []byte) bool {
@@ -35,7 +35,8 @@ func (p *Protocol) sendData(addr string, request []byte) bool {
 	defer conn.Close()
 	_, err = io.Copy(conn, bytes.NewReader(request))
 	if err != nil {
-		log.Panic(err)
+		utils.PrintLog(fmt.Sprintf("Can not send data to %s: %s\n", addr, err.Error()))
+		return false
 	}
 	return true
 }
@@ -80,10 +81,15 @@ func (p *Protocol) SendAddr(addrTo string) bool {
 }
 
 func (p *Protocol) SendGetBlocks(addrFrom, addrTo string) bool {
+	bestHeight, err := p.Config.Chain.GetBestHeight()
+	if err != nil {
+		utils.PrintLog(fmt.Sprintf("Can not get best height: %s\n", err.Error()))
+		return false
+	}
 	return p.sendData(addrTo, MakeRequest(
 		getblocks{
 			AddrFrom:   addrFrom,
-			BestHeight: p.Config.Chain.GetBestHeight(),
+			BestHeight: bestHeight,
 		},
 		C_GETBLOCKS,
 	))
@@ -111,12 +117,17 @@ func (p *Protocol) SendTx(addrFrom, addrTo string, tnx types.Transaction) bool {
 }
 
 func (p *Protocol) SendVersion(addrFrom, addrTo string) bool {
+	bestHeight, err := p.Config.Chain.GetBestHeight()
+	if err != nil {
+		utils.PrintLog(fmt.Sprintf("Can not get best height: %s\n", err.Error()))
+		return false
+	}
 	return p.sendData(
 		addrTo,
 		MakeRequest(
 			version{
 				Version:    NODE_VERSION,
-				BestHeight: p.Config.Chain.GetBestHeight(),
+				BestHeight: bestHeight,
 				AddrFrom:   addrFrom,
 			},
 			C_VERSION,
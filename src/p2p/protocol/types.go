@@ -15,17 +15,27 @@
 
 package protocol
 
-import "github.com/YuriyLisovskiy/blockchain-go/src/core"
+import (
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mempool"
+)
 
 type Configuration struct {
-	Chain *core.BlockChain
-	Nodes *map[string]bool
+	Chain   *core.BlockChain
+	Nodes   *map[string]bool
+	MemPool *mempool.Pool
 }
 
 type Protocol struct {
 	Config *Configuration
 }
 
+// MaxMessageSize returns the greatest number of bytes of a message read
+// from a peer, it follows the block size limit of the chain.
+func (p *Protocol) MaxMessageSize() int {
+	return p.Config.Chain.Params().MaxBlockSize + MESSAGE_OVERHEAD
+}
+
 type Header struct {
 
 }
@@ -17,16 +17,20 @@ package p2p
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"sync/atomic"
 
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
 	"github.com/YuriyLisovskiy/blockchain-go/src/config"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mempool"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/protocol"
 	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/static"
+	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/stratum"
 	"github.com/YuriyLisovskiy/blockchain-go/src/services"
 	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
@@ -35,75 +39,134 @@ type Server struct {
 	protocol      protocol.Protocol
 	pingService   services.PingService
 	miningService services.MiningService
+	feeService    services.FeeEstimatorService
+	stratumServer stratum.Server
 }
 
 func handleConnection(conn net.Conn, proto *protocol.Protocol) {
-	request, err := ioutil.ReadAll(conn)
+	defer conn.Close()
+	// Peers can not make the node buffer more than the largest valid message.
+	maxSize := proto.MaxMessageSize()
+	request, err := ioutil.ReadAll(io.LimitReader(conn, int64(maxSize)+1))
 	if err != nil {
-		log.Panic(err)
+		utils.PrintLog(fmt.Sprintf("Can not read request: %s\n", err.Error()))
+		return
+	}
+	if len(request) > maxSize {
+		utils.PrintLog("Request is too large!\n")
+		return
+	}
+	if len(request) < protocol.COMMAND_LENGTH {
+		utils.PrintLog("Request is too short!\n")
+		return
 	}
 	command := protocol.BytesToCommand(request[:protocol.COMMAND_LENGTH])
 	utils.PrintLog(fmt.Sprintf("Received %s command\n", command))
 	switch command {
 	case protocol.C_ADDR:
-		proto.HandleAddr(request)
+		err = proto.HandleAddr(request)
 	case protocol.C_BLOCK:
-		proto.HandleBlock(request)
+		err = proto.HandleBlock(request)
 	case protocol.C_INV:
-		proto.HandleInv(request)
+		err = proto.HandleInv(request)
 	case protocol.C_GETBLOCKS:
-		proto.HandleGetBlocks(request)
+		err = proto.HandleGetBlocks(request)
 	case protocol.C_GETDATA:
-		proto.HandleGetData(request)
+		err = proto.HandleGetData(request)
 	case protocol.C_TX:
-		proto.HandleTx(request)
+		err = proto.HandleTx(request)
 	case protocol.C_VERSION:
-		proto.HandleVersion(request)
+		err = proto.HandleVersion(request)
 	case protocol.C_PING:
 		proto.HandlePing(request)
 	case protocol.C_PONG:
-		proto.HandlePong(request)
+		err = proto.HandlePong(request)
 	case protocol.C_MESSAGE:
-		proto.HandleMessage(request)
+		err = proto.HandleMessage(request)
 //	case protocol.C_ERROR:
 //		proto.HandleError(request)
 	default:
 		utils.PrintLog("Unknown command!\n")
 	}
-	conn.Close()
+	if err != nil {
+		utils.PrintLog(fmt.Sprintf("Can not handle %s command: %s\n", command, err.Error()))
+	}
 }
 
-func (s *Server) Start(cfg config.Config, minerAddress string) {
+// Start runs the node until listening for connections fails. If minerAddress
+// is set, blocks are mined by given number of goroutines, see MiningService.
+// If stratumAddress is set too, the node does not mine itself, but serves jobs
+// to external miners on that address, see stratum.Server.
+func (s *Server) Start(cfg config.Config, minerAddress string, miningThreads int, stratumAddress string) error {
 	static.SelfNodeAddress = fmt.Sprintf("%s:%d", cfg.Ip, cfg.Port)
 	if _, ok := static.KnownNodes[static.SelfNodeAddress]; ok {
 		delete(static.KnownNodes, static.SelfNodeAddress)
 	}
 	ln, err := net.Listen(protocol.PROTOCOL, static.SelfNodeAddress)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	defer ln.Close()
-	bc := core.NewBlockChain(cfg)
+	bc, err := core.NewBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	estimator, err := bc.LoadFeeEstimator()
+	if err != nil {
+		return err
+	}
+
+	memPool := mempool.New(mempool.Config{
+		Chain:        &bc,
+		FeeEstimator: estimator,
+	})
+	bc.SetListener(memPool.ChainChanged)
 
 	s.protocol = protocol.Protocol{
 		Config: &protocol.Configuration{
-			Chain: &bc,
-			Nodes: &static.KnownNodes,
+			Chain:   &bc,
+			Nodes:   &static.KnownNodes,
+			MemPool: memPool,
 		},
 	}
 	pingService := &services.PingService{}
 	pingService.Start(static.SelfNodeAddress, &s.protocol)
+	s.feeService = services.FeeEstimatorService{Estimator: estimator}
+	s.feeService.Start(&s.protocol)
+	if len(minerAddress) > 0 && len(stratumAddress) > 0 {
+		s.stratumServer = stratum.Server{MinerAddress: minerAddress}
+		err = s.stratumServer.Start(stratumAddress, &s.protocol)
+		if err != nil {
+			return err
+		}
+		defer s.stratumServer.Stop()
+		minerAddress = ""
+	}
 	go s.SyncDB()
-	go func() {
-		if len(minerAddress) > 0 {
-			miningService := &services.MiningService{MinerAddress: minerAddress}
-			miningService.Start(&s.protocol, &static.MemPool)
+	if len(minerAddress) > 0 {
+		s.miningService = services.MiningService{MinerAddress: minerAddress, Threads: miningThreads}
+
+		// Blocks of a proof of authority network are signed with the key of the miner's wallet.
+		if bc.Params().Consensus == params.CONSENSUS_POA {
+			wallets, err := wallet.NewWallets(cfg)
+			if err != nil {
+				return err
+			}
+			minerWallet, err := wallets.GetWallet(minerAddress)
+			if err != nil {
+				return err
+			}
+			s.miningService.SignerKey = minerWallet.PrivateKey
+		}
+		err = s.miningService.Start(&s.protocol)
+		if err != nil {
+			return err
 		}
-	}()
+	}
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 		go handleConnection(conn, &s.protocol)
 	}
@@ -15,8 +15,6 @@
 
 package static
 
-import "github.com/YuriyLisovskiy/blockchain-go/src/core/types"
-
 var (
 	SelfNodeAddress string
 
@@ -26,5 +24,4 @@ var (
 	}
 
 	BlocksInTransit [][]byte
-	MemPool         = make(map[string]types.Transaction)
 )
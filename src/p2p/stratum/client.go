@@ -0,0 +1,298 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package stratum
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/protocol"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// Client is a miner connected to a stratum server.
+type Client struct {
+	conn       net.Conn
+	writeMutex sync.Mutex
+	encoder    *json.Encoder
+	lastID     uint64
+
+	mutex       sync.Mutex
+	pending     map[uint64]chan Message
+	extraNonce1 []byte
+	shareBits   uint32
+	job         *Job
+
+	// workChanged is closed when the job or the share target changes.
+	workChanged chan struct{}
+
+	// closed is closed when the connection fails with err.
+	closed chan struct{}
+	err    error
+}
+
+// Dial connects to a stratum server at given address and subscribes for jobs.
+func Dial(address string) (*Client, error) {
+	conn, err := net.Dial(protocol.PROTOCOL, address)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:        conn,
+		encoder:     json.NewEncoder(conn),
+		pending:     make(map[uint64]chan Message),
+		workChanged: make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+	go c.readMessages()
+	var result SubscribeResult
+	err = c.call(M_SUBSCRIBE, []interface{}{}, &result)
+	if err == nil && (len(result.ExtraNonce1) != EXTRANONCE1_SIZE || result.ExtraNonce2Size != EXTRANONCE2_SIZE) {
+		err = errors.New(fmt.Sprintf("unsupported extra nonce sizes %d and %d", len(result.ExtraNonce1), result.ExtraNonce2Size))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.mutex.Lock()
+	c.extraNonce1 = result.ExtraNonce1
+	c.mutex.Unlock()
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// ExtraNonce1 returns the extra nonce assigned to the miner by the server.
+func (c *Client) ExtraNonce1() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.extraNonce1
+}
+
+// Work returns the latest job and the share target,
+// false is returned if the server has not sent them yet.
+func (c *Client) Work() (Job, uint32, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.job == nil || c.shareBits == 0 {
+		return Job{}, 0, false
+	}
+	return *c.job, c.shareBits, true
+}
+
+// Submit sends a share to the server, *Error is returned if it is rejected.
+func (c *Client) Submit(params SubmitParams) error {
+	var accepted bool
+	err := c.call(M_SUBMIT, params, &accepted)
+	if err == nil && !accepted {
+		err = newOtherError("share is not accepted")
+	}
+	return err
+}
+
+// Mine searches for shares of the latest job and submits them until the context
+// is done or the connection fails. The search moves to a new job as soon as the
+// server sends it. Rejected shares are logged.
+func (c *Client) Mine(ctx context.Context, threads int, stats *core.MiningStats) error {
+	for {
+		c.mutex.Lock()
+		job, shareBits, workChanged := c.job, c.shareBits, c.workChanged
+		c.mutex.Unlock()
+		if job != nil && shareBits != 0 {
+			err := c.mineJob(ctx, *job, shareBits, threads, stats, workChanged)
+			if err != nil {
+				return err
+			}
+		}
+		select {
+		case <-workChanged:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closed:
+			return c.closedErr()
+		}
+	}
+}
+
+// mineJob submits shares of given job until the work changes. Each share
+// is searched with a new extra nonce, so the header is never repeated.
+func (c *Client) mineJob(ctx context.Context, job Job, shareBits uint32, threads int, stats *core.MiningStats, workChanged chan struct{}) error {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-workChanged:
+		case <-c.closed:
+		case <-jobCtx.Done():
+		}
+		cancel()
+	}()
+	hasher, err := core.NewPowHasher(job.PowAlgorithm)
+	if err != nil {
+		utils.PrintLog(fmt.Sprintf("Invalid job %s: %s\n", job.ID, err.Error()))
+		return nil
+	}
+	target := core.CompactToBig(shareBits)
+	extraNonce1 := c.ExtraNonce1()
+	for n := uint64(0); n < 1<<(8*EXTRANONCE2_SIZE) && jobCtx.Err() == nil; n++ {
+		extraNonce2 := make([]byte, EXTRANONCE2_SIZE)
+		binary.BigEndian.PutUint32(extraNonce2, uint32(n))
+		coinBase, err := job.NewCoinBase(extraNonce1, extraNonce2)
+		if err != nil {
+			utils.PrintLog(fmt.Sprintf("Invalid job %s: %s\n", job.ID, err.Error()))
+			return nil
+		}
+		header := job.NewHeader(coinBase, job.Timestamp, 0)
+		worker := core.NewProofOfWorkWithTarget(types.Block{BlockHeader: header}, target, hasher)
+		nonce, _, err := worker.Run(jobCtx, threads, stats)
+		if err == core.ErrNonceExhausted {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		err = c.Submit(SubmitParams{JobID: job.ID, ExtraNonce2: extraNonce2, Timestamp: job.Timestamp, Nonce: nonce})
+		if _, ok := err.(*Error); ok {
+			utils.PrintLog(fmt.Sprintf("Share is rejected: %s\n", err.Error()))
+		} else if err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// call sends a request and waits for the response, result is decoded into given value.
+func (c *Client) call(method string, params interface{}, result interface{}) error {
+	paramsData, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	id := atomic.AddUint64(&c.lastID, 1)
+	response := make(chan Message, 1)
+	c.mutex.Lock()
+	c.pending[id] = response
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+	}()
+	c.writeMutex.Lock()
+	err = c.encoder.Encode(Message{ID: json.RawMessage(strconv.FormatUint(id, 10)), Method: method, Params: paramsData})
+	c.writeMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	select {
+	case msg := <-response:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-c.closed:
+		return c.closedErr()
+	}
+}
+
+// readMessages passes responses to waiting calls and applies notifications
+// until the connection fails.
+func (c *Client) readMessages() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 4096), MAX_MESSAGE_SIZE)
+	for scanner.Scan() {
+		var msg Message
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if len(msg.Method) > 0 {
+			c.handleNotification(msg)
+			continue
+		}
+		id, err := strconv.ParseUint(string(msg.ID), 10, 64)
+		if err != nil {
+			continue
+		}
+		c.mutex.Lock()
+		response, ok := c.pending[id]
+		c.mutex.Unlock()
+		if ok {
+			response <- msg
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	c.fail(err)
+}
+
+func (c *Client) handleNotification(msg Message) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch msg.Method {
+	case M_SET_DIFFICULTY:
+		var params DifficultyParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			utils.PrintLog(fmt.Sprintf("Invalid %s notification: %s\n", msg.Method, err.Error()))
+			return
+		}
+		c.shareBits = params.Bits
+	case M_NOTIFY:
+		var job Job
+		if err := json.Unmarshal(msg.Params, &job); err != nil {
+			utils.PrintLog(fmt.Sprintf("Invalid %s notification: %s\n", msg.Method, err.Error()))
+			return
+		}
+		c.job = &job
+	default:
+		return
+	}
+	close(c.workChanged)
+	c.workChanged = make(chan struct{})
+}
+
+func (c *Client) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.closed)
+	}
+}
+
+func (c *Client) closedErr() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
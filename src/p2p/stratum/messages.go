@@ -0,0 +1,160 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package stratum implements a mining protocol modelled on Stratum, which lets
+// external miner processes do proof of work for the node.
+//
+// Messages are JSON objects sent over TCP, one per line. A miner subscribes and
+// gets a unique extra nonce, then the server sends it the share target and jobs.
+// A job holds the header fields of the next block, its coinbase and merkle leaves
+// of other transactions. The miner pushes both extra nonces in the coinbase's
+// input script, computes the merkle root and searches for a nonce. Headers which
+// meet the share target are submitted as shares, those which meet the block's
+// target complete the block, which is added to the chain and broadcast.
+// The server sends new jobs when the best chain changes.
+package stratum
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/script"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types/tx_io"
+)
+
+const (
+	M_SUBSCRIBE      = "mining.subscribe"
+	M_SET_DIFFICULTY = "mining.set_difficulty"
+	M_NOTIFY         = "mining.notify"
+	M_SUBMIT         = "mining.submit"
+
+	// EXTRANONCE1_SIZE and EXTRANONCE2_SIZE are lengths in bytes of extra nonces
+	// set by the server for each miner and by the miner for each header.
+	EXTRANONCE1_SIZE = 4
+	EXTRANONCE2_SIZE = 4
+
+	// MAX_MESSAGE_SIZE limits the length of a line, it fits jobs of the largest blocks.
+	MAX_MESSAGE_SIZE = 4 * 1024 * 1024
+)
+
+// Error codes follow the Stratum protocol.
+var (
+	ErrOther          = &Error{Code: 20, Message: "other"}
+	ErrJobNotFound    = &Error{Code: 21, Message: "job not found"}
+	ErrDuplicateShare = &Error{Code: 22, Message: "duplicate share"}
+	ErrLowDifficulty  = &Error{Code: 23, Message: "low difficulty share"}
+	ErrNotSubscribed  = &Error{Code: 25, Message: "not subscribed"}
+)
+
+// Error is the error of a response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("stratum error %d: %s", e.Code, e.Message)
+}
+
+func newOtherError(format string, a ...interface{}) *Error {
+	return &Error{Code: ErrOther.Code, Message: fmt.Sprintf(format, a...)}
+}
+
+// Message is a line of the protocol. Requests and notifications have a method,
+// responses have the id of the request they answer. Notifications have null id.
+type Message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+type SubscribeResult struct {
+	ExtraNonce1     []byte `json:"extranonce1"`
+	ExtraNonce2Size int    `json:"extranonce2_size"`
+}
+
+// DifficultyParams sets the target of shares in compact representation.
+type DifficultyParams struct {
+	Bits uint32 `json:"bits"`
+}
+
+// Job is the work sent to miners. Timestamp is the least time of the header.
+// CoinBase is the serialized coinbase without extra nonces, MerkleLeaves are
+// leaves of other transactions of the block. Headers are hashed by the proof
+// of work algorithm of the chain. If CleanJobs is set, previous jobs are not
+// valid anymore.
+type Job struct {
+	ID            string              `json:"job_id"`
+	PowAlgorithm  params.PowAlgorithm `json:"pow_algorithm"`
+	Version       int32               `json:"version"`
+	PrevBlockHash []byte              `json:"prev_block_hash"`
+	Height        int                 `json:"height"`
+	Bits          uint32              `json:"bits"`
+	Timestamp     int64               `json:"ntime"`
+	CoinBase      []byte              `json:"coinbase"`
+	MerkleLeaves  [][]byte            `json:"merkle_leaves"`
+	CleanJobs     bool                `json:"clean_jobs"`
+}
+
+// SubmitParams holds the share: a header of the job made by given
+// extra nonce of the miner, timestamp and nonce.
+type SubmitParams struct {
+	JobID       string `json:"job_id"`
+	ExtraNonce2 []byte `json:"extranonce2"`
+	Timestamp   int64  `json:"ntime"`
+	Nonce       int    `json:"nonce"`
+}
+
+// NewCoinBase returns the job's coinbase with given extra nonces pushed by its input
+// script. The height is pushed before them, so coinbases of different blocks differ
+// even if they have the same extra nonces.
+func (j *Job) NewCoinBase(extraNonce1, extraNonce2 []byte) (types.Transaction, error) {
+	coinBase, err := core.DeserializeTransaction(j.CoinBase)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	if !coinBase.IsCoinBase() {
+		return types.Transaction{}, newOtherError("job %s has no coinbase", j.ID)
+	}
+	extraNonce := append(append([]byte{}, extraNonce1...), extraNonce2...)
+	scriptSig, err := script.NewBuilder().AddInt64(int64(j.Height)).AddData(extraNonce).Script()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	coinBase.VIn = append([]tx_io.TXInput{}, coinBase.VIn...)
+	coinBase.VIn[0].ScriptSig = scriptSig
+	coinBase.Hash = coinBase.CalcHash()
+	return coinBase, nil
+}
+
+// NewHeader returns the header of a block with given coinbase, timestamp and nonce.
+func (j *Job) NewHeader(coinBase types.Transaction, timestamp int64, nonce int) types.BlockHeader {
+	leaves := append([][]byte{consensus.MerkleLeaf(coinBase.Serialize())}, j.MerkleLeaves...)
+	return types.BlockHeader{
+		Version:       j.Version,
+		PrevBlockHash: j.PrevBlockHash,
+		MerkleRoot:    consensus.ComputeMerkleRootFromLeaves(leaves),
+		Timestamp:     timestamp,
+		Bits:          j.Bits,
+		Height:        j.Height,
+		Nonce:         nonce,
+	}
+}
@@ -0,0 +1,479 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package stratum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mining"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/params"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
+	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/protocol"
+	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/static"
+	"github.com/YuriyLisovskiy/blockchain-go/src/services"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+const (
+	// JOB_REFRESH_INTERVAL is how often a new job is sent while the tip does
+	// not change, so transactions which arrived to the memory pool are mined.
+	JOB_REFRESH_INTERVAL = 30 * time.Second
+
+	// MAX_JOBS is the number of the latest jobs shares are accepted for.
+	MAX_JOBS = 16
+
+	// WRITE_TIMEOUT limits the time of sending a message to a miner.
+	WRITE_TIMEOUT = 10 * time.Second
+)
+
+// job is a job sent to miners with transactions of its block,
+// the first of them is the coinbase without extra nonces.
+type job struct {
+	Job
+	transactions []types.Transaction
+	hasher       core.PowHasher
+
+	// shares holds submitted shares to reject duplicates.
+	shares map[string]bool
+}
+
+type session struct {
+	conn    net.Conn
+	mutex   sync.Mutex
+	encoder *json.Encoder
+
+	// extraNonce1 is set when the miner subscribes, jobs are sent to
+	// the miner when it is ready. shareBits is the share target sent
+	// to the miner, zero if no work is sent yet.
+	extraNonce1 []byte
+	ready       bool
+	shareBits   uint32
+}
+
+// write sends a message to the miner, session's mutex must be locked.
+func (s *session) write(msg Message) error {
+	err := s.conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+	if err != nil {
+		return err
+	}
+	return s.encoder.Encode(msg)
+}
+
+// writeWork sends the share target, if it has changed, and the job to the miner.
+// Session's mutex must be locked.
+func (s *session) writeWork(work Job, shareBits uint32) error {
+	if shareBits != s.shareBits {
+		params, err := json.Marshal(DifficultyParams{Bits: shareBits})
+		if err != nil {
+			return err
+		}
+		err = s.write(Message{ID: json.RawMessage("null"), Method: M_SET_DIFFICULTY, Params: params})
+		if err != nil {
+			return err
+		}
+		s.shareBits = shareBits
+	}
+	params, err := json.Marshal(work)
+	if err != nil {
+		return err
+	}
+	return s.write(Message{ID: json.RawMessage("null"), Method: M_NOTIFY, Params: params})
+}
+
+// Server serves jobs to miners and adds blocks they find to the chain.
+type Server struct {
+	// MinerAddress receives rewards of mined blocks.
+	MinerAddress string
+
+	// ShareBits is the target of shares in compact representation,
+	// chain's PowLimit is used if it is zero. If the target of a block
+	// is higher, shares of its job must meet the block's target.
+	ShareBits uint32
+
+	proto    *protocol.Protocol
+	listener net.Listener
+	done     chan struct{}
+
+	// updateMutex makes jobs to be created one by one.
+	updateMutex sync.Mutex
+
+	mutex       sync.Mutex
+	sessions    map[*session]bool
+	jobs        map[string]*job
+	jobIDs      []string
+	lastJob     *job
+	lastJobTime time.Time
+	jobCounter  uint64
+	extraNonce1 uint32
+}
+
+// ErrNotProofOfWork is returned by Start when blocks of the network are not mined.
+var ErrNotProofOfWork = errors.New("network does not use proof of work")
+
+// Start listens for miners on given address and serves them until Stop is called.
+func (s *Server) Start(address string, proto *protocol.Protocol) error {
+	if proto.Config.Chain.Params().Consensus != params.CONSENSUS_POW {
+		return ErrNotProofOfWork
+	}
+	listener, err := net.Listen(protocol.PROTOCOL, address)
+	if err != nil {
+		return err
+	}
+	s.proto = proto
+	s.listener = listener
+	s.done = make(chan struct{})
+	s.sessions = make(map[*session]bool)
+	s.jobs = make(map[string]*job)
+	err = s.updateJob(true)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	go s.watchChain()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				select {
+				case <-s.done:
+				default:
+					utils.PrintLog(fmt.Sprintf("Stratum server stopped: %s\n", err.Error()))
+				}
+				return
+			}
+			go s.handleSession(conn)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Stop closes the listener and connections of miners.
+func (s *Server) Stop() {
+	close(s.done)
+	s.listener.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+}
+
+// watchChain sends new jobs when the tip changes and periodically
+// while it does not, so new transactions are mined.
+func (s *Server) watchChain() {
+	ticker := time.NewTicker(services.TIP_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		if atomic.LoadInt32(&vars.Syncing) == 1 {
+			continue
+		}
+		bestHash, err := s.proto.Config.Chain.GetBestHash()
+		if err != nil {
+			utils.PrintLog(fmt.Sprintf("Can not get the best chain: %s\n", err.Error()))
+			continue
+		}
+		s.mutex.Lock()
+		tipChanged := !bytes.Equal(bestHash, s.lastJob.PrevBlockHash)
+		outdated := time.Since(s.lastJobTime) >= JOB_REFRESH_INTERVAL
+		s.mutex.Unlock()
+		if tipChanged || outdated {
+			err = s.updateJob(tipChanged)
+			if err != nil {
+				utils.PrintLog(fmt.Sprintf("Can not create a mining job: %s\n", err.Error()))
+			}
+		}
+	}
+}
+
+// updateJob creates a job on top of the best chain and sends it to miners.
+// If clean is set, shares of previous jobs are not accepted anymore.
+func (s *Server) updateJob(clean bool) error {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	chain := s.proto.Config.Chain
+	chainParams := chain.Params()
+	hasher, err := core.NewPowHasher(chainParams.PowAlgorithm)
+	if err != nil {
+		return err
+	}
+	template := mining.NewBlockTemplate(s.proto.Config.MemPool.Descs(), mining.BlockMaxSize(chainParams), chainParams.MaxBlockSigOps)
+	block, err := chain.NewBlockCandidate(s.MinerAddress, template.Transactions)
+	if err != nil {
+		return err
+	}
+	var leaves [][]byte
+	for _, tx := range block.Transactions[1:] {
+		leaves = append(leaves, consensus.MerkleLeaf(tx.Serialize()))
+	}
+
+	s.mutex.Lock()
+	s.jobCounter++
+	newJob := &job{
+		Job: Job{
+			ID:            strconv.FormatUint(s.jobCounter, 16),
+			PowAlgorithm:  chainParams.PowAlgorithm,
+			Version:       block.Version,
+			PrevBlockHash: block.PrevBlockHash,
+			Height:        block.Height,
+			Bits:          block.Bits,
+			Timestamp:     block.Timestamp,
+			CoinBase:      block.Transactions[0].Serialize(),
+			MerkleLeaves:  leaves,
+			CleanJobs:     clean,
+		},
+		transactions: block.Transactions,
+		hasher:       hasher,
+		shares:       make(map[string]bool),
+	}
+	if clean {
+		s.jobs = make(map[string]*job)
+		s.jobIDs = nil
+	}
+	s.jobs[newJob.ID] = newJob
+	s.jobIDs = append(s.jobIDs, newJob.ID)
+	if len(s.jobIDs) > MAX_JOBS {
+		delete(s.jobs, s.jobIDs[0])
+		s.jobIDs = s.jobIDs[1:]
+	}
+	s.lastJob = newJob
+	s.lastJobTime = time.Now()
+	var sessions []*session
+	for sess := range s.sessions {
+		if sess.ready {
+			sessions = append(sessions, sess)
+		}
+	}
+	s.mutex.Unlock()
+
+	// Jobs are sent while the update mutex is locked, so miners get them in order.
+	shareBits := core.BigToCompact(s.shareTarget(newJob.Bits))
+	var wg sync.WaitGroup
+	for _, sess := range sessions {
+		wg.Add(1)
+		go func(sess *session) {
+			defer wg.Done()
+			sess.mutex.Lock()
+			defer sess.mutex.Unlock()
+			if err := sess.writeWork(newJob.Job, shareBits); err != nil {
+				sess.conn.Close()
+			}
+		}(sess)
+	}
+	wg.Wait()
+	return nil
+}
+
+// shareTarget returns the target of shares of jobs with given bits.
+func (s *Server) shareTarget(bits uint32) *big.Int {
+	shareBits := s.ShareBits
+	if shareBits == 0 {
+		shareBits = core.BigToCompact(s.proto.Config.Chain.Params().PowLimit)
+	}
+	target := core.CompactToBig(shareBits)
+	if blockTarget := core.CompactToBig(bits); blockTarget.Cmp(target) > 0 {
+		return blockTarget
+	}
+	return target
+}
+
+func (s *Server) handleSession(conn net.Conn) {
+	sess := &session{conn: conn, encoder: json.NewEncoder(conn)}
+	s.mutex.Lock()
+	s.sessions[sess] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.sessions, sess)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), MAX_MESSAGE_SIZE)
+	for scanner.Scan() {
+		var request Message
+		err := json.Unmarshal(scanner.Bytes(), &request)
+		if err != nil {
+			utils.PrintLog(fmt.Sprintf("Invalid stratum request: %s\n", err.Error()))
+			return
+		}
+		var result interface{}
+		var rpcErr *Error
+		switch request.Method {
+		case M_SUBSCRIBE:
+			result, rpcErr = s.subscribe(sess)
+		case M_SUBMIT:
+			result, rpcErr = s.submit(sess, request.Params)
+		default:
+			rpcErr = newOtherError("unknown method %s", request.Method)
+		}
+		response := Message{ID: request.ID, Error: rpcErr}
+		if rpcErr == nil {
+			response.Result, err = json.Marshal(result)
+			if err != nil {
+				return
+			}
+		}
+		sess.mutex.Lock()
+		err = sess.write(response)
+		sess.mutex.Unlock()
+		if err != nil {
+			return
+		}
+		if request.Method == M_SUBSCRIBE && rpcErr == nil && !sess.ready {
+			err = s.startWork(sess)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// startWork sends the latest job to a subscribed miner,
+// further jobs are sent by updateJob.
+func (s *Server) startWork(sess *session) error {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	s.mutex.Lock()
+	sess.ready = true
+	work := s.lastJob.Job
+	s.mutex.Unlock()
+	work.CleanJobs = true
+	return sess.writeWork(work, core.BigToCompact(s.shareTarget(work.Bits)))
+}
+
+// subscribe assigns a unique extra nonce to the miner.
+func (s *Server) subscribe(sess *session) (SubscribeResult, *Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if sess.extraNonce1 == nil {
+		s.extraNonce1++
+		sess.extraNonce1 = make([]byte, EXTRANONCE1_SIZE)
+		binary.BigEndian.PutUint32(sess.extraNonce1, s.extraNonce1)
+	}
+	return SubscribeResult{ExtraNonce1: sess.extraNonce1, ExtraNonce2Size: EXTRANONCE2_SIZE}, nil
+}
+
+// submit validates a share and adds the block to the chain if the share solves it.
+func (s *Server) submit(sess *session, data json.RawMessage) (bool, *Error) {
+	s.mutex.Lock()
+	extraNonce1 := sess.extraNonce1
+	s.mutex.Unlock()
+	if extraNonce1 == nil {
+		return false, ErrNotSubscribed
+	}
+	var params SubmitParams
+	err := json.Unmarshal(data, &params)
+	if err != nil {
+		return false, newOtherError("invalid params: %s", err.Error())
+	}
+	if len(params.ExtraNonce2) != EXTRANONCE2_SIZE {
+		return false, newOtherError("extranonce2 must have %d bytes", EXTRANONCE2_SIZE)
+	}
+	s.mutex.Lock()
+	shareJob, ok := s.jobs[params.JobID]
+	s.mutex.Unlock()
+	if !ok {
+		return false, ErrJobNotFound
+	}
+	if params.Timestamp < shareJob.Timestamp || params.Timestamp > time.Now().Unix()+vars.MAX_FUTURE_BLOCK_TIME {
+		return false, newOtherError("ntime is out of range")
+	}
+	coinBase, err := shareJob.NewCoinBase(extraNonce1, params.ExtraNonce2)
+	if err != nil {
+		return false, newOtherError("%s", err.Error())
+	}
+	header := shareJob.NewHeader(coinBase, params.Timestamp, params.Nonce)
+	hash := core.HashHeader(header, shareJob.hasher)
+	hashInt := new(big.Int).SetBytes(hash)
+	if hashInt.Cmp(s.shareTarget(shareJob.Bits)) >= 0 {
+		return false, ErrLowDifficulty
+	}
+	key := fmt.Sprintf("%x:%x:%d:%d", extraNonce1, params.ExtraNonce2, params.Timestamp, params.Nonce)
+	s.mutex.Lock()
+	duplicate := shareJob.shares[key]
+	shareJob.shares[key] = true
+	s.mutex.Unlock()
+	if duplicate {
+		return false, ErrDuplicateShare
+	}
+	if hashInt.Cmp(core.CompactToBig(shareJob.Bits)) < 0 {
+		block := types.Block{
+			BlockHeader:  header,
+			Transactions: append([]types.Transaction{coinBase}, shareJob.transactions[1:]...),
+			Hash:         hash,
+		}
+		err = s.submitBlock(block)
+		if err != nil {
+			return false, newOtherError("block is rejected: %s", err.Error())
+		}
+	}
+	return true, nil
+}
+
+// submitBlock adds a block found by a miner to the chain, broadcasts it
+// and sends a new job on top of it.
+func (s *Server) submitBlock(block types.Block) error {
+	chain := s.proto.Config.Chain
+	err := chain.AddBlock(block)
+	if err != nil {
+		return err
+	}
+	bestHash, err := chain.GetBestHash()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bestHash, block.Hash) {
+		return nil
+	}
+	utils.PrintLog(fmt.Sprintf("New block %x is mined by a stratum miner\n", block.Hash))
+	go func() {
+		for nodeAddr := range *s.proto.Config.Nodes {
+			if nodeAddr != static.SelfNodeAddress {
+				s.proto.SendBlock(static.SelfNodeAddress, nodeAddr, block)
+			}
+		}
+	}()
+	go func() {
+		if err := s.updateJob(true); err != nil {
+			utils.PrintLog(fmt.Sprintf("Can not create a mining job: %s\n", err.Error()))
+		}
+	}()
+	return nil
+}
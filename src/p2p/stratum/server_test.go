@@ -0,0 +1,192 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package stratum
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/accounts/wallet"
+	"github.com/YuriyLisovskiy/blockchain-go/src/config"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mempool"
+	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/protocol"
+)
+
+// TEST_SHARE_BITS is three quarters of the hash space, while blocks
+// of the regression test network need a half of it, so a hash
+// can be a block, a share only or a low difficulty share.
+const TEST_SHARE_BITS = 0x2100c000
+
+func newTestServer(test *testing.T) (*Server, *core.BlockChain, func()) {
+	dir, err := ioutil.TempDir("", "stratum")
+	if err != nil {
+		test.Fatal(err)
+	}
+	address := string(wallet.NewWallet().GetAddress())
+	cfg := config.Config{ChainPath: filepath.Join(dir, "chain.db"), Network: "regtest"}
+	bc, err := core.CreateBlockChain(address, cfg)
+	if err != nil {
+		test.Fatal(err)
+	}
+	err = core.UTXOSet{BlockChain: bc}.Reindex()
+	if err != nil {
+		test.Fatal(err)
+	}
+	proto := &protocol.Protocol{
+		Config: &protocol.Configuration{
+			Chain:   &bc,
+			Nodes:   &map[string]bool{},
+			MemPool: mempool.New(mempool.Config{Chain: &bc}),
+		},
+	}
+	server := &Server{MinerAddress: address, ShareBits: TEST_SHARE_BITS}
+	err = server.Start("127.0.0.1:0", proto)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return server, &bc, func() {
+		server.Stop()
+		bc.CloseDB(false)
+		os.RemoveAll(dir)
+	}
+}
+
+func waitForWork(test *testing.T, client *Client, height int) Job {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, _, ok := client.Work(); ok && job.Height == height {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Fatalf("no job of height %d is received", height)
+	return Job{}
+}
+
+func errorCode(err error) int {
+	if rpcErr, ok := err.(*Error); ok {
+		return rpcErr.Code
+	}
+	return 0
+}
+
+func TestServer_Submit(test *testing.T) {
+	server, bc, closeServer := newTestServer(test)
+	defer closeServer()
+	client, err := Dial(server.Addr().String())
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer client.Close()
+	job := waitForWork(test, client, 1)
+	if _, shareBits, _ := client.Work(); shareBits != TEST_SHARE_BITS {
+		test.Errorf("invalid share bits:\nactual:\n%x\nexpected:\n%x", shareBits, TEST_SHARE_BITS)
+	}
+
+	// Find nonces of a low difficulty share, a share and a block.
+	extraNonce2 := make([]byte, EXTRANONCE2_SIZE)
+	coinBase, err := job.NewCoinBase(client.ExtraNonce1(), extraNonce2)
+	if err != nil {
+		test.Fatal(err)
+	}
+	hasher, err := core.NewPowHasher(job.PowAlgorithm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	blockTarget, shareTarget := core.CompactToBig(job.Bits), core.CompactToBig(TEST_SHARE_BITS)
+	low, share, block := -1, -1, -1
+	for nonce := 0; low < 0 || share < 0 || block < 0; nonce++ {
+		hash := new(big.Int).SetBytes(core.HashHeader(job.NewHeader(coinBase, job.Timestamp, nonce), hasher))
+		switch {
+		case hash.Cmp(blockTarget) < 0:
+			block = nonce
+		case hash.Cmp(shareTarget) < 0:
+			share = nonce
+		default:
+			low = nonce
+		}
+	}
+	params := func(jobID string, extraNonce2 []byte, nonce int) SubmitParams {
+		return SubmitParams{JobID: jobID, ExtraNonce2: extraNonce2, Timestamp: job.Timestamp, Nonce: nonce}
+	}
+	data := []struct {
+		params SubmitParams
+		code   int
+	}{
+		{params("unknown", extraNonce2, share), ErrJobNotFound.Code},
+		{params(job.ID, []byte{0}, share), ErrOther.Code},
+		{params(job.ID, extraNonce2, low), ErrLowDifficulty.Code},
+		{params(job.ID, extraNonce2, share), 0},
+		{params(job.ID, extraNonce2, share), ErrDuplicateShare.Code},
+		{params(job.ID, extraNonce2, block), 0},
+	}
+	for i, item := range data {
+		if code := errorCode(client.Submit(item.params)); code != item.code {
+			test.Errorf("stratum.TestServer_Submit[%d]: invalid error code:\nactual:\n%d\nexpected:\n%d", i, code, item.code)
+		}
+	}
+	if height, err := bc.GetBestHeight(); err != nil || height != 1 {
+		test.Fatalf("invalid best height:\nactual:\n%d\nexpected:\n1", height)
+	}
+
+	// The block makes a new job which invalidates previous ones.
+	newJob := waitForWork(test, client, 2)
+	if !newJob.CleanJobs {
+		test.Errorf("job %s does not clean previous jobs", newJob.ID)
+	}
+	if code := errorCode(client.Submit(params(job.ID, extraNonce2, share))); code != ErrJobNotFound.Code {
+		test.Errorf("invalid error code:\nactual:\n%d\nexpected:\n%d", code, ErrJobNotFound.Code)
+	}
+}
+
+func TestClient_Mine(test *testing.T) {
+	server, bc, closeServer := newTestServer(test)
+	defer closeServer()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stats := core.NewMiningStats()
+	for i := 0; i < 2; i++ {
+		client, err := Dial(server.Addr().String())
+		if err != nil {
+			test.Fatal(err)
+		}
+		defer client.Close()
+		go client.Mine(ctx, 2, stats)
+	}
+	for {
+		height, err := bc.GetBestHeight()
+		if err != nil {
+			test.Fatal(err)
+		}
+		if height >= 3 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			test.Fatalf("invalid best height:\nactual:\n%d\nexpected:\n3", height)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if stats.Hashes() == 0 {
+		test.Error("no hashes are counted")
+	}
+}
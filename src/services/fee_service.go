@@ -0,0 +1,99 @@
+// Copyright (c) 2018 Yuriy Lisovskiy
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/fees"
+	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/protocol"
+	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
+)
+
+// FeeEstimatorService feeds the fee estimator with blocks of the best chain
+// and saves its data, so estimates are available to the wallet and survive
+// restarts of the node. Blocks which are disconnected from the best chain
+// by reorganizations are rolled back. Memory pool transactions are fed by
+// the protocol.
+type FeeEstimatorService struct {
+	Estimator *fees.Estimator
+}
+
+func (fs *FeeEstimatorService) Start(proto *protocol.Protocol) {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		for range ticker.C {
+			err := fs.processBlocks(proto.Config.Chain)
+			if err != nil {
+				utils.PrintLog(fmt.Sprintf("Can not update fee estimates: %s\n", err.Error()))
+			}
+		}
+	}()
+}
+
+func (fs *FeeEstimatorService) processBlocks(bc *core.BlockChain) error {
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	// Processed blocks which are not in the best chain anymore are rolled back.
+	rolledBack := false
+	for fs.Estimator.BestHash() != nil {
+		height := fs.Estimator.BestHeight()
+		if height <= bestHeight {
+			block, err := bc.GetBlockByHeight(height)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(block.Hash, fs.Estimator.BestHash()) {
+				break
+			}
+		}
+		fs.Estimator.DisconnectBlock()
+		rolledBack = true
+	}
+	height := fs.Estimator.BestHeight() + 1
+	if height > bestHeight && !rolledBack {
+		return nil
+	}
+
+	// Older blocks can not confirm tracked transactions within any target.
+	if height < bestHeight-fees.MAX_CONFIRM_TARGET {
+		height = bestHeight - fees.MAX_CONFIRM_TARGET
+	}
+	for ; height <= bestHeight; height++ {
+		block, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			return err
+		}
+
+		// The best chain has changed meanwhile, it is followed on the next run.
+		bestHash := fs.Estimator.BestHash()
+		if height == fs.Estimator.BestHeight()+1 && bestHash != nil && !bytes.Equal(block.PrevBlockHash, bestHash) {
+			break
+		}
+		var hashes [][]byte
+		for _, tx := range block.Transactions {
+			hashes = append(hashes, tx.Hash)
+		}
+		fs.Estimator.ProcessBlock(height, block.Hash, hashes)
+	}
+	return bc.SaveFeeEstimator(fs.Estimator)
+}
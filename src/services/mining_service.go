@@ -12,63 +12,123 @@
 //
 // You should have received a copy of the GNU General Public License
 // along with this program. If not, see <http://www.gnu.org/licenses/>.
-
 package services
 
 import (
-	"encoding/hex"
-	"encoding/json"
+	"bytes"
+	"context"
 	"fmt"
 	"sync/atomic"
+	"time"
 
+	"github.com/YuriyLisovskiy/blockchain-go/src/consensus"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core"
+	"github.com/YuriyLisovskiy/blockchain-go/src/core/mining"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/types"
 	"github.com/YuriyLisovskiy/blockchain-go/src/core/vars"
 	"github.com/YuriyLisovskiy/blockchain-go/src/p2p/protocol"
 	"github.com/YuriyLisovskiy/blockchain-go/src/utils"
 )
 
+// TIP_POLL_INTERVAL is how often the miner checks whether the best chain
+// has changed, so it stops mining on top of an outdated tip.
+const TIP_POLL_INTERVAL = 200 * time.Millisecond
+
 type MiningService struct {
 	MinerAddress string
-}
 
-func (ms *MiningService) Start(proto *protocol.Protocol, memPool *map[string]types.Transaction) {
-	go func() {
-		for {
-			if atomic.LoadInt32(&vars.Syncing) == 0 {
-				var txs []types.Transaction
-				for _, tx := range *memPool {
-					if proto.Config.Chain.VerifyTransaction(tx) {
+	// Threads is the number of goroutines mining blocks,
+	// runtime.NumCPU() goroutines are used if it is not positive.
+	Threads int
 
-						txs = append(txs, tx)
+	// SignerKey is the private key blocks are signed with
+	// on proof of authority networks.
+	SignerKey []byte
 
-					} else {
-						// TODO: send an error to transaction's author
+	stats *core.MiningStats
+}
 
-						utils.PrintLog(fmt.Sprintf("Invalid transaction %x\n", tx.Hash))
+// Stats returns hash counters of the service, nil if it is not started.
+func (ms *MiningService) Stats() *core.MiningStats {
+	return ms.stats
+}
 
-						data, err := json.MarshalIndent(tx, "", "  ")
-						if err == nil {
-							fmt.Println(string(data))
-						}
+// Start seals blocks on top of the best chain with the consensus engine
+// of the network until the node stops.
+func (ms *MiningService) Start(proto *protocol.Protocol) error {
+	ms.stats = core.NewMiningStats()
+	miner := &core.Miner{Threads: ms.Threads, Stats: ms.stats}
+	engine, err := core.NewEngine(proto.Config.Chain.Params(), miner, ms.SignerKey)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			if atomic.LoadInt32(&vars.Syncing) == 1 {
+				time.Sleep(TIP_POLL_INTERVAL)
+				continue
+			}
+			newBlock, err := ms.mineBlock(proto, engine)
+			if err == context.Canceled {
+				utils.PrintLog("Mining is interrupted by a new tip\n")
+				continue
+			}
+			if err == core.ErrNotInTurn {
+				// Another signer seals the next block, so wait for it.
+				time.Sleep(TIP_POLL_INTERVAL)
+				continue
+			}
+			if err != nil {
+				utils.PrintLog(fmt.Sprintf("Can not mine a block: %s\n", err.Error()))
+				time.Sleep(TIP_POLL_INTERVAL)
+				continue
+			}
+			utils.PrintLog(fmt.Sprintf("New block is mined! Hash rate: %.2f H/s\n", ms.stats.HashRate()))
+			go func() {
+				for nodeAddr := range *proto.Config.Nodes {
+					if nodeAddr != ms.MinerAddress {
+						proto.SendBlock(ms.MinerAddress, nodeAddr, newBlock)
 					}
-					delete(*memPool, hex.EncodeToString(tx.Hash))
-				}
-				newBlock, err := proto.Config.Chain.MineBlock(ms.MinerAddress, txs)
-				if err == nil {
-					utils.PrintLog("New block is mined!\n")
-					go func() {
-						for nodeAddr := range *proto.Config.Nodes {
-							if nodeAddr != ms.MinerAddress {
-								proto.SendBlock(ms.MinerAddress, nodeAddr, newBlock)
-							}
-						}
-					}()
-					UTXOSet := core.UTXOSet{BlockChain: *proto.Config.Chain}
-					//	UTXOSet.Reindex()
-					UTXOSet.Update(newBlock)
 				}
-			}
+			}()
 		}
 	}()
+	return nil
+}
+
+// mineBlock seals a block on top of the best chain. Sealing is cancelled
+// when the tip changes or the node starts syncing.
+func (ms *MiningService) mineBlock(proto *protocol.Protocol, engine consensus.Engine) (types.Block, error) {
+	chain := proto.Config.Chain
+	tip, err := chain.GetBestHash()
+	if err != nil {
+		return types.Block{}, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchTip(ctx, cancel, chain, tip)
+
+	// Transactions of the memory pool are already validated, those which
+	// became invalid since then are skipped while the block is created.
+	chainParams := chain.Params()
+	template := mining.NewBlockTemplate(proto.Config.MemPool.Descs(), mining.BlockMaxSize(chainParams), chainParams.MaxBlockSigOps)
+	return chain.MineBlock(ctx, engine, ms.MinerAddress, template.Transactions)
+}
+
+// watchTip cancels the context when the best chain's tip differs from given one.
+func watchTip(ctx context.Context, cancel context.CancelFunc, chain *core.BlockChain, tip []byte) {
+	ticker := time.NewTicker(TIP_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bestHash, err := chain.GetBestHash()
+			if atomic.LoadInt32(&vars.Syncing) == 1 || (err == nil && !bytes.Equal(bestHash, tip)) {
+				cancel()
+				return
+			}
+		}
+	}
 }
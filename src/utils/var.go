@@ -20,4 +20,11 @@ var (
 	WalletFile = "wallets_%d.dat"
 	BLOCKS_BUCKET = []byte("blocks")
 	LAST_BLOCK_HASH = []byte("l")
+	CHAIN_VERSION_KEY = []byte("v")
+	HEADERS_BUCKET = []byte("headers")
+	HEIGHT_INDEX_BUCKET = []byte("heights")
+	TX_INDEX_BUCKET = []byte("txindex")
+	CHAIN_WORK_BUCKET = []byte("chainwork")
+	FEE_ESTIMATES_BUCKET = []byte("feeestimates")
+	FEE_ESTIMATOR_KEY = []byte("e")
 )